@@ -3,15 +3,26 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/mark3labs/mcp-go/client"
+	mcptransport "github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
 
+	"grafana-mcpclient-datasource/pkg/audit"
+	"grafana-mcpclient-datasource/pkg/mcpcontent"
+	"grafana-mcpclient-datasource/pkg/metrics"
 	"grafana-mcpclient-datasource/pkg/models"
+	"grafana-mcpclient-datasource/pkg/policy"
+	"grafana-mcpclient-datasource/pkg/redact"
+	"grafana-mcpclient-datasource/pkg/toolprogress"
 )
 
 // Agent represents an intelligent agent that can process natural language queries
@@ -20,7 +31,16 @@ type Agent struct {
 	mcpClient   *client.Client
 	llmProvider LLMProvider
 	settings    models.MCPDataSourceSettings
+	auditor     *audit.Auditor
+	toolPolicy  *policy.ToolPolicy
+	redactor    *redact.Redactor
 	logger      log.Logger
+
+	// toolProgress routes the progress notifications of running tools, may be nil
+	toolProgress *toolprogress.Tracker
+
+	// tools holds the unfiltered tool definitions, used for policy annotation checks
+	tools []mcp.Tool
 }
 
 // LLMProvider interface for different LLM services
@@ -56,6 +76,17 @@ type StructuredQueryResult struct {
 	Query    string                   `json:"query"`
 	Success  bool                     `json:"success"`
 	ErrorMsg string                   `json:"error_msg,omitempty"`
+
+	// Attachments holds the images and audio the tool returned, shown as is
+	Attachments []mcpcontent.Item `json:"-"`
+
+	// Frames holds frames built without the LLM, e.g. from the structured content
+	// of the tool; they are returned after the frame of Data
+	Frames []*data.Frame `json:"-"`
+
+	// Tables holds further tables, e.g. one per tool when several were called;
+	// each is returned as a frame of its own after Frames
+	Tables []ResultTable `json:"tables,omitempty"`
 }
 
 // ToolResult represents the result of executing a single tool
@@ -65,26 +96,52 @@ type ToolResult struct {
 	Data      interface{}            `json:"data"`
 	Error     string                 `json:"error,omitempty"`
 	Arguments map[string]interface{} `json:"arguments,omitempty"`
+
+	// Updates holds the progress notifications and log messages the server sent
+	// while the tool was running
+	Updates []toolprogress.Update `json:"-"`
+
+	// Attachments holds the images and audio of the result, which are not passed to the LLM
+	Attachments []mcpcontent.Item `json:"-"`
+
+	// Structured holds the structuredContent of the result, if the tool returned any
+	Structured *mcpcontent.Structured `json:"-"`
 }
 
-// NewAgent creates a new agent with the given MCP client and LLM provider
-func NewAgent(mcpClient *client.Client, settings models.MCPDataSourceSettings) (*Agent, error) {
-	llmProvider, err := createLLMProvider(settings)
+// NewAgent creates a new agent with the given MCP client and LLM provider.
+// Tool invocations are recorded with auditor, and their progress notifications are
+// received through toolProgress, the tracker registered with mcpClient. Both may be nil.
+func NewAgent(mcpClient *client.Client, settings models.MCPDataSourceSettings, auditor *audit.Auditor, toolProgress *toolprogress.Tracker) (*Agent, error) {
+	llmProvider, err := newRoutedProvider(settings)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create LLM provider: %w", err)
 	}
 
+	toolPolicy, err := policy.NewToolPolicy(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tool policy: %w", err)
+	}
+
+	redactor, err := redact.NewRedactor(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redactor: %w", err)
+	}
+
 	return &Agent{
-		mcpClient:   mcpClient,
-		llmProvider: llmProvider,
-		settings:    settings,
-		logger:      log.DefaultLogger,
+		mcpClient:    mcpClient,
+		llmProvider:  llmProvider,
+		settings:     settings,
+		auditor:      auditor,
+		toolPolicy:   toolPolicy,
+		redactor:     redactor,
+		logger:       log.DefaultLogger,
+		toolProgress: toolProgress,
 	}, nil
 }
 
 // ProcessQuery processes a natural language query using available MCP tools
 func (a *Agent) ProcessQuery(ctx context.Context, query string) (*QueryResult, error) {
-	a.logger.Info("Processing natural language query", "query", query)
+	a.logger.Info("Processing natural language query", "query", a.redactor.String(query))
 
 	// 1. Get available tools from MCP server
 	tools, err := a.getAvailableTools(ctx)
@@ -92,17 +149,22 @@ func (a *Agent) ProcessQuery(ctx context.Context, query string) (*QueryResult, e
 		return nil, fmt.Errorf("failed to get available tools: %w", err)
 	}
 
+	// Only offer tools allowed by the tool policy to the LLM
+	a.tools = tools
+	tools = a.toolPolicy.Filter(tools)
+
 	a.logger.Info("Found available tools", "count", len(tools))
 
 	// 2. Use LLM to determine which tools to call
-	toolCall, err := a.llmProvider.GenerateToolCall(ctx, query, tools)
+	reportProgress(ctx, ProgressEvent{Stage: StageSelectingTool, Message: "Selecting tool…"})
+	toolCall, err := a.generateToolCall(ctx, query, tools)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate tool call: %w", err)
 	}
 
 	if toolCall == nil {
 		// No tools needed, generate a direct response
-		response, err := a.llmProvider.GenerateResponse(ctx, fmt.Sprintf("The user asked: %s\n\nAvailable tools: %s\n\nProvide a helpful response explaining what tools are available.", query, a.formatToolsForPrompt(tools)))
+		response, err := a.llmProvider.GenerateResponse(streamSummaryText(ctx), fmt.Sprintf("The user asked: %s\n\nAvailable tools: %s\n\nProvide a helpful response explaining what tools are available.", query, a.formatToolsForPrompt(tools)))
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate response: %w", err)
 		}
@@ -116,21 +178,23 @@ func (a *Agent) ProcessQuery(ctx context.Context, query string) (*QueryResult, e
 		}, nil
 	}
 
-	a.logger.Info("Generated tool call", "tool", toolCall.ToolName, "reasoning", toolCall.Reasoning)
+	a.logger.Info("Generated tool call", "tool", toolCall.ToolName, "reasoning", a.redactor.String(toolCall.Reasoning))
 
 	// 3. Execute the selected tool
+	reportProgress(ctx, ProgressEvent{Stage: StageCallingTool, Tool: toolCall.ToolName, Message: fmt.Sprintf("Calling %s…", toolCall.ToolName)})
 	toolResult, err := a.executeTool(ctx, *toolCall)
 	if err != nil {
-		a.logger.Error("Failed to execute tool", "tool", toolCall.ToolName, "error", err)
+		a.logger.Error("Failed to execute tool", "tool", toolCall.ToolName, "error", a.redactor.String(err.Error()))
 		toolResult = ToolResult{
 			ToolName: toolCall.ToolName,
 			Success:  false,
 			Error:    err.Error(),
+			Updates:  toolResult.Updates,
 		}
 	}
 
 	// 4. Generate a summary of the results
-	summary, err := a.generateSummary(ctx, query, []ToolCall{*toolCall}, []ToolResult{toolResult})
+	summary, err := a.generateSummary(streamSummaryText(ctx), query, []ToolCall{*toolCall}, []ToolResult{toolResult})
 	if err != nil {
 		a.logger.Warn("Failed to generate summary", "error", err)
 		summary = fmt.Sprintf("Executed tool '%s' for query: %s", toolCall.ToolName, query)
@@ -150,7 +214,51 @@ func (a *Agent) ProcessQuery(ctx context.Context, query string) (*QueryResult, e
 // If generatedToolCall is provided and matches the current query, it will be used to avoid LLM calls
 // If cachedTools is provided, it will be used instead of fetching tools from the server
 func (a *Agent) ProcessQueryStructured(ctx context.Context, query string, toolName string, timeRangeFrom, timeRangeTo string, generatedToolCall *models.GeneratedToolCall, cachedTools []mcp.Tool) (*StructuredQueryResult, error) {
-	a.logger.Info("Processing natural language query for structured results", "query", query)
+	ctx, span := a.startSpan(ctx, "Agent.ProcessQueryStructured",
+		// The query text may hold sensitive values and is not exported
+		attribute.Int("query.length", len(query)),
+		attribute.String("mcp.tool.selected", toolName),
+		attribute.Bool("cached_tool_call", generatedToolCall != nil && generatedToolCall.OriginalQuery == query),
+	)
+	defer span.End()
+
+	result, err := a.processQueryStructured(ctx, query, toolName, timeRangeFrom, timeRangeTo, generatedToolCall, cachedTools)
+	if err != nil {
+		return nil, tracing.Error(span, err)
+	}
+	if !result.Success {
+		result.ErrorMsg = a.redactor.MaskSecrets(result.ErrorMsg)
+		tracing.Error(span, fmt.Errorf("query processing failed: %s", result.ErrorMsg))
+	}
+	a.addProviderMetadata(result)
+	return result, nil
+}
+
+// addProviderMetadata records which LLM provider handled each task of the query
+func (a *Agent) addProviderMetadata(result *StructuredQueryResult) {
+	router, ok := a.llmProvider.(*routedProvider)
+	if !ok {
+		return
+	}
+
+	used, fallbackUsed := router.Usage()
+	if localParsing, _ := result.Metadata["local_parsing"].(bool); localParsing {
+		// Structured locally, the LLM was not involved
+		delete(used, TaskStructuring)
+	}
+	if len(used) == 0 {
+		return
+	}
+
+	if result.Metadata == nil {
+		result.Metadata = make(map[string]interface{})
+	}
+	result.Metadata["llm_providers"] = used
+	result.Metadata["llm_fallback_used"] = fallbackUsed
+}
+
+func (a *Agent) processQueryStructured(ctx context.Context, query string, toolName string, timeRangeFrom, timeRangeTo string, generatedToolCall *models.GeneratedToolCall, cachedTools []mcp.Tool) (*StructuredQueryResult, error) {
+	a.logger.Info("Processing natural language query for structured results", "query", a.redactor.String(query))
 
 	// 1. Get available tools (only if we need them for LLM tool selection)
 	var tools []mcp.Tool
@@ -158,13 +266,18 @@ func (a *Agent) ProcessQueryStructured(ctx context.Context, query string, toolNa
 
 	// Skip tool fetching if we have a cached generated tool call that matches the query
 	needTools := !(generatedToolCall != nil && generatedToolCall.OriginalQuery == query)
+	metrics.ObserveCacheLookup(a.settings.DatasourceUID, metrics.CacheGeneratedToolCall, !needTools)
 
 	if needTools {
+		metrics.ObserveCacheLookup(a.settings.DatasourceUID, metrics.CacheTools, len(cachedTools) > 0)
 		if len(cachedTools) > 0 {
 			tools = cachedTools
 			a.logger.Info("Using cached tools", "count", len(tools))
 		} else {
 			tools, err = a.getAvailableTools(ctx)
+			if isTransportError(err) {
+				return nil, fmt.Errorf("failed to get available tools: %w", err)
+			}
 			if err != nil {
 				return &StructuredQueryResult{
 					Query:    query,
@@ -174,6 +287,10 @@ func (a *Agent) ProcessQueryStructured(ctx context.Context, query string, toolNa
 			}
 			a.logger.Info("Fetched tools from server", "count", len(tools))
 		}
+
+		// Only offer tools allowed by the tool policy to the LLM
+		a.tools = tools
+		tools = a.toolPolicy.Filter(tools)
 	} else {
 		a.logger.Info("Skipping tool fetching - using cached generated tool call")
 	}
@@ -187,7 +304,7 @@ func (a *Agent) ProcessQueryStructured(ctx context.Context, query string, toolNa
 
 	// Check if we have a cached generated tool call that matches the current query
 	if generatedToolCall != nil && generatedToolCall.OriginalQuery == query {
-		a.logger.Info("Using cached generated tool call", "toolName", generatedToolCall.ToolName, "query", query)
+		a.logger.Info("Using cached generated tool call", "toolName", generatedToolCall.ToolName, "query", a.redactor.String(query))
 		toolCall = &ToolCall{
 			ToolName:  generatedToolCall.ToolName,
 			Arguments: generatedToolCall.Arguments,
@@ -197,6 +314,13 @@ func (a *Agent) ProcessQueryStructured(ctx context.Context, query string, toolNa
 	} else if toolName != "" {
 		a.logger.Info("Using user-selected tool", "toolName", toolName)
 
+		// Reject tools blocked by the policy before asking the LLM for arguments
+		var blocked *policy.BlockedError
+		if err := a.toolPolicy.CheckCall(toolName, a.tools); errors.As(err, &blocked) {
+			a.auditor.RecordToolCall(ctx, "natural_language", toolName, nil, time.Now(), 0, err)
+			return policyBlockedResult(query, blocked), nil
+		}
+
 		// Validate that the selected tool exists
 		var selectedTool *mcp.Tool
 		for _, tool := range tools {
@@ -253,6 +377,7 @@ For example, if this is a log query tool, you might generate:
 Arguments JSON:`, query, selectedTool.Name, selectedTool.Description)
 		}
 
+		reportProgress(ctx, ProgressEvent{Stage: StageGeneratingArgs, Tool: toolName, Message: fmt.Sprintf("Generating arguments for %s…", toolName)})
 		response, err := a.llmProvider.GenerateResponse(ctx, argumentsPrompt)
 		if err == nil {
 			// Try to parse the arguments from LLM response
@@ -285,7 +410,8 @@ Arguments JSON:`, query, selectedTool.Name, selectedTool.Description)
 					enhancedQuery = fmt.Sprintf(`%s from %s to %s`, query, timeRangeFrom, timeRangeTo)
 				}
 
-				toolCall, err = a.llmProvider.GenerateToolCall(ctx, enhancedQuery, tools)
+				reportProgress(ctx, ProgressEvent{Stage: StageSelectingTool, Message: "Selecting tool…"})
+				toolCall, err = a.generateToolCall(ctx, enhancedQuery, tools)
 				if err != nil {
 					return &StructuredQueryResult{
 						Query:    query,
@@ -295,8 +421,10 @@ Arguments JSON:`, query, selectedTool.Name, selectedTool.Description)
 				}
 			} else {
 				// Retry attempt: ask LLM to fix the syntax error
-				a.logger.Info("Attempting to fix syntax error", "attempt", attempt, "lastError", lastError)
-				toolCall, err = a.llmProvider.FixQuerySyntax(ctx, query, toolCall.ToolName, lastError, tools)
+				a.logger.Info("Attempting to fix syntax error", "attempt", attempt, "lastError", a.redactor.String(lastError))
+				reportProgress(ctx, ProgressEvent{Stage: StageFixingSyntax, Tool: toolCall.ToolName, Attempt: attempt, Message: fmt.Sprintf("Retry %d: fixing syntax…", attempt-1)})
+				toolCall, err = a.fixQuerySyntax(ctx, query, toolCall.ToolName, lastError, tools)
+				metrics.ObserveSyntaxFixAttempt(a.settings.DatasourceUID, err)
 				if err != nil {
 					a.logger.Error("Failed to fix syntax error", "attempt", attempt, "error", err)
 					continue // Try next attempt or give up
@@ -321,17 +449,28 @@ Arguments JSON:`, query, selectedTool.Name, selectedTool.Description)
 			}, nil
 		}
 
-		a.logger.Info("Generated tool call", "tool", toolCall.ToolName, "reasoning", toolCall.Reasoning, "attempt", attempt)
+		a.logger.Info("Generated tool call", "tool", toolCall.ToolName, "reasoning", a.redactor.String(toolCall.Reasoning), "attempt", attempt)
 
 		// 3. Execute the selected tool
+		reportProgress(ctx, ProgressEvent{Stage: StageCallingTool, Tool: toolCall.ToolName, Attempt: attempt, Message: fmt.Sprintf("Calling %s…", toolCall.ToolName)})
 		toolResult, err = a.executeTool(ctx, *toolCall)
+		var blocked *policy.BlockedError
+		if errors.As(err, &blocked) {
+			a.logger.Warn("Tool call blocked by policy", "tool", toolCall.ToolName, "reason", blocked.Reason)
+			return policyBlockedResult(query, blocked), nil
+		}
+		if isTransportError(err) {
+			// The connection to the MCP server failed, retrying on it is pointless
+			return nil, fmt.Errorf("failed to execute tool %s: %w", toolCall.ToolName, err)
+		}
 		if err != nil {
-			a.logger.Error("Failed to execute tool", "tool", toolCall.ToolName, "error", err, "attempt", attempt)
+			a.logger.Error("Failed to execute tool", "tool", toolCall.ToolName, "error", a.redactor.String(err.Error()), "attempt", attempt)
 			toolResult = ToolResult{
 				ToolName:  toolCall.ToolName,
 				Success:   false,
 				Error:     err.Error(),
 				Arguments: toolCall.Arguments,
+				Updates:   toolResult.Updates,
 			}
 		}
 
@@ -357,17 +496,29 @@ Arguments JSON:`, query, selectedTool.Name, selectedTool.Description)
 
 		// Store error for next retry attempt
 		lastError = toolResult.Error
-		a.logger.Info("Detected syntax error, will retry", "attempt", attempt, "error", lastError)
+		a.logger.Info("Detected syntax error, will retry", "attempt", attempt, "error", a.redactor.String(lastError))
 	}
 
-	// 5. Generate structured results using LLM
-	structuredResult, err := a.llmProvider.GenerateStructuredResults(ctx, query, []ToolResult{toolResult})
-	if err != nil {
-		return &StructuredQueryResult{
-			Query:    query,
-			Success:  false,
-			ErrorMsg: fmt.Sprintf("Failed to generate structured results: %v", err),
-		}, nil
+	// 5. Build the frame from the structured content of the tool when it returned
+	// some, otherwise parse the result locally, and only when that fails generate
+	// structured results using LLM, streaming the summary as it is written
+	var structuredResult *StructuredQueryResult
+	if toolResult.Success && toolResult.Structured != nil {
+		structuredResult = a.structuredContentResult(query, toolResult, cachedTools)
+	}
+	if structuredResult == nil {
+		structuredResult = structureLocally(query, toolResult)
+	}
+	if structuredResult == nil {
+		reportProgress(ctx, ProgressEvent{Stage: StageStructuringResults, Message: "Structuring results…"})
+		structuredResult, err = a.generateStructuredResults(streamSummaryField(ctx), query, []ToolResult{toolResult})
+		if err != nil {
+			return &StructuredQueryResult{
+				Query:    query,
+				Success:  false,
+				ErrorMsg: fmt.Sprintf("Failed to generate structured results: %v", err),
+			}, nil
+		}
 	}
 
 	// Add additional metadata
@@ -379,9 +530,14 @@ Arguments JSON:`, query, selectedTool.Name, selectedTool.Description)
 	structuredResult.Metadata["tool_success"] = toolResult.Success
 	structuredResult.Metadata["retry_attempts"] = maxRetries
 	structuredResult.Metadata["attempts_made"] = actualAttempts
-	structuredResult.Metadata["arguments"] = toolCall.Arguments
-
-	// Store the generated tool call for future cache use (only if not using cached or user-selected tool)
+	// Frame metadata is returned to the browser and may be saved with dashboards,
+	// so it must never contain the values of secure arguments
+	maskedArguments := a.redactor.MaskSecretsValue(toolCall.Arguments)
+	structuredResult.Metadata["arguments"] = maskedArguments
+
+	// Store the generated tool call for future cache use (only if not using cached or user-selected tool).
+	// A replay calls the tool with these arguments, so they are not masked. The LLM
+	// never sees the values of secure arguments, so they are not part of them.
 	if generatedToolCall == nil && toolName == "" {
 		structuredResult.Metadata["generated_tool_call"] = map[string]interface{}{
 			"toolName":      toolCall.ToolName,
@@ -390,8 +546,13 @@ Arguments JSON:`, query, selectedTool.Name, selectedTool.Description)
 		}
 	}
 
+	if len(toolResult.Updates) > 0 {
+		structuredResult.Metadata["tool_updates"] = toolResult.Updates
+	}
+	structuredResult.Attachments = toolResult.Attachments
+
 	if !toolResult.Success {
-		structuredResult.Metadata["tool_error"] = toolResult.Error
+		structuredResult.Metadata["tool_error"] = a.redactor.MaskSecrets(toolResult.Error)
 		if lastError != "" {
 			structuredResult.Metadata["final_error_after_retries"] = true
 		}
@@ -411,52 +572,186 @@ func (a *Agent) getAvailableTools(ctx context.Context) ([]mcp.Tool, error) {
 
 // executeTool executes a specific tool with the given arguments
 func (a *Agent) executeTool(ctx context.Context, toolCall ToolCall) (ToolResult, error) {
-	a.logger.Info("Executing tool", "tool", toolCall.ToolName, "args", toolCall.Arguments)
+	a.logger.Info("Executing tool", "tool", toolCall.ToolName, "args", a.redactor.Arguments(toolCall.Arguments))
 
+	ctx, span := a.startSpan(ctx, "MCPClient.CallTool", attribute.String("mcp.tool.name", toolCall.ToolName))
+	defer span.End()
+
+	start := time.Now()
+	if err := a.checkToolPolicy(ctx, toolCall.ToolName); err != nil {
+		a.auditor.RecordToolCall(ctx, "natural_language", toolCall.ToolName, toolCall.Arguments, start, 0, err)
+		tracing.Error(span, err)
+		return ToolResult{
+			ToolName:  toolCall.ToolName,
+			Success:   false,
+			Error:     err.Error(),
+			Arguments: toolCall.Arguments,
+		}, err
+	}
+
+	// Relay the progress notifications and log messages of the tool while it runs
+	progressCall := a.toolProgress.Start(func(update toolprogress.Update) {
+		update.Message = a.redactor.MaskSecrets(update.Message)
+		reportProgress(ctx, ToolProgressEvent(toolCall.ToolName, update))
+	})
 	result, err := a.mcpClient.CallTool(ctx, mcp.CallToolRequest{
 		Request: mcp.Request{
 			Method: "tools/call",
 		},
 		Params: mcp.CallToolParams{
+			Meta:      progressCall.Meta(),
 			Name:      toolCall.ToolName,
 			Arguments: toolCall.Arguments,
 		},
 	})
+	progressCall.Done()
+	metrics.ObserveToolCall(a.settings.DatasourceUID, toolCall.ToolName, start, err == nil && !result.IsError)
+
+	updates := progressCall.Updates()
+	for i := range updates {
+		updates[i].Message = a.redactor.MaskSecrets(updates[i].Message)
+	}
 
 	if err != nil {
+		a.auditor.RecordToolCall(ctx, "natural_language", toolCall.ToolName, toolCall.Arguments, start, 0, err)
+		tracing.Error(span, err)
 		return ToolResult{
 			ToolName:  toolCall.ToolName,
 			Success:   false,
 			Error:     err.Error(),
 			Arguments: toolCall.Arguments,
+			Updates:   updates,
 		}, err
 	}
 
-	// Extract text content from the result
+	// Extract the text content and text resources from the result, reading linked resources
+	items, err := mcpcontent.Resolve(ctx, a.mcpClient, result.Content)
+	if err != nil {
+		a.logger.Warn("Failed to read tool result content", "tool", toolCall.ToolName, "error", a.redactor.String(err.Error()))
+	}
 	var resultData interface{}
+	var attachments []mcpcontent.Item
 	if len(result.Content) > 0 {
-		textContents := make([]string, 0, len(result.Content))
-		for _, content := range result.Content {
-			if textContent, ok := mcp.AsTextContent(content); ok {
-				textContents = append(textContents, textContent.Text)
+		textContents := make([]string, 0, len(items))
+		for _, item := range items {
+			if item.IsMedia() {
+				attachments = append(attachments, item)
+			} else if text, ok := item.AsText(); ok {
+				textContents = append(textContents, text)
 			}
 		}
-		if len(textContents) > 0 {
+		switch {
+		case len(textContents) > 0:
 			resultData = strings.Join(textContents, "\n")
-		} else {
+		case len(attachments) > 0:
+			// Never pass base64 media to the LLM
+			resultData = fmt.Sprintf("The tool returned %d image or audio attachments, which are shown to the user as is.", len(attachments))
+		default:
 			resultData = result.Content
 		}
 	}
 
+	var resultErr error
+	if result.IsError {
+		resultErr = tracing.Errorf(span, "tool %s returned an error result", toolCall.ToolName)
+	}
+	a.auditor.RecordToolCall(ctx, "natural_language", toolCall.ToolName, toolCall.Arguments, start, audit.ContentSize(result.Content), resultErr)
+
 	return ToolResult{
-		ToolName:  toolCall.ToolName,
-		Success:   !result.IsError,
-		Data:      resultData,
-		Error:     "",
-		Arguments: toolCall.Arguments,
+		ToolName:    toolCall.ToolName,
+		Success:     !result.IsError,
+		Data:        resultData,
+		Error:       "",
+		Arguments:   toolCall.Arguments,
+		Updates:     updates,
+		Attachments: attachments,
+		Structured:  mcpcontent.StructuredContent(result),
 	}, nil
 }
 
+// structuredContentResult builds the result directly from the structured content
+// of a tool result, typed by the output schema of the tool. It returns nil when the
+// content cannot be converted into a frame.
+func (a *Agent) structuredContentResult(query string, toolResult ToolResult, cachedTools []mcp.Tool) *StructuredQueryResult {
+	frame, err := mcpcontent.StructuredFrame(toolResult.ToolName, toolResult.Structured, a.outputSchema(toolResult.ToolName, cachedTools))
+	if frame == nil {
+		a.logger.Warn("Failed to convert structured content, structuring with the LLM", "tool", toolResult.ToolName, "error", err)
+		return nil
+	}
+
+	metadata := map[string]interface{}{
+		"tool_count":         1,
+		"processed_at":       time.Now(),
+		"local_parsing":      true,
+		"structured_content": true,
+	}
+	if err != nil {
+		metadata["structured_content_errors"] = err.Error()
+	}
+	// Properties next to the rows are kept in the metadata
+	if frame.Meta != nil {
+		metadata["structured_properties"] = frame.Meta.Custom
+		frame.Meta = nil
+	}
+
+	return &StructuredQueryResult{
+		Query:    query,
+		Data:     []map[string]interface{}{},
+		Columns:  []string{},
+		Frames:   []*data.Frame{frame},
+		Summary:  fmt.Sprintf("%d rows from the structured result of %s", frame.Rows(), toolResult.ToolName),
+		Success:  true,
+		Metadata: metadata,
+	}
+}
+
+// outputSchema returns the output schema declared by a tool, or nil if the tool
+// declares none or is unknown
+func (a *Agent) outputSchema(toolName string, cachedTools []mcp.Tool) json.RawMessage {
+	for _, tools := range [][]mcp.Tool{a.tools, cachedTools} {
+		for _, tool := range tools {
+			if tool.Name == toolName {
+				return mcpcontent.OutputSchema(tool)
+			}
+		}
+	}
+	return nil
+}
+
+// isTransportError reports whether err is a failure of the connection to the MCP
+// server rather than an error of the tool, so that the caller can connect again
+func isTransportError(err error) bool {
+	var transportErr *mcptransport.Error
+	return errors.As(err, &transportErr)
+}
+
+// checkToolPolicy verifies that the tool policy allows calling toolName. Tool
+// definitions are fetched from the server when annotations are needed but unknown.
+func (a *Agent) checkToolPolicy(ctx context.Context, toolName string) error {
+	if a.toolPolicy.NeedsAnnotations() && len(a.tools) == 0 {
+		tools, err := a.getAvailableTools(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get tool annotations for policy check: %w", err)
+		}
+		a.tools = tools
+	}
+	return a.toolPolicy.CheckCall(toolName, a.tools)
+}
+
+// policyBlockedResult builds the result returned when the tool policy blocks a call
+func policyBlockedResult(query string, blocked *policy.BlockedError) *StructuredQueryResult {
+	return &StructuredQueryResult{
+		Query:    query,
+		Success:  false,
+		ErrorMsg: blocked.Error(),
+		Metadata: map[string]interface{}{
+			"policy_blocked": true,
+			"tool_name":      blocked.Tool,
+			"policy_reason":  blocked.Reason,
+		},
+	}
+}
+
 // generateSummary creates a human-readable summary of the query processing results
 func (a *Agent) generateSummary(ctx context.Context, query string, toolCalls []ToolCall, results []ToolResult) (string, error) {
 	prompt := fmt.Sprintf(`
@@ -513,17 +808,3 @@ func (a *Agent) getToolNames(tools []mcp.Tool) []string {
 	}
 	return names
 }
-
-// createLLMProvider creates an appropriate LLM provider based on settings
-func createLLMProvider(settings models.MCPDataSourceSettings) (LLMProvider, error) {
-	switch strings.ToLower(settings.LLMProvider) {
-	case "openai":
-		return NewOpenAIProvider(settings)
-	case "anthropic":
-		return NewAnthropicProvider(settings)
-	case "mock", "":
-		return NewMockProvider(settings), nil
-	default:
-		return nil, fmt.Errorf("unsupported LLM provider: %s", settings.LLMProvider)
-	}
-}
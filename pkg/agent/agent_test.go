@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/audit"
+	"grafana-mcpclient-datasource/pkg/models"
+	"grafana-mcpclient-datasource/pkg/policy"
+)
+
+// newPolicyTestAgent returns an agent with the tool policy of settings, connected
+// to a server with a read-only "list_logs" tool and destructive "drop_logs" tool.
+// calls counts the calls that reached the server.
+func newPolicyTestAgent(t *testing.T, settings models.MCPDataSourceSettings) (*Agent, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	handler := func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		calls.Add(1)
+		return mcp.NewToolResultText("done"), nil
+	}
+	mcpServer := server.NewMCPServer("test", "1.0.0")
+	mcpServer.AddTool(mcp.NewTool("list_logs", mcp.WithReadOnlyHintAnnotation(true)), handler)
+	mcpServer.AddTool(mcp.NewTool("drop_logs", mcp.WithReadOnlyHintAnnotation(false), mcp.WithDestructiveHintAnnotation(true)), handler)
+
+	auditor, err := audit.NewAuditor(settings, "test")
+	require.NoError(t, err)
+	a, err := NewAgent(connectTestMCPClient(t, mcpServer), settings, auditor, nil)
+	require.NoError(t, err)
+	return a, &calls
+}
+
+func TestExecuteToolEnforcesPolicy(t *testing.T) {
+	for name, settings := range map[string]models.MCPDataSourceSettings{
+		"deny pattern":      {ToolDenylist: []string{"drop_*"}},
+		"allow pattern":     {ToolAllowlist: []string{"list_*"}},
+		"destructive tools": {BlockDestructiveTools: true},
+		"read-only mode":    {ReadOnlyTools: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			a, calls := newPolicyTestAgent(t, settings)
+
+			result, err := a.executeTool(context.Background(), ToolCall{ToolName: "drop_logs"})
+			var blocked *policy.BlockedError
+			require.ErrorAs(t, err, &blocked)
+			assert.Equal(t, "drop_logs", blocked.Tool)
+			assert.False(t, result.Success)
+			assert.Equal(t, int32(0), calls.Load(), "the blocked call never reaches the server")
+
+			result, err = a.executeTool(context.Background(), ToolCall{ToolName: "list_logs"})
+			require.NoError(t, err)
+			assert.True(t, result.Success)
+			assert.Equal(t, int32(1), calls.Load())
+		})
+	}
+}
+
+func TestProcessQueryRejectsBlockedTools(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	a, calls := newPolicyTestAgent(t, models.MCPDataSourceSettings{
+		BlockDestructiveTools: true,
+		AuditSinks:            []string{"file"},
+		AuditFilePath:         auditPath,
+	})
+
+	// A tool selected in the query editor
+	result, err := a.ProcessQueryStructured(context.Background(), "drop the logs", "drop_logs", "", "", nil, nil)
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, true, result.Metadata["policy_blocked"])
+	assert.Equal(t, "drop_logs", result.Metadata["tool_name"])
+
+	// A cached tool call generated before the policy changed is checked when it runs
+	result, err = a.ProcessQueryStructured(context.Background(), "drop the logs", "drop_logs", "", "", &models.GeneratedToolCall{
+		ToolName:      "drop_logs",
+		OriginalQuery: "drop the logs",
+	}, nil)
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, true, result.Metadata["policy_blocked"])
+	assert.Equal(t, "tool is annotated as destructive", result.Metadata["policy_reason"])
+
+	assert.Equal(t, int32(0), calls.Load())
+
+	// Both refused calls are in the audit log
+	a.auditor.Close()
+	file, err := os.Open(auditPath)
+	require.NoError(t, err)
+	defer file.Close()
+	var events []audit.Event
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		var event audit.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	require.Len(t, events, 2)
+	for _, event := range events {
+		assert.Equal(t, "drop_logs", event.Tool)
+		assert.Equal(t, "natural_language", event.QueryType)
+		assert.Contains(t, event.Error, "blocked by the datasource tool policy")
+	}
+}
@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+const (
+	// azureCognitiveServicesScope is the Entra ID scope for Azure OpenAI
+	azureCognitiveServicesScope = "https://cognitiveservices.azure.com/.default"
+	// azureTokenRefreshMargin is how long before expiry an Entra ID token is renewed
+	azureTokenRefreshMargin = 5 * time.Minute
+)
+
+// NewAzureOpenAIProvider creates a provider for an Azure OpenAI deployment. Requests
+// are routed to the configured deployment and authenticated with either the API
+// key or an Entra ID token obtained with client credentials.
+func NewAzureOpenAIProvider(settings models.MCPDataSourceSettings) (*OpenAIProvider, error) {
+	if settings.AzureEndpoint == "" {
+		return nil, fmt.Errorf("Azure OpenAI endpoint is required")
+	}
+	if settings.AzureDeployment == "" {
+		return nil, fmt.Errorf("Azure OpenAI deployment is required")
+	}
+
+	baseURL := fmt.Sprintf("%s/openai/deployments/%s", strings.TrimSuffix(settings.AzureEndpoint, "/"), url.PathEscape(settings.AzureDeployment))
+	o, err := newOpenAIProvider(settings, "azure", "Azure OpenAI", baseURL, settings.AzureDeployment)
+	if err != nil {
+		return nil, err
+	}
+	o.endpoint += "?api-version=" + url.QueryEscape(settings.GetAzureAPIVersion())
+
+	switch strings.ToLower(settings.AzureAuthType) {
+	case "", "api_key":
+		if settings.LLMAPIKey == "" {
+			return nil, fmt.Errorf("Azure OpenAI API key is required")
+		}
+		o.authorize = func(_ context.Context, req *http.Request) error {
+			req.Header.Set("api-key", settings.LLMAPIKey)
+			return nil
+		}
+	case "client_credentials":
+		tokens, err := entraTokenSourceFor(settings)
+		if err != nil {
+			return nil, err
+		}
+		o.authorize = func(ctx context.Context, req *http.Request) error {
+			token, err := tokens.Token(ctx)
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Azure auth type: %s (supported: api_key, client_credentials)", settings.AzureAuthType)
+	}
+
+	return o, nil
+}
+
+// entraTokenSource obtains and caches Entra ID access tokens with the OAuth 2.0
+// client credentials flow
+type entraTokenSource struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// entraTokenResponse represents the response from the Entra ID token endpoint
+type entraTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+var (
+	entraTokenSourcesMu sync.Mutex
+	entraTokenSources   = make(map[string]*entraTokenSource)
+)
+
+// entraTokenSourceFor returns the token source of a datasource. Providers are
+// created for every query, so the token source is shared by the queries of a
+// datasource and only replaced when its credentials change.
+func entraTokenSourceFor(settings models.MCPDataSourceSettings) (*entraTokenSource, error) {
+	if settings.AzureTenantID == "" || settings.AzureClientID == "" || settings.AzureClientSecret == "" {
+		return nil, fmt.Errorf("tenant ID, client ID and client secret are required for Azure client credentials auth")
+	}
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(settings.GetAzureAuthorityHost(), "/"), url.PathEscape(settings.AzureTenantID))
+
+	entraTokenSourcesMu.Lock()
+	defer entraTokenSourcesMu.Unlock()
+
+	source, ok := entraTokenSources[settings.DatasourceUID]
+	if !ok || source.tokenURL != tokenURL || source.clientID != settings.AzureClientID || source.clientSecret != settings.AzureClientSecret {
+		source = &entraTokenSource{
+			tokenURL:     tokenURL,
+			clientID:     settings.AzureClientID,
+			clientSecret: settings.AzureClientSecret,
+			client:       &http.Client{Timeout: 30 * time.Second},
+		}
+		entraTokenSources[settings.DatasourceUID] = source
+	}
+	return source, nil
+}
+
+// Token returns a cached access token, requesting a new one when it is about to expire
+func (s *entraTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Before(s.expires) {
+		return s.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.clientID},
+		"client_secret": {s.clientSecret},
+		"scope":         {azureCognitiveServicesScope},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request Entra ID token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var token entraTokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("failed to parse token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return "", fmt.Errorf("Entra ID token request failed with status %d: %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+
+	lifetime := time.Duration(token.ExpiresIn) * time.Second
+	if lifetime > 2*azureTokenRefreshMargin {
+		lifetime -= azureTokenRefreshMargin
+	} else {
+		lifetime /= 2
+	}
+	s.token = token.AccessToken
+	s.expires = time.Now().Add(lifetime)
+	return s.token, nil
+}
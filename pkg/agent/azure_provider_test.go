@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+func TestAzureOpenAIWithAPIKey(t *testing.T) {
+	var gotPath, gotVersion, gotKey, gotAuth string
+	server := newLLMServer(t, func(r *http.Request, _ OpenAIRequest) {
+		gotPath = r.URL.Path
+		gotVersion = r.URL.Query().Get("api-version")
+		gotKey = r.Header.Get("api-key")
+		gotAuth = r.Header.Get("Authorization")
+	}, chatCompletion("hello"))
+
+	provider, err := NewAzureOpenAIProvider(models.MCPDataSourceSettings{
+		AzureEndpoint:   server.URL + "/",
+		AzureDeployment: "gpt-4o-prod",
+		LLMAPIKey:       "azure-key",
+	})
+	require.NoError(t, err)
+
+	response, err := provider.GenerateResponse(context.Background(), "ping")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", response)
+
+	assert.Equal(t, "/openai/deployments/gpt-4o-prod/chat/completions", gotPath)
+	assert.Equal(t, "2024-10-21", gotVersion)
+	assert.Equal(t, "azure-key", gotKey)
+	assert.Empty(t, gotAuth)
+}
+
+func TestAzureOpenAIWithClientCredentials(t *testing.T) {
+	tokenRequests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tenant-1/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "client-1", r.PostForm.Get("client_id"))
+		assert.Equal(t, "secret-1", r.PostForm.Get("client_secret"))
+		assert.Equal(t, azureCognitiveServicesScope, r.PostForm.Get("scope"))
+		_ = json.NewEncoder(w).Encode(entraTokenResponse{AccessToken: "entra-token", ExpiresIn: 3600})
+	})
+	var gotAuth []string
+	mux.HandleFunc("/openai/deployments/chat/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+		_ = json.NewEncoder(w).Encode(OpenAIResponse{Choices: []OpenAIChoice{{Message: Message{Content: "ok"}}}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	settings := models.MCPDataSourceSettings{
+		DatasourceUID:      "azure-client-credentials",
+		AzureEndpoint:      server.URL,
+		AzureDeployment:    "chat",
+		AzureAPIVersion:    "2025-01-01-preview",
+		AzureAuthType:      "client_credentials",
+		AzureTenantID:      "tenant-1",
+		AzureClientID:      "client-1",
+		AzureClientSecret:  "secret-1",
+		AzureAuthorityHost: server.URL,
+	}
+
+	// A provider is created for every query of the datasource
+	for i := 0; i < 2; i++ {
+		provider, err := NewAzureOpenAIProvider(settings)
+		require.NoError(t, err)
+		_, err = provider.GenerateResponse(context.Background(), "ping")
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"Bearer entra-token", "Bearer entra-token"}, gotAuth)
+	assert.Equal(t, 1, tokenRequests, "token is cached until it nears expiry")
+
+	settings.AzureClientSecret = "secret-2"
+	tokens, err := entraTokenSourceFor(settings)
+	require.NoError(t, err)
+	assert.Empty(t, tokens.token, "changed credentials get a new token")
+}
+
+func TestAzureOpenAITokenError(t *testing.T) {
+	server := newLLMServer[json.RawMessage](t, nil, llmResponse{
+		status: http.StatusUnauthorized,
+		body:   `{"error":"invalid_client","error_description":"AADSTS7000215: Invalid client secret provided."}`,
+	})
+
+	provider, err := NewAzureOpenAIProvider(models.MCPDataSourceSettings{
+		AzureEndpoint:      server.URL,
+		AzureDeployment:    "chat",
+		AzureAuthType:      "client_credentials",
+		AzureTenantID:      "tenant-1",
+		AzureClientID:      "client-1",
+		AzureClientSecret:  "wrong",
+		AzureAuthorityHost: server.URL,
+	})
+	require.NoError(t, err)
+
+	_, err = provider.GenerateResponse(context.Background(), "ping")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid_client")
+}
+
+func TestAzureOpenAISettings(t *testing.T) {
+	_, err := NewAzureOpenAIProvider(models.MCPDataSourceSettings{AzureDeployment: "chat", LLMAPIKey: "key"})
+	assert.Error(t, err, "endpoint is required")
+
+	_, err = NewAzureOpenAIProvider(models.MCPDataSourceSettings{AzureEndpoint: "https://r.openai.azure.com", LLMAPIKey: "key"})
+	assert.Error(t, err, "deployment is required")
+
+	_, err = NewAzureOpenAIProvider(models.MCPDataSourceSettings{AzureEndpoint: "https://r.openai.azure.com", AzureDeployment: "chat"})
+	assert.Error(t, err, "API key is required")
+
+	_, err = NewAzureOpenAIProvider(models.MCPDataSourceSettings{AzureEndpoint: "https://r.openai.azure.com", AzureDeployment: "chat", AzureAuthType: "client_credentials"})
+	assert.Error(t, err, "client credentials are required")
+
+	_, err = NewAzureOpenAIProvider(models.MCPDataSourceSettings{AzureEndpoint: "https://r.openai.azure.com", AzureDeployment: "chat", AzureAuthType: "managed_identity"})
+	assert.Error(t, err, "unsupported auth type")
+}
@@ -0,0 +1,399 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"grafana-mcpclient-datasource/pkg/llmhttp"
+	"grafana-mcpclient-datasource/pkg/metrics"
+	"grafana-mcpclient-datasource/pkg/models"
+	"grafana-mcpclient-datasource/pkg/redact"
+)
+
+const (
+	// defaultGeminiBaseURL is the base URL of the Gemini API
+	defaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+	// defaultGeminiModel is used when no model is configured
+	defaultGeminiModel = "gemini-2.0-flash"
+)
+
+// geminiSchemaKeys are the JSON Schema keywords supported by Gemini function
+// declarations (an OpenAPI 3.0 subset); all others are dropped
+var geminiSchemaKeys = map[string]bool{
+	"type": true, "format": true, "description": true, "nullable": true, "enum": true,
+	"properties": true, "required": true, "items": true, "minItems": true, "maxItems": true,
+	"minimum": true, "maximum": true, "propertyOrdering": true, "anyOf": true,
+}
+
+// GeminiProvider implements LLM functionality using the Gemini generateContent API
+type GeminiProvider struct {
+	*promptProvider
+	apiKey   string
+	model    string
+	baseURL  string
+	settings models.MCPDataSourceSettings
+	redactor *redact.Redactor
+	client   *llmhttp.Client
+}
+
+// GeminiRequest represents the request structure for generateContent
+type GeminiRequest struct {
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []GeminiTool            `json:"tools,omitempty"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// GeminiContent represents a message made of parts
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []GeminiPart `json:"parts"`
+}
+
+// GeminiPart represents a text part or a function call made by the model
+type GeminiPart struct {
+	Text         string              `json:"text,omitempty"`
+	FunctionCall *GeminiFunctionCall `json:"functionCall,omitempty"`
+}
+
+// GeminiFunctionCall represents a function call returned by the model
+type GeminiFunctionCall struct {
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args"`
+}
+
+// GeminiTool groups the function declarations offered to the model
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+// GeminiFunctionDeclaration describes a callable function
+type GeminiFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// GeminiGenerationConfig controls output length and format
+type GeminiGenerationConfig struct {
+	MaxOutputTokens  int    `json:"maxOutputTokens,omitempty"`
+	ResponseMimeType string `json:"responseMimeType,omitempty"`
+}
+
+// GeminiResponse represents the response from generateContent
+type GeminiResponse struct {
+	Candidates    []GeminiCandidate   `json:"candidates"`
+	UsageMetadata GeminiUsageMetadata `json:"usageMetadata"`
+}
+
+// GeminiCandidate represents a single generated candidate
+type GeminiCandidate struct {
+	Content      GeminiContent `json:"content"`
+	FinishReason string        `json:"finishReason"`
+}
+
+// GeminiUsageMetadata represents token usage information
+type GeminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+}
+
+// NewGeminiProvider creates a new Gemini provider
+func NewGeminiProvider(settings models.MCPDataSourceSettings) (*GeminiProvider, error) {
+	if settings.LLMAPIKey == "" {
+		return nil, fmt.Errorf("Gemini API key is required")
+	}
+
+	model := settings.LLMModel
+	if model == "" {
+		model = defaultGeminiModel
+	}
+
+	baseURL := settings.LLMBaseURL
+	if baseURL == "" {
+		baseURL = defaultGeminiBaseURL
+	}
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		return nil, fmt.Errorf("invalid LLM base URL '%s': must start with http:// or https://", baseURL)
+	}
+
+	redactor, err := redact.NewRedactor(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redactor: %w", err)
+	}
+
+	g := &GeminiProvider{
+		apiKey:   settings.LLMAPIKey,
+		model:    model,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		settings: settings,
+		redactor: redactor,
+	}
+	g.client = llmhttp.For(settings, g.baseURL)
+	g.promptProvider = &promptProvider{name: "Gemini", generate: g.GenerateResponse, generateJSON: g.generateJSON}
+	return g, nil
+}
+
+// GenerateResponse generates a free-text response
+func (g *GeminiProvider) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+	response, err := g.makeRequest(ctx, g.newRequest(prompt))
+	if err != nil {
+		return "", err
+	}
+	return response.text(), nil
+}
+
+// generateJSON generates a response in JSON response mode
+func (g *GeminiProvider) generateJSON(ctx context.Context, prompt string) (string, error) {
+	request := g.newRequest(prompt)
+	request.GenerationConfig.ResponseMimeType = "application/json"
+
+	response, err := g.makeRequest(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	return response.text(), nil
+}
+
+// GenerateToolCall uses Gemini function calling to select a tool, declaring each
+// MCP tool as a function with its input schema as parameters
+func (g *GeminiProvider) GenerateToolCall(ctx context.Context, query string, tools []mcp.Tool) (*ToolCall, error) {
+	if len(tools) == 0 {
+		return nil, nil
+	}
+
+	declarations := make([]GeminiFunctionDeclaration, len(tools))
+	for i, tool := range tools {
+		declarations[i] = GeminiFunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  geminiParameters(tool),
+		}
+	}
+
+	request := g.newRequest(fmt.Sprintf("Call the function that best answers the user query, with the arguments it needs. If no function is needed, answer without calling one.\n\nUser Query: %s", query))
+	request.Tools = []GeminiTool{{FunctionDeclarations: declarations}}
+
+	response, err := g.makeRequest(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tool selection from Gemini: %w", err)
+	}
+
+	call := response.functionCall()
+	if call == nil {
+		return nil, nil
+	}
+
+	arguments := call.Args
+	if arguments == nil {
+		arguments = make(map[string]interface{})
+	}
+	reasoning := strings.TrimSpace(response.text())
+	if reasoning == "" {
+		reasoning = fmt.Sprintf("Selected %s with function calling", call.Name)
+	}
+
+	return &ToolCall{
+		ToolName:  call.Name,
+		Arguments: arguments,
+		Reasoning: reasoning,
+	}, nil
+}
+
+// newRequest creates a request with the system instruction and a single user message
+func (g *GeminiProvider) newRequest(prompt string) GeminiRequest {
+	return GeminiRequest{
+		Contents: []GeminiContent{
+			{Role: "user", Parts: []GeminiPart{{Text: prompt}}},
+		},
+		SystemInstruction: &GeminiContent{Parts: []GeminiPart{{Text: g.settings.GetSystemPrompt()}}},
+		GenerationConfig:  &GeminiGenerationConfig{MaxOutputTokens: g.settings.GetMaxTokens()},
+	}
+}
+
+// makeRequest makes an HTTP request to the generateContent endpoint
+func (g *GeminiProvider) makeRequest(ctx context.Context, request GeminiRequest) (*GeminiResponse, error) {
+	jsonData, err := g.redactor.JSON(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	estimatedTokens := llmhttp.EstimateTokens(jsonData)
+
+	// Stream the response when its text is shown to the user while it is generated
+	stream := textStreamFrom(ctx)
+	endpoint := fmt.Sprintf("%s/models/%s:generateContent", g.baseURL, url.PathEscape(g.model))
+	if stream != nil {
+		endpoint = fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", g.baseURL, url.PathEscape(g.model))
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", g.apiKey)
+
+	resp, err := g.client.Do(req, estimatedTokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var response GeminiResponse
+	if stream != nil && resp.StatusCode == http.StatusOK {
+		if response, err = g.readStream(resp.Body, stream); err != nil {
+			return nil, err
+		}
+	} else {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+		}
+
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+
+	metrics.ObserveLLMTokens(g.settings.DatasourceUID, "gemini", g.model, response.UsageMetadata.PromptTokenCount, response.UsageMetadata.CandidatesTokenCount)
+	g.client.ObserveTokens(estimatedTokens, response.UsageMetadata.PromptTokenCount+response.UsageMetadata.CandidatesTokenCount)
+
+	if len(response.Candidates) == 0 {
+		return nil, fmt.Errorf("no candidates in response")
+	}
+
+	return &response, nil
+}
+
+// readStream reads a streamed response into a single response with the parts of
+// all chunks, passing every piece of text to stream
+func (g *GeminiProvider) readStream(body io.Reader, stream func(text string)) (GeminiResponse, error) {
+	var response GeminiResponse
+
+	err := readSSE(body, g.settings.GetMaxMessageSize(), func(_ string, data []byte) error {
+		var chunk GeminiResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to parse stream chunk: %w", err)
+		}
+		if chunk.UsageMetadata.PromptTokenCount > 0 || chunk.UsageMetadata.CandidatesTokenCount > 0 {
+			response.UsageMetadata = chunk.UsageMetadata
+		}
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+
+		candidate := chunk.Candidates[0]
+		if len(response.Candidates) == 0 {
+			response.Candidates = []GeminiCandidate{{Content: GeminiContent{Role: candidate.Content.Role}}}
+		}
+		merged := &response.Candidates[0]
+		merged.Content.Parts = append(merged.Content.Parts, candidate.Content.Parts...)
+		if candidate.FinishReason != "" {
+			merged.FinishReason = candidate.FinishReason
+		}
+		for _, part := range candidate.Content.Parts {
+			if part.Text != "" {
+				stream(part.Text)
+			}
+		}
+		return nil
+	})
+	return response, err
+}
+
+// text returns the concatenated text parts of the first candidate
+func (r *GeminiResponse) text() string {
+	var text strings.Builder
+	for _, part := range r.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+// functionCall returns the first function call of the first candidate, if any
+func (r *GeminiResponse) functionCall() *GeminiFunctionCall {
+	for _, part := range r.Candidates[0].Content.Parts {
+		if part.FunctionCall != nil {
+			return part.FunctionCall
+		}
+	}
+	return nil
+}
+
+// geminiParameters converts a tool's input schema into a Gemini parameters schema.
+// Returns nil for tools without parameters, which Gemini requires to be omitted.
+func geminiParameters(tool mcp.Tool) map[string]interface{} {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(toolInputSchema(tool), &schema); err != nil {
+		return nil
+	}
+	if properties, _ := schema["properties"].(map[string]interface{}); len(properties) == 0 {
+		return nil
+	}
+	sanitized, _ := sanitizeGeminiSchema(schema).(map[string]interface{})
+	return sanitized
+}
+
+// sanitizeGeminiSchema drops JSON Schema keywords that Gemini rejects
+func sanitizeGeminiSchema(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		sanitized := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			if !geminiSchemaKeys[key] {
+				continue
+			}
+			switch key {
+			case "properties":
+				// Property names are user-defined, so keep all of them
+				properties, _ := item.(map[string]interface{})
+				sanitizedProperties := make(map[string]interface{}, len(properties))
+				for name, property := range properties {
+					sanitizedProperties[name] = sanitizeGeminiSchema(property)
+				}
+				sanitized[key] = sanitizedProperties
+			case "type":
+				// JSON Schema allows a list of types such as ["string", "null"]
+				if types, ok := item.([]interface{}); ok {
+					for _, t := range types {
+						if t == "null" {
+							sanitized["nullable"] = true
+						} else if _, set := sanitized["type"]; !set {
+							sanitized["type"] = t
+						}
+					}
+					continue
+				}
+				sanitized[key] = item
+			case "format":
+				// Gemini rejects string formats other than these
+				if item == "enum" || item == "date-time" {
+					sanitized[key] = item
+				}
+			default:
+				sanitized[key] = sanitizeGeminiSchema(item)
+			}
+		}
+		return sanitized
+	case []interface{}:
+		sanitized := make([]interface{}, len(value))
+		for i, item := range value {
+			sanitized[i] = sanitizeGeminiSchema(item)
+		}
+		return sanitized
+	default:
+		return v
+	}
+}
@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+func TestGeminiGenerateResponse(t *testing.T) {
+	var gotPath, gotKey string
+	var gotRequest GeminiRequest
+	server := newLLMServer(t, func(r *http.Request, request GeminiRequest) {
+		gotPath = r.URL.Path
+		gotKey = r.Header.Get("x-goog-api-key")
+		gotRequest = request
+	}, geminiContent(GeminiPart{Text: "Hello"}, GeminiPart{Text: " there"}))
+
+	provider, err := NewGeminiProvider(models.MCPDataSourceSettings{LLMAPIKey: "gemini-key", LLMBaseURL: server.URL + "/v1beta"})
+	require.NoError(t, err)
+
+	response, err := provider.GenerateResponse(context.Background(), "log in with password=hunter2")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello there", response)
+
+	assert.Equal(t, "/v1beta/models/"+defaultGeminiModel+":generateContent", gotPath)
+	assert.Equal(t, "gemini-key", gotKey)
+	require.Len(t, gotRequest.Contents, 1)
+	assert.Equal(t, "log in with password=[REDACTED:secret]", gotRequest.Contents[0].Parts[0].Text)
+	require.NotNil(t, gotRequest.SystemInstruction)
+	assert.Empty(t, gotRequest.GenerationConfig.ResponseMimeType)
+}
+
+func TestGeminiGenerateToolCall(t *testing.T) {
+	var gotRequest GeminiRequest
+	call := GeminiPart{FunctionCall: &GeminiFunctionCall{Name: "prometheus_query", Args: map[string]interface{}{"expr": "up"}}}
+	server := newLLMServer(t, func(_ *http.Request, request GeminiRequest) {
+		gotRequest = request
+	}, geminiContent(call))
+
+	provider, err := NewGeminiProvider(models.MCPDataSourceSettings{LLMAPIKey: "key", LLMBaseURL: server.URL})
+	require.NoError(t, err)
+
+	tools := []mcp.Tool{
+		mcp.NewToolWithRawSchema("prometheus_query", "Run PromQL", json.RawMessage(`{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				"expr": {"type": "string", "description": "PromQL expression"},
+				"step": {"type": ["string", "null"], "default": "1m"},
+				"time": {"type": "string", "format": "date-time"},
+				"host": {"type": "string", "format": "hostname"}
+			},
+			"required": ["expr"]
+		}`)),
+		mcp.NewTool("list_datasources"),
+	}
+
+	toolCall, err := provider.GenerateToolCall(context.Background(), "is everything up?", tools)
+	require.NoError(t, err)
+	require.NotNil(t, toolCall)
+	assert.Equal(t, "prometheus_query", toolCall.ToolName)
+	assert.Equal(t, "up", toolCall.Arguments["expr"])
+
+	require.Len(t, gotRequest.Tools, 1)
+	declarations := gotRequest.Tools[0].FunctionDeclarations
+	require.Len(t, declarations, 2)
+	assert.Equal(t, map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"expr": map[string]interface{}{"type": "string", "description": "PromQL expression"},
+			"step": map[string]interface{}{"type": "string", "nullable": true},
+			"time": map[string]interface{}{"type": "string", "format": "date-time"},
+			"host": map[string]interface{}{"type": "string"},
+		},
+		"required": []interface{}{"expr"},
+	}, declarations[0].Parameters)
+	assert.Nil(t, declarations[1].Parameters, "tools without parameters omit them")
+}
+
+func TestGeminiGenerateToolCallWithoutFunctionCall(t *testing.T) {
+	server := newLLMServer[GeminiRequest](t, nil, geminiContent(GeminiPart{Text: "No tool is needed."}))
+
+	provider, err := NewGeminiProvider(models.MCPDataSourceSettings{LLMAPIKey: "key", LLMBaseURL: server.URL})
+	require.NoError(t, err)
+
+	toolCall, err := provider.GenerateToolCall(context.Background(), "hello", []mcp.Tool{mcp.NewTool("list_datasources")})
+	require.NoError(t, err)
+	assert.Nil(t, toolCall)
+}
+
+func TestGeminiStructuredResultsUseJSONMode(t *testing.T) {
+	var mimeType string
+	structured := `{"pattern": "^(?P<service>\\S+) had (?P<errors>\\d+) errors$", "summary": "1 service"}`
+	server := newLLMServer(t, func(_ *http.Request, request GeminiRequest) {
+		mimeType = request.GenerationConfig.ResponseMimeType
+	}, geminiContent(GeminiPart{Text: structured}))
+
+	provider, err := NewGeminiProvider(models.MCPDataSourceSettings{LLMAPIKey: "key", LLMBaseURL: server.URL})
+	require.NoError(t, err)
+
+	result, err := provider.GenerateStructuredResults(context.Background(), "errors by service", []ToolResult{
+		{ToolName: "loki_query", Success: true, Data: "api had 3 errors"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", mimeType)
+	require.True(t, result.Success, result.ErrorMsg)
+	assert.Equal(t, []string{"service", "errors"}, result.Columns)
+	require.Len(t, result.Data, 1)
+	assert.Equal(t, "api", result.Data[0]["service"])
+	assert.Equal(t, 3.0, result.Data[0]["errors"])
+}
+
+func TestGeminiSettings(t *testing.T) {
+	_, err := NewGeminiProvider(models.MCPDataSourceSettings{})
+	assert.Error(t, err, "API key is required")
+
+	provider, err := NewGeminiProvider(models.MCPDataSourceSettings{LLMAPIKey: "key", LLMModel: "gemini-1.5-pro"})
+	require.NoError(t, err)
+	assert.Equal(t, defaultGeminiBaseURL, provider.baseURL)
+	assert.Equal(t, "gemini-1.5-pro", provider.model)
+}
+
+func TestGeminiStreamsSummary(t *testing.T) {
+	var gotPath, gotAlt string
+	server := newLLMServer(t, func(r *http.Request, _ GeminiRequest) {
+		gotPath = r.URL.Path
+		gotAlt = r.URL.Query().Get("alt")
+	}, llmResponse{events: []string{
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Latency is "}]}}]}`,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"normal."}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":30,"candidatesTokenCount":4}}`,
+	}})
+
+	provider, err := NewGeminiProvider(models.MCPDataSourceSettings{LLMAPIKey: "key", LLMBaseURL: server.URL})
+	require.NoError(t, err)
+
+	ctx, events := collectProgress()
+	response, err := provider.GenerateResponse(streamSummaryText(ctx), "summarize")
+	require.NoError(t, err)
+	assert.Equal(t, "/models/"+defaultGeminiModel+":streamGenerateContent", gotPath)
+	assert.Equal(t, "sse", gotAlt)
+	assert.Equal(t, "Latency is normal.", response)
+	assert.Equal(t, "Latency is normal.", streamedText(*events))
+}
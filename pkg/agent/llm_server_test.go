@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// llmResponse is a response of a test LLM server. The body is encoded as JSON, or
+// written as is when it is a string; events are written as server-sent events and
+// chunks as NDJSON lines instead, each flushed as it is written.
+type llmResponse struct {
+	status int // 200 when zero
+	body   interface{}
+	events []string
+	chunks []interface{}
+}
+
+// newLLMServer returns a server that answers with responses in order, repeating
+// the last one. Every request is decoded into a T and passed to inspect, when set.
+func newLLMServer[T any](t *testing.T, inspect func(r *http.Request, request T), responses ...llmResponse) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inspect != nil {
+			var request T
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			inspect(r, request)
+		}
+		mu.Lock()
+		response := responses[min(calls, len(responses)-1)]
+		calls++
+		mu.Unlock()
+		response.write(w)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// write writes the response
+func (response llmResponse) write(w http.ResponseWriter) {
+	status := response.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	switch {
+	case response.events != nil:
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(status)
+		for _, event := range response.events {
+			fmt.Fprintf(w, "%s\n\n", event)
+			w.(http.Flusher).Flush()
+		}
+	case response.chunks != nil:
+		w.WriteHeader(status)
+		for _, chunk := range response.chunks {
+			line, _ := json.Marshal(chunk)
+			fmt.Fprintf(w, "%s\n", line)
+			w.(http.Flusher).Flush()
+		}
+	default:
+		if text, ok := response.body.(string); ok {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(text))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if response.body != nil {
+			_ = json.NewEncoder(w).Encode(response.body)
+		}
+	}
+}
+
+// chatCompletion returns a chat completions response with content
+func chatCompletion(content string) llmResponse {
+	return llmResponse{body: OpenAIResponse{
+		Choices: []OpenAIChoice{{Message: Message{Role: "assistant", Content: content}}},
+		Usage:   OpenAIUsage{PromptTokens: 10, CompletionTokens: 5},
+	}}
+}
+
+// geminiContent returns a generateContent response with parts
+func geminiContent(parts ...GeminiPart) llmResponse {
+	return llmResponse{body: GeminiResponse{
+		Candidates:    []GeminiCandidate{{Content: GeminiContent{Role: "model", Parts: parts}, FinishReason: "STOP"}},
+		UsageMetadata: GeminiUsageMetadata{PromptTokenCount: 20, CandidatesTokenCount: 4},
+	}}
+}
@@ -0,0 +1,347 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"grafana-mcpclient-datasource/pkg/llmhttp"
+	"grafana-mcpclient-datasource/pkg/metrics"
+	"grafana-mcpclient-datasource/pkg/models"
+	"grafana-mcpclient-datasource/pkg/redact"
+)
+
+const (
+	// defaultOllamaModel is used when no model is configured
+	defaultOllamaModel = "llama3.1"
+	// ollamaIdleTimeout is the longest gap allowed between streamed chunks once
+	// the first token has arrived
+	ollamaIdleTimeout = 60 * time.Second
+)
+
+// OllamaProvider implements LLM functionality using a local Ollama server's /api/chat
+// endpoint. Responses are streamed so that a slow model load is bounded by its own
+// first-token timeout rather than a timeout on the whole response.
+type OllamaProvider struct {
+	*promptProvider
+	host        string
+	model       string
+	keepAlive   interface{}
+	loadTimeout time.Duration
+	settings    models.MCPDataSourceSettings
+	redactor    *redact.Redactor
+	client      *llmhttp.Client
+	logger      log.Logger
+}
+
+// OllamaChatRequest represents the request structure for /api/chat
+type OllamaChatRequest struct {
+	Model     string                 `json:"model"`
+	Messages  []OllamaMessage        `json:"messages"`
+	Tools     []OllamaTool           `json:"tools,omitempty"`
+	Format    string                 `json:"format,omitempty"`
+	Stream    bool                   `json:"stream"`
+	KeepAlive interface{}            `json:"keep_alive,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+}
+
+// OllamaMessage represents a chat message, including any tool calls made by the model
+type OllamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+}
+
+// OllamaTool represents a function the model may call
+type OllamaTool struct {
+	Type     string         `json:"type"`
+	Function OllamaFunction `json:"function"`
+}
+
+// OllamaFunction describes a callable function with its JSON Schema parameters
+type OllamaFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// OllamaToolCall represents a function call returned by the model
+type OllamaToolCall struct {
+	Function struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	} `json:"function"`
+}
+
+// OllamaChatResponse represents one streamed chunk from /api/chat
+type OllamaChatResponse struct {
+	Message         OllamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	Error           string        `json:"error,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+// NewOllamaProvider creates a new Ollama provider
+func NewOllamaProvider(settings models.MCPDataSourceSettings) (*OllamaProvider, error) {
+	host := settings.GetOllamaHost()
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		return nil, fmt.Errorf("invalid Ollama host '%s': must start with http:// or https://", host)
+	}
+
+	model := settings.LLMModel
+	if model == "" {
+		model = defaultOllamaModel
+	}
+
+	keepAlive, err := parseOllamaKeepAlive(settings.OllamaKeepAlive)
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := redact.NewRedactor(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redactor: %w", err)
+	}
+
+	o := &OllamaProvider{
+		host:        strings.TrimSuffix(host, "/"),
+		model:       model,
+		keepAlive:   keepAlive,
+		loadTimeout: settings.GetOllamaLoadTimeout(),
+		settings:    settings,
+		redactor:    redactor,
+		logger:      log.DefaultLogger,
+	}
+	o.client = llmhttp.For(settings, o.host)
+	// The prompt-based steps expect JSON, so use Ollama's JSON format mode for them
+	o.promptProvider = &promptProvider{name: "Ollama", generate: o.generateJSON}
+	return o, nil
+}
+
+// parseOllamaKeepAlive converts the keep-alive setting into the value Ollama expects:
+// a number of seconds for plain numbers (e.g., "-1", "0") or a duration string ("10m")
+func parseOllamaKeepAlive(value string) (interface{}, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return seconds, nil
+	}
+	if _, err := time.ParseDuration(value); err != nil {
+		return nil, fmt.Errorf("invalid Ollama keep-alive '%s': use a duration such as \"10m\" or a number of seconds", value)
+	}
+	return value, nil
+}
+
+// GenerateResponse generates a free-text response
+func (o *OllamaProvider) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+	message, err := o.chat(ctx, o.newRequest(prompt))
+	if err != nil {
+		return "", err
+	}
+	return message.Content, nil
+}
+
+// generateJSON generates a response constrained to valid JSON
+func (o *OllamaProvider) generateJSON(ctx context.Context, prompt string) (string, error) {
+	request := o.newRequest(prompt)
+	request.Format = "json"
+
+	message, err := o.chat(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	return message.Content, nil
+}
+
+// GenerateToolCall uses Ollama's native tool calling to select a tool. Models
+// without tool support fall back to the prompt-based selection in JSON mode.
+func (o *OllamaProvider) GenerateToolCall(ctx context.Context, query string, tools []mcp.Tool) (*ToolCall, error) {
+	if len(tools) == 0 {
+		return nil, nil
+	}
+
+	request := o.newRequest(fmt.Sprintf("Call the tool that best answers the user query, with the arguments it needs. If no tool is needed, answer without calling a tool.\n\nUser Query: %s", query))
+	request.Tools = make([]OllamaTool, len(tools))
+	for i, tool := range tools {
+		request.Tools[i] = OllamaTool{
+			Type: "function",
+			Function: OllamaFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  toolInputSchema(tool),
+			},
+		}
+	}
+
+	message, err := o.chat(ctx, request)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not support tools") {
+			o.logger.Info("Ollama model does not support tool calling, using prompt-based tool selection", "model", o.model)
+			return o.promptProvider.GenerateToolCall(ctx, query, tools)
+		}
+		return nil, fmt.Errorf("failed to get tool selection from Ollama: %w", err)
+	}
+
+	if len(message.ToolCalls) == 0 {
+		return nil, nil
+	}
+
+	call := message.ToolCalls[0].Function
+	arguments := call.Arguments
+	if arguments == nil {
+		arguments = make(map[string]interface{})
+	}
+	reasoning := strings.TrimSpace(message.Content)
+	if reasoning == "" {
+		reasoning = fmt.Sprintf("Selected %s with native tool calling", call.Name)
+	}
+
+	return &ToolCall{
+		ToolName:  call.Name,
+		Arguments: arguments,
+		Reasoning: reasoning,
+	}, nil
+}
+
+// newRequest creates a chat request with the system prompt and a single user message
+func (o *OllamaProvider) newRequest(prompt string) OllamaChatRequest {
+	return OllamaChatRequest{
+		Model: o.model,
+		Messages: []OllamaMessage{
+			{Role: "system", Content: o.settings.GetSystemPrompt()},
+			{Role: "user", Content: prompt},
+		},
+		KeepAlive: o.keepAlive,
+		Options:   map[string]interface{}{"num_predict": o.settings.GetMaxTokens()},
+	}
+}
+
+// chat streams a request to /api/chat and returns the assembled message. The
+// request is cancelled if no token arrives within the load timeout, or if the
+// stream stalls for longer than ollamaIdleTimeout after that. The text is passed
+// to the text stream of ctx as it arrives.
+func (o *OllamaProvider) chat(ctx context.Context, request OllamaChatRequest) (*OllamaMessage, error) {
+	request.Stream = true
+	stream := textStreamFrom(ctx)
+
+	jsonData, err := o.redactor.JSON(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	estimatedTokens := llmhttp.EstimateTokens(jsonData)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var stalled atomic.Bool
+	watchdog := time.AfterFunc(o.loadTimeout, func() {
+		stalled.Store(true)
+		cancel()
+	})
+	defer watchdog.Stop()
+
+	start := time.Now()
+	firstToken := true
+	timeoutErr := func() error {
+		if firstToken {
+			return fmt.Errorf("no response from Ollama within %s; the model may still be loading, consider increasing the load timeout or keep-alive: %w", o.loadTimeout, context.DeadlineExceeded)
+		}
+		return fmt.Errorf("Ollama stopped responding for %s while generating: %w", ollamaIdleTimeout, context.DeadlineExceeded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.host+"/api/chat", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req, estimatedTokens)
+	if err != nil {
+		if stalled.Load() {
+			return nil, timeoutErr()
+		}
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		var apiErr OllamaChatResponse
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return nil, &APIError{StatusCode: resp.StatusCode, Body: apiErr.Error}
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	result := &OllamaMessage{Role: "assistant"}
+	var content strings.Builder
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), o.settings.GetMaxMessageSize())
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		if firstToken {
+			firstToken = false
+			o.logger.Debug("Ollama first token received", "model", o.model, "latency", time.Since(start))
+		}
+		watchdog.Reset(ollamaIdleTimeout)
+
+		var chunk OllamaChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("Ollama error: %s", chunk.Error)
+		}
+
+		content.WriteString(chunk.Message.Content)
+		if stream != nil && chunk.Message.Content != "" {
+			stream(chunk.Message.Content)
+		}
+		result.ToolCalls = append(result.ToolCalls, chunk.Message.ToolCalls...)
+
+		if chunk.Done {
+			metrics.ObserveLLMTokens(o.settings.DatasourceUID, "ollama", o.model, chunk.PromptEvalCount, chunk.EvalCount)
+			o.client.ObserveTokens(estimatedTokens, chunk.PromptEvalCount+chunk.EvalCount)
+			result.Content = content.String()
+			return result, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if stalled.Load() {
+			return nil, timeoutErr()
+		}
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return nil, fmt.Errorf("response stream ended before completion")
+}
+
+// toolInputSchema returns the JSON Schema of a tool's input parameters
+func toolInputSchema(tool mcp.Tool) json.RawMessage {
+	if len(tool.RawInputSchema) > 0 {
+		return tool.RawInputSchema
+	}
+	schema, err := json.Marshal(tool.InputSchema)
+	if err != nil || tool.InputSchema.Type == "" {
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return schema
+}
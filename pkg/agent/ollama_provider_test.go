@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+func TestOllamaGenerateResponseStreams(t *testing.T) {
+	var gotRequest OllamaChatRequest
+	server := newLLMServer(t, func(r *http.Request, request OllamaChatRequest) {
+		assert.Equal(t, "/api/chat", r.URL.Path)
+		gotRequest = request
+	}, llmResponse{chunks: []interface{}{
+		OllamaChatResponse{Message: OllamaMessage{Role: "assistant", Content: "Hello"}},
+		OllamaChatResponse{Message: OllamaMessage{Role: "assistant", Content: ", world"}},
+		OllamaChatResponse{Done: true, PromptEvalCount: 12, EvalCount: 3},
+	}})
+
+	provider, err := NewOllamaProvider(models.MCPDataSourceSettings{
+		OllamaHost:      server.URL + "/",
+		LLMModel:        "qwen2.5",
+		OllamaKeepAlive: "-1",
+	})
+	require.NoError(t, err)
+
+	response, err := provider.GenerateResponse(context.Background(), "say hello, password=hunter2")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, world", response)
+
+	assert.Equal(t, "qwen2.5", gotRequest.Model)
+	assert.True(t, gotRequest.Stream)
+	assert.Empty(t, gotRequest.Format)
+	assert.Equal(t, float64(-1), gotRequest.KeepAlive)
+	require.Len(t, gotRequest.Messages, 2)
+	assert.Equal(t, "say hello, password=[REDACTED:secret]", gotRequest.Messages[1].Content)
+}
+
+func TestOllamaGenerateToolCallNative(t *testing.T) {
+	var gotRequest OllamaChatRequest
+	var call OllamaToolCall
+	call.Function.Name = "loki_query"
+	call.Function.Arguments = map[string]interface{}{"query": `{level="error"}`}
+	server := newLLMServer(t, func(_ *http.Request, request OllamaChatRequest) {
+		gotRequest = request
+	}, llmResponse{chunks: []interface{}{
+		OllamaChatResponse{Message: OllamaMessage{Role: "assistant", ToolCalls: []OllamaToolCall{call}}},
+		OllamaChatResponse{Done: true},
+	}})
+
+	provider, err := NewOllamaProvider(models.MCPDataSourceSettings{OllamaHost: server.URL})
+	require.NoError(t, err)
+
+	tools := []mcp.Tool{
+		mcp.NewTool("loki_query", mcp.WithDescription("Query Loki"), mcp.WithString("query", mcp.Required())),
+	}
+	toolCall, err := provider.GenerateToolCall(context.Background(), "show error logs", tools)
+	require.NoError(t, err)
+	require.NotNil(t, toolCall)
+	assert.Equal(t, "loki_query", toolCall.ToolName)
+	assert.Equal(t, `{level="error"}`, toolCall.Arguments["query"])
+
+	require.Len(t, gotRequest.Tools, 1)
+	assert.Equal(t, "loki_query", gotRequest.Tools[0].Function.Name)
+	assert.JSONEq(t, `{"type":"object","properties":{"query":{"type":"string"}},"required":["query"]}`, string(gotRequest.Tools[0].Function.Parameters))
+}
+
+func TestOllamaGenerateToolCallFallsBackWithoutToolSupport(t *testing.T) {
+	var formats []string
+	// The request with tools is rejected, the retry without them succeeds
+	server := newLLMServer(t, func(_ *http.Request, request OllamaChatRequest) {
+		if len(request.Tools) == 0 {
+			formats = append(formats, request.Format)
+		}
+	}, llmResponse{
+		status: http.StatusBadRequest,
+		body:   `{"error":"registry.ollama.ai/library/gemma:2b does not support tools"}`,
+	}, llmResponse{chunks: []interface{}{
+		OllamaChatResponse{Message: OllamaMessage{Content: `{"tool_name": "loki_query", "arguments": {"query": "{job=\"api\"}"}, "reasoning": "logs"}`}},
+		OllamaChatResponse{Done: true},
+	}})
+
+	provider, err := NewOllamaProvider(models.MCPDataSourceSettings{OllamaHost: server.URL, LLMModel: "gemma:2b"})
+	require.NoError(t, err)
+
+	toolCall, err := provider.GenerateToolCall(context.Background(), "api logs", []mcp.Tool{{Name: "loki_query"}})
+	require.NoError(t, err)
+	require.NotNil(t, toolCall)
+	assert.Equal(t, "loki_query", toolCall.ToolName)
+	assert.Equal(t, []string{"json"}, formats)
+}
+
+func TestOllamaFirstTokenTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	provider, err := NewOllamaProvider(models.MCPDataSourceSettings{OllamaHost: server.URL})
+	require.NoError(t, err)
+	provider.loadTimeout = 50 * time.Millisecond
+
+	_, err = provider.GenerateResponse(context.Background(), "ping")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "may still be loading")
+}
+
+func TestOllamaSettings(t *testing.T) {
+	_, err := NewOllamaProvider(models.MCPDataSourceSettings{OllamaHost: "localhost:11434"})
+	assert.Error(t, err)
+
+	_, err = NewOllamaProvider(models.MCPDataSourceSettings{OllamaKeepAlive: "forever"})
+	assert.Error(t, err)
+
+	provider, err := NewOllamaProvider(models.MCPDataSourceSettings{OllamaKeepAlive: "10m"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:11434", provider.host)
+	assert.Equal(t, defaultOllamaModel, provider.model)
+	assert.Equal(t, "10m", provider.keepAlive)
+	assert.Equal(t, 5*time.Minute, provider.loadTimeout)
+}
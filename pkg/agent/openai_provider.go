@@ -1,23 +1,83 @@
 package agent
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
 
+	"grafana-mcpclient-datasource/pkg/llmhttp"
+	"grafana-mcpclient-datasource/pkg/metrics"
 	"grafana-mcpclient-datasource/pkg/models"
-
-	"github.com/mark3labs/mcp-go/mcp"
+	"grafana-mcpclient-datasource/pkg/redact"
 )
 
-// OpenAIProvider implements LLM functionality using OpenAI's API
-// This is a placeholder implementation - actual OpenAI integration would go here
+// defaultOpenAIBaseURL is the base URL of the public OpenAI API
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAIProvider implements LLM functionality using the OpenAI chat completions API.
+// It also serves any OpenAI-compatible endpoint (vLLM, LM Studio, LiteLLM, ...)
+// through a configurable base URL and extra headers, and Azure OpenAI deployments.
 type OpenAIProvider struct {
-	apiKey   string
-	model    string
-	settings models.MCPDataSourceSettings
+	*promptProvider
+	provider  string // registry name, used as the metrics provider label
+	apiKey    string
+	model     string
+	endpoint  string
+	headers   map[string]string
+	authorize func(ctx context.Context, req *http.Request) error
+	settings  models.MCPDataSourceSettings
+	redactor  *redact.Redactor
+	client    *llmhttp.Client
+}
+
+// OpenAIRequest represents the request structure for the chat completions API
+type OpenAIRequest struct {
+	Model     string    `json:"model"`
+	Messages  []Message `json:"messages"`
+	MaxTokens int       `json:"max_tokens,omitempty"`
+
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *OpenAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+// OpenAIStreamOptions asks for token usage in the last chunk of a streamed response
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// OpenAIStreamChunk represents a chunk of a streamed chat completions response
+type OpenAIStreamChunk struct {
+	Choices []OpenAIStreamChoice `json:"choices"`
+	Usage   *OpenAIUsage         `json:"usage,omitempty"`
+}
+
+// OpenAIStreamChoice represents the incremental message of a completion choice
+type OpenAIStreamChoice struct {
+	Delta Message `json:"delta"`
+}
+
+// OpenAIResponse represents the response from the chat completions API
+type OpenAIResponse struct {
+	Choices []OpenAIChoice `json:"choices"`
+	Usage   OpenAIUsage    `json:"usage"`
+}
+
+// OpenAIChoice represents a single completion choice
+type OpenAIChoice struct {
+	Message Message `json:"message"`
+}
+
+// OpenAIUsage represents token usage information
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
 }
 
-// NewOpenAIProvider creates a new OpenAI provider
+// NewOpenAIProvider creates a provider for the public OpenAI API
 func NewOpenAIProvider(settings models.MCPDataSourceSettings) (*OpenAIProvider, error) {
 	if settings.LLMAPIKey == "" {
 		return nil, fmt.Errorf("OpenAI API key is required")
@@ -28,41 +88,172 @@ func NewOpenAIProvider(settings models.MCPDataSourceSettings) (*OpenAIProvider,
 		model = "gpt-4" // Default model
 	}
 
-	return &OpenAIProvider{
+	baseURL := settings.LLMBaseURL
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+
+	return newOpenAIProvider(settings, "openai", "OpenAI", baseURL, model)
+}
+
+// NewOpenAICompatibleProvider creates a provider for a self-hosted or gateway
+// endpoint implementing the OpenAI chat completions API. The API key is optional.
+func NewOpenAICompatibleProvider(settings models.MCPDataSourceSettings) (*OpenAIProvider, error) {
+	if settings.LLMBaseURL == "" {
+		return nil, fmt.Errorf("base URL is required for the OpenAI-compatible provider")
+	}
+	if settings.LLMModel == "" {
+		return nil, fmt.Errorf("model is required for the OpenAI-compatible provider")
+	}
+
+	return newOpenAIProvider(settings, "openai_compatible", "OpenAI-compatible endpoint", settings.LLMBaseURL, settings.LLMModel)
+}
+
+func newOpenAIProvider(settings models.MCPDataSourceSettings, provider, displayName, baseURL, model string) (*OpenAIProvider, error) {
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		return nil, fmt.Errorf("invalid LLM base URL '%s': must start with http:// or https://", baseURL)
+	}
+
+	redactor, err := redact.NewRedactor(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redactor: %w", err)
+	}
+
+	o := &OpenAIProvider{
+		provider: provider,
 		apiKey:   settings.LLMAPIKey,
 		model:    model,
+		endpoint: strings.TrimSuffix(baseURL, "/") + "/chat/completions",
+		headers:  settings.LLMHeaders,
 		settings: settings,
-	}, nil
+		redactor: redactor,
+	}
+	o.client = llmhttp.For(settings, o.endpoint)
+	o.authorize = o.bearerAuth
+	o.promptProvider = &promptProvider{name: displayName, generate: o.GenerateResponse}
+	return o, nil
 }
 
-// GenerateResponse generates a response using OpenAI's API
-func (o *OpenAIProvider) GenerateResponse(ctx context.Context, prompt string) (string, error) {
-	// TODO: Implement actual OpenAI API integration
-	// For now, return an informative error
-	return "", fmt.Errorf("OpenAI provider not yet implemented - please use mock provider for testing")
+// bearerAuth sends the API key, when configured, as a bearer token
+func (o *OpenAIProvider) bearerAuth(_ context.Context, req *http.Request) error {
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+	return nil
 }
 
-// GenerateToolCall generates a tool call using OpenAI GPT
-func (o *OpenAIProvider) GenerateToolCall(ctx context.Context, query string, tools []mcp.Tool) (*ToolCall, error) {
-	// TODO: Implement actual OpenAI API integration for tool calls
-	// For now, return an informative error
-	return nil, fmt.Errorf("OpenAI provider not yet implemented - please use 'anthropic' or 'mock' provider")
+// GenerateResponse generates a response using the chat completions API
+func (o *OpenAIProvider) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+	messages := make([]Message, 0, 2)
+	if systemPrompt := o.settings.GetSystemPrompt(); systemPrompt != "" {
+		messages = append(messages, Message{Role: "system", Content: systemPrompt})
+	}
+	messages = append(messages, Message{Role: "user", Content: prompt})
+
+	request := OpenAIRequest{
+		Model:     o.model,
+		Messages:  messages,
+		MaxTokens: o.settings.GetMaxTokens(),
+	}
+
+	return o.makeRequest(ctx, request)
 }
 
-// GenerateStructuredResults generates structured data from tool results
-func (o *OpenAIProvider) GenerateStructuredResults(ctx context.Context, query string, toolResults []ToolResult) (*StructuredQueryResult, error) {
-	// TODO: Implement actual OpenAI API integration for structured results
-	// For now, return an error response
-	return &StructuredQueryResult{
-		Query:    query,
-		Success:  false,
-		ErrorMsg: "OpenAI provider not yet implemented - please use 'anthropic' or 'mock' provider",
-	}, nil
+// makeRequest makes an HTTP request to the chat completions endpoint
+func (o *OpenAIProvider) makeRequest(ctx context.Context, request OpenAIRequest) (string, error) {
+	// Stream the response when its text is shown to the user while it is generated
+	stream := textStreamFrom(ctx)
+	if stream != nil {
+		request.Stream = true
+		request.StreamOptions = &OpenAIStreamOptions{IncludeUsage: true}
+	}
+
+	jsonData, err := o.redactor.JSON(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+	estimatedTokens := llmhttp.EstimateTokens(jsonData)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range o.headers {
+		req.Header.Set(name, value)
+	}
+	if err := o.authorize(ctx, req); err != nil {
+		return "", fmt.Errorf("failed to authorize request: %w", err)
+	}
+
+	resp, err := o.client.Do(req, estimatedTokens)
+	if err != nil {
+		return "", fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if request.Stream && resp.StatusCode == http.StatusOK {
+		return o.readStream(resp.Body, estimatedTokens, stream)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var response OpenAIResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	metrics.ObserveLLMTokens(o.settings.DatasourceUID, o.provider, o.model, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+	o.client.ObserveTokens(estimatedTokens, response.Usage.PromptTokens+response.Usage.CompletionTokens)
+
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+
+	return response.Choices[0].Message.Content, nil
 }
 
-// FixQuerySyntax generates a corrected tool call based on syntax error feedback
-func (o *OpenAIProvider) FixQuerySyntax(ctx context.Context, originalQuery string, toolName string, errorMessage string, tools []mcp.Tool) (*ToolCall, error) {
-	// TODO: Implement actual OpenAI API integration for syntax fixing
-	// For now, return an error
-	return nil, fmt.Errorf("OpenAI provider not yet implemented - please use 'anthropic' or 'mock' provider")
+// readStream reads a streamed response, passing every piece of text to stream
+func (o *OpenAIProvider) readStream(body io.Reader, estimatedTokens int, stream func(text string)) (string, error) {
+	var text strings.Builder
+	var usage OpenAIUsage
+
+	err := readSSE(body, o.settings.GetMaxMessageSize(), func(_ string, data []byte) error {
+		if string(data) == "[DONE]" {
+			return nil
+		}
+
+		var chunk OpenAIStreamChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to parse stream chunk: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = *chunk.Usage
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			text.WriteString(chunk.Choices[0].Delta.Content)
+			stream(chunk.Choices[0].Delta.Content)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	metrics.ObserveLLMTokens(o.settings.DatasourceUID, o.provider, o.model, usage.PromptTokens, usage.CompletionTokens)
+	o.client.ObserveTokens(estimatedTokens, usage.PromptTokens+usage.CompletionTokens)
+
+	if text.Len() == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+
+	return text.String(), nil
 }
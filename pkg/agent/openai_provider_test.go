@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+func TestOpenAICompatibleGenerateResponse(t *testing.T) {
+	var gotPath, gotAuth, gotHeader string
+	var gotRequest OpenAIRequest
+	server := newLLMServer(t, func(r *http.Request, request OpenAIRequest) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		gotHeader = r.Header.Get("X-Gateway-Team")
+		gotRequest = request
+	}, chatCompletion("hello"))
+
+	provider, err := NewOpenAICompatibleProvider(models.MCPDataSourceSettings{
+		LLMBaseURL:   server.URL + "/v1/",
+		LLMModel:     "llama-3-8b",
+		LLMAPIKey:    "local-key",
+		LLMHeaders:   map[string]string{"X-Gateway-Team": "observability"},
+		SystemPrompt: "Be brief.",
+	})
+	require.NoError(t, err)
+
+	response, err := provider.GenerateResponse(context.Background(), "log in with password=hunter2")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", response)
+
+	assert.Equal(t, "/v1/chat/completions", gotPath)
+	assert.Equal(t, "Bearer local-key", gotAuth)
+	assert.Equal(t, "observability", gotHeader)
+	assert.Equal(t, "llama-3-8b", gotRequest.Model)
+	require.Len(t, gotRequest.Messages, 2)
+	assert.Equal(t, Message{Role: "system", Content: "Be brief."}, gotRequest.Messages[0])
+	assert.Equal(t, Message{Role: "user", Content: "log in with password=[REDACTED:secret]"}, gotRequest.Messages[1])
+}
+
+func TestOpenAICompatibleWithoutAPIKey(t *testing.T) {
+	var gotAuth string
+	server := newLLMServer(t, func(r *http.Request, _ OpenAIRequest) {
+		gotAuth = r.Header.Get("Authorization")
+	}, chatCompletion("ok"))
+
+	provider, err := NewOpenAICompatibleProvider(models.MCPDataSourceSettings{LLMBaseURL: server.URL, LLMModel: "local"})
+	require.NoError(t, err)
+
+	_, err = provider.GenerateResponse(context.Background(), "ping")
+	require.NoError(t, err)
+	assert.Empty(t, gotAuth)
+}
+
+func TestOpenAICompatibleGenerateToolCall(t *testing.T) {
+	server := newLLMServer[OpenAIRequest](t, nil, chatCompletion("```json\n{\"tool_name\": \"loki_query\", \"arguments\": {\"query\": \"{level=\\\"error\\\"}\"}, \"reasoning\": \"logs\"}\n```"))
+
+	provider, err := NewOpenAICompatibleProvider(models.MCPDataSourceSettings{LLMBaseURL: server.URL, LLMModel: "local"})
+	require.NoError(t, err)
+
+	toolCall, err := provider.GenerateToolCall(context.Background(), "show error logs", []mcp.Tool{{Name: "loki_query"}})
+	require.NoError(t, err)
+	require.NotNil(t, toolCall)
+	assert.Equal(t, "loki_query", toolCall.ToolName)
+	assert.Equal(t, `{level="error"}`, toolCall.Arguments["query"])
+}
+
+func TestOpenAICompatibleErrorStatus(t *testing.T) {
+	server := newLLMServer[OpenAIRequest](t, nil, llmResponse{status: http.StatusServiceUnavailable, body: "model not loaded"})
+
+	provider, err := NewOpenAICompatibleProvider(models.MCPDataSourceSettings{LLMBaseURL: server.URL, LLMModel: "local", LLMMaxRetries: -1})
+	require.NoError(t, err)
+
+	_, err = provider.GenerateResponse(context.Background(), "ping")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+}
+
+func TestOpenAIProviderSettings(t *testing.T) {
+	_, err := NewOpenAIProvider(models.MCPDataSourceSettings{})
+	assert.Error(t, err, "API key is required for the public API")
+
+	_, err = NewOpenAICompatibleProvider(models.MCPDataSourceSettings{LLMModel: "local"})
+	assert.Error(t, err, "base URL is required")
+
+	_, err = NewOpenAICompatibleProvider(models.MCPDataSourceSettings{LLMBaseURL: "localhost:8000", LLMModel: "local"})
+	assert.Error(t, err, "base URL must include a scheme")
+
+	provider, err := NewOpenAIProvider(models.MCPDataSourceSettings{LLMAPIKey: "key"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.openai.com/v1/chat/completions", provider.endpoint)
+	assert.Equal(t, "gpt-4", provider.model)
+}
+
+func TestCreateLLMProvider(t *testing.T) {
+	provider, err := createLLMProvider(models.MCPDataSourceSettings{})
+	require.NoError(t, err)
+	assert.IsType(t, &MockProvider{}, provider)
+
+	provider, err = createLLMProvider(models.MCPDataSourceSettings{LLMProvider: "OpenAI_Compatible", LLMBaseURL: "http://localhost:1234/v1", LLMModel: "local"})
+	require.NoError(t, err)
+	assert.IsType(t, &OpenAIProvider{}, provider)
+
+	_, err = createLLMProvider(models.MCPDataSourceSettings{LLMProvider: "unknown"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "openai_compatible")
+}
+
+func TestRegisterProvider(t *testing.T) {
+	RegisterProvider("test_custom", func(settings models.MCPDataSourceSettings) (LLMProvider, error) {
+		return NewMockProvider(settings), nil
+	})
+	t.Cleanup(func() {
+		providersMu.Lock()
+		delete(providers, "test_custom")
+		providersMu.Unlock()
+	})
+
+	assert.Contains(t, RegisteredProviders(), "test_custom")
+	provider, err := createLLMProvider(models.MCPDataSourceSettings{LLMProvider: "test_custom"})
+	require.NoError(t, err)
+	assert.NotNil(t, provider)
+}
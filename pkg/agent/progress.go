@@ -0,0 +1,201 @@
+package agent
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"grafana-mcpclient-datasource/pkg/toolprogress"
+)
+
+// Progress stages reported while a query is processed
+const (
+	StageSelectingTool      = "selecting_tool"
+	StageGeneratingArgs     = "generating_arguments"
+	StageCallingTool        = "calling_tool"
+	StageToolProgress       = "tool_progress"
+	StageToolLog            = "tool_log"
+	StageFixingSyntax       = "fixing_syntax"
+	StageStructuringResults = "structuring"
+	StageText               = "text"
+	StageDone               = "done"
+)
+
+// ProgressEvent is a progress update of a running query. Text events carry the next
+// piece of the streamed summary in Text. Tool progress and log events relay the
+// notifications the MCP server sends while a tool is running.
+type ProgressEvent struct {
+	Stage    string  `json:"stage"`
+	Message  string  `json:"message,omitempty"`
+	Tool     string  `json:"tool,omitempty"`
+	Attempt  int     `json:"attempt,omitempty"`
+	Text     string  `json:"text,omitempty"`
+	Progress float64 `json:"progress,omitempty"`
+	Total    float64 `json:"total,omitempty"`
+	Level    string  `json:"level,omitempty"`
+}
+
+// ProgressFunc receives the progress events of a query. It is called from the
+// goroutine processing the query, or from the MCP client while a tool is running,
+// and must not block.
+type ProgressFunc func(event ProgressEvent)
+
+type progressKey struct{}
+
+type textStreamKey struct{}
+
+// WithProgress returns a context whose queries report their progress to fn. LLM
+// providers stream their responses while a progress function is set.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// reportProgress sends event to the progress function of ctx, if any
+func reportProgress(ctx context.Context, event ProgressEvent) {
+	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && fn != nil {
+		fn(event)
+	}
+}
+
+// ToolProgressEvent returns the progress event relaying an update of a running tool
+func ToolProgressEvent(tool string, update toolprogress.Update) ProgressEvent {
+	event := ProgressEvent{
+		Stage:    StageToolProgress,
+		Tool:     tool,
+		Message:  tool + ": " + update.String(),
+		Progress: update.Progress,
+		Total:    update.Total,
+	}
+	if update.Kind == toolprogress.KindLog {
+		event.Stage = StageToolLog
+		event.Level = update.Level
+		event.Progress, event.Total = 0, 0
+	}
+	return event
+}
+
+// withTextStream marks the LLM calls made with the returned context as ones whose
+// text is shown to the user: providers stream the response and pass every piece
+// of text to stream. It is a no-op without a progress function.
+func withTextStream(ctx context.Context, stream func(text string)) context.Context {
+	if _, ok := ctx.Value(progressKey{}).(ProgressFunc); !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, textStreamKey{}, stream)
+}
+
+// textStreamFrom returns the text stream of ctx, or nil when the response is not streamed
+func textStreamFrom(ctx context.Context) func(text string) {
+	stream, _ := ctx.Value(textStreamKey{}).(func(text string))
+	return stream
+}
+
+// streamSummaryText streams the response of a summary prompt as text progress events
+func streamSummaryText(ctx context.Context) context.Context {
+	return withTextStream(ctx, func(text string) {
+		reportProgress(ctx, ProgressEvent{Stage: StageText, Text: text})
+	})
+}
+
+// streamSummaryField streams the string value of the "summary" field of a JSON
+// response as text progress events while the rest of the JSON arrives
+func streamSummaryField(ctx context.Context) context.Context {
+	field := &jsonFieldStreamer{field: "summary", emit: func(text string) {
+		reportProgress(ctx, ProgressEvent{Stage: StageText, Text: text})
+	}}
+	return withTextStream(ctx, field.write)
+}
+
+// jsonEscapes maps the JSON escape characters that do not stand for themselves
+var jsonEscapes = map[byte]string{'n': "\n", 't': "\t", 'r': "\r", 'b': "\b", 'f': "\f"}
+
+// jsonFieldStreamer extracts the value of a top-level string field from JSON that
+// arrives in pieces, emitting the decoded value as soon as it is available
+type jsonFieldStreamer struct {
+	field string
+	emit  func(text string)
+
+	buf        strings.Builder
+	searchFrom int // offset in buf to look for the field from
+	start      int // offset of the field value in buf, 0 until the field is found
+	emitted    int // offset in buf up to which the value was emitted
+	done       bool
+}
+
+func (s *jsonFieldStreamer) write(text string) {
+	if s.done {
+		return
+	}
+	s.buf.WriteString(text)
+	raw := s.buf.String()
+
+	// Find the field as an object key with a string value, skipping other occurrences
+	for s.start == 0 {
+		key := strings.Index(raw[s.searchFrom:], `"`+s.field+`"`)
+		if key < 0 {
+			return
+		}
+		key += s.searchFrom
+		rest := strings.TrimLeft(raw[key+len(s.field)+2:], " \t\r\n")
+		if rest == "" {
+			return
+		}
+		if rest[0] == ':' {
+			rest = strings.TrimLeft(rest[1:], " \t\r\n")
+			if rest == "" {
+				return
+			}
+			if rest[0] == '"' {
+				s.start = len(raw) - len(rest) + 1
+				s.emitted = s.start
+				break
+			}
+		}
+		s.searchFrom = key + 1
+	}
+
+	var out strings.Builder
+	i := s.emitted
+decode:
+	for i < len(raw) {
+		switch c := raw[i]; {
+		case c == '"':
+			s.done = true
+			break decode
+		case c == '\\':
+			// Wait for the whole escape sequence before decoding it
+			if i+1 >= len(raw) {
+				break decode
+			}
+			if raw[i+1] == 'u' {
+				if i+6 > len(raw) {
+					break decode
+				}
+				if r, err := strconv.ParseUint(raw[i+2:i+6], 16, 32); err == nil {
+					out.WriteRune(rune(r))
+				}
+				i += 6
+				continue
+			}
+			if unescaped, ok := jsonEscapes[raw[i+1]]; ok {
+				out.WriteString(unescaped)
+			} else {
+				out.WriteByte(raw[i+1])
+			}
+			i += 2
+		default:
+			if !utf8.FullRuneInString(raw[i:]) {
+				break decode
+			}
+			_, size := utf8.DecodeRuneInString(raw[i:])
+			out.WriteString(raw[i : i+size])
+			i += size
+		}
+	}
+	s.emitted = i
+
+	if out.Len() > 0 {
+		s.emit(out.String())
+	}
+}
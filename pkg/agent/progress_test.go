@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+// collectProgress returns a context that records progress events, and the recorded events
+func collectProgress() (context.Context, *[]ProgressEvent) {
+	var events []ProgressEvent
+	ctx := WithProgress(context.Background(), func(event ProgressEvent) {
+		events = append(events, event)
+	})
+	return ctx, &events
+}
+
+// streamedText joins the text of the text events
+func streamedText(events []ProgressEvent) string {
+	var text strings.Builder
+	for _, event := range events {
+		if event.Stage == StageText {
+			text.WriteString(event.Text)
+		}
+	}
+	return text.String()
+}
+
+func TestJSONFieldStreamer(t *testing.T) {
+	response := `{"data": [{"summary": 1}], "summary": "Errors \"spiked\"\nat 10:00 — caf` + "é" + `", "success": true}`
+
+	// Feed the response in every possible piece size, splitting escapes and runes
+	for size := 1; size <= 8; size++ {
+		var got strings.Builder
+		streamer := &jsonFieldStreamer{field: "summary", emit: func(text string) { got.WriteString(text) }}
+		for i := 0; i < len(response); i += size {
+			streamer.write(response[i:min(i+size, len(response))])
+		}
+		assert.Equal(t, "Errors \"spiked\"\nat 10:00 — café", got.String(), "piece size %d", size)
+	}
+}
+
+func TestReadSSE(t *testing.T) {
+	stream := ": keep-alive\n\nevent: ping\ndata: {}\n\ndata: first\ndata: second\n\ndata:[DONE]\n"
+
+	var events []string
+	err := readSSE(strings.NewReader(stream), 1024, func(event string, data []byte) error {
+		events = append(events, event+"|"+string(data))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ping|{}", "|first\nsecond", "|[DONE]"}, events)
+}
+
+func TestAnthropicStreamsSummary(t *testing.T) {
+	var gotStream bool
+	server := newLLMServer(t, func(_ *http.Request, request AnthropicRequest) {
+		gotStream = request.Stream
+	}, llmResponse{events: []string{
+		`event: message_start` + "\n" + `data: {"type":"message_start","message":{"content":[],"usage":{"input_tokens":25,"output_tokens":1}}}`,
+		`event: content_block_delta` + "\n" + `data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"3 services"}}`,
+		`event: content_block_delta` + "\n" + `data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" are down."}}`,
+		`event: message_delta` + "\n" + `data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":6}}`,
+		`event: message_stop` + "\n" + `data: {"type":"message_stop"}`,
+	}})
+
+	provider, err := NewAnthropicProvider(models.MCPDataSourceSettings{LLMAPIKey: "key"})
+	require.NoError(t, err)
+	provider.baseURL = server.URL
+
+	ctx, events := collectProgress()
+	response, err := provider.GenerateResponse(streamSummaryText(ctx), "summarize")
+	require.NoError(t, err)
+	assert.True(t, gotStream)
+	assert.Equal(t, "3 services are down.", response)
+	assert.Equal(t, "3 services are down.", streamedText(*events))
+}
+
+func TestAnthropicStreamOverloaded(t *testing.T) {
+	server := newLLMServer[AnthropicRequest](t, nil, llmResponse{events: []string{
+		`event: error` + "\n" + `data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+	}})
+
+	provider, err := NewAnthropicProvider(models.MCPDataSourceSettings{LLMAPIKey: "key"})
+	require.NoError(t, err)
+	provider.baseURL = server.URL
+
+	ctx, _ := collectProgress()
+	_, err = provider.GenerateResponse(streamSummaryText(ctx), "summarize")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 529, apiErr.StatusCode, "overloaded streams fall back like 529 responses")
+}
+
+func TestOpenAIStreamsSummaryField(t *testing.T) {
+	var gotRequest OpenAIRequest
+	server := newLLMServer(t, func(_ *http.Request, request OpenAIRequest) {
+		gotRequest = request
+	}, llmResponse{events: []string{
+		`data: {"choices":[{"delta":{"role":"assistant","content":"{\"data\": [], \"sum"}}]}`,
+		`data: {"choices":[{"delta":{"content":"mary\": \"No err"}}]}`,
+		`data: {"choices":[{"delta":{"content":"ors\", \"success\": true}"}}]}`,
+		`data: {"choices":[],"usage":{"prompt_tokens":40,"completion_tokens":12}}`,
+		`data: [DONE]`,
+	}})
+
+	provider, err := NewOpenAICompatibleProvider(models.MCPDataSourceSettings{LLMBaseURL: server.URL, LLMModel: "local"})
+	require.NoError(t, err)
+
+	ctx, events := collectProgress()
+	response, err := provider.GenerateResponse(streamSummaryField(ctx), "structure")
+	require.NoError(t, err)
+	assert.True(t, gotRequest.Stream)
+	require.NotNil(t, gotRequest.StreamOptions)
+	assert.True(t, gotRequest.StreamOptions.IncludeUsage)
+	assert.Equal(t, `{"data": [], "summary": "No errors", "success": true}`, response)
+	assert.Equal(t, "No errors", streamedText(*events))
+}
+
+func TestProvidersDoNotStreamWithoutProgress(t *testing.T) {
+	var gotRequest OpenAIRequest
+	server := newLLMServer(t, func(_ *http.Request, request OpenAIRequest) {
+		gotRequest = request
+	}, chatCompletion("hello"))
+
+	provider, err := NewOpenAICompatibleProvider(models.MCPDataSourceSettings{LLMBaseURL: server.URL, LLMModel: "local"})
+	require.NoError(t, err)
+
+	response, err := provider.GenerateResponse(streamSummaryText(context.Background()), "summarize")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", response)
+	assert.False(t, gotRequest.Stream)
+}
@@ -0,0 +1,351 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"grafana-mcpclient-datasource/pkg/structuring"
+)
+
+// promptProvider implements the tool selection, structuring and syntax fixing
+// steps of LLMProvider with plain-text prompts on top of a single completion
+// function. Providers embed it and only implement GenerateResponse.
+type promptProvider struct {
+	name     string // provider name used in error messages
+	generate func(ctx context.Context, prompt string) (string, error)
+	// generateJSON, when set, is used for GenerateStructuredResults so providers
+	// can enable a JSON response mode for it
+	generateJSON func(ctx context.Context, prompt string) (string, error)
+}
+
+// GenerateToolCall asks the LLM which tool to call
+func (p *promptProvider) GenerateToolCall(ctx context.Context, query string, tools []mcp.Tool) (*ToolCall, error) {
+	// Format tools for the prompt
+	toolsDesc := make([]string, len(tools))
+	for i, tool := range tools {
+		toolsDesc[i] = fmt.Sprintf("- %s: %s", tool.Name, tool.Description)
+	}
+	toolsText := strings.Join(toolsDesc, "\n")
+
+	prompt := fmt.Sprintf(`You are an intelligent agent that selects appropriate tools to answer user queries.
+
+User Query: %s
+
+Available Tools:
+%s
+
+Please analyze the query and determine if any tools should be called. If a tool should be called, respond with a JSON object in this exact format:
+{
+  "tool_name": "name_of_tool",
+  "arguments": {"key": "value"},
+  "reasoning": "explanation of why this tool was chosen"
+}
+
+If no tools are needed, respond with: {"no_tool_needed": true}
+
+For log-related queries, use these LogQL patterns:
+- Error logs: {level="error"}
+- Warning logs: {level="warn"}
+- All logs: {job=~".+"}
+- Specific service: {service="myservice"}
+
+Response:`, query, toolsText)
+
+	response, err := p.generate(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tool selection from %s: %w", p.name, err)
+	}
+
+	// Parse the JSON response
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(response), &result); err != nil {
+		// If JSON parsing fails, try to extract JSON from the response
+		start := strings.Index(response, "{")
+		end := strings.LastIndex(response, "}") + 1
+		if start >= 0 && end > start {
+			jsonStr := response[start:end]
+			if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
+				return nil, fmt.Errorf("failed to parse tool selection response: %w", err)
+			}
+		} else {
+			return nil, fmt.Errorf("no valid JSON found in response: %s", response)
+		}
+	}
+
+	// Check if no tool is needed
+	if noTool, exists := result["no_tool_needed"]; exists && noTool == true {
+		return nil, nil
+	}
+
+	// Extract tool call information
+	toolName, ok := result["tool_name"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid tool_name in response")
+	}
+
+	reasoning, _ := result["reasoning"].(string)
+	arguments, _ := result["arguments"].(map[string]interface{})
+	if arguments == nil {
+		arguments = make(map[string]interface{})
+	}
+
+	return &ToolCall{
+		ToolName:  toolName,
+		Arguments: arguments,
+		Reasoning: reasoning,
+	}, nil
+}
+
+// GenerateStructuredResults generates structured data from tool results the
+// structuring engine could not parse. The LLM is shown a sample of the results
+// and asked how to extract rows from them, which is then applied locally to the
+// complete results, so no value in the table comes from the LLM.
+func (p *promptProvider) GenerateStructuredResults(ctx context.Context, query string, toolResults []ToolResult) (*StructuredQueryResult, error) {
+	const (
+		maxResultLength = 2000 // Max characters per result to send to LLM
+		maxSampleLines  = 10   // Max lines to sample from large results
+	)
+
+	// Prepare samples of the results for the LLM
+	toolSummaries := make([]string, 0, len(toolResults))
+	var outputs []structuring.Output
+	var errorMsgs []string
+
+	for _, result := range toolResults {
+		if !result.Success {
+			errorMsgs = append(errorMsgs, fmt.Sprintf("%s: %s", result.ToolName, result.Error))
+			continue
+		}
+
+		dataStr, ok := result.Data.(string)
+		if !ok || strings.TrimSpace(dataStr) == "" {
+			continue
+		}
+		outputs = append(outputs, structuring.Output{Tool: result.ToolName, Text: dataStr})
+
+		// If result is small, include it fully
+		if len(dataStr) <= maxResultLength {
+			toolSummaries = append(toolSummaries, fmt.Sprintf("Tool: %s\nResult: %s", result.ToolName, dataStr))
+			continue
+		}
+
+		// For large results, create a summary
+		summary := p.summarizeResult(dataStr, maxSampleLines)
+		toolSummaries = append(toolSummaries, fmt.Sprintf("Tool: %s\nResult Summary (truncated from %d chars):\n%s",
+			result.ToolName, len(dataStr), summary))
+	}
+
+	// Without data there is nothing to map, and the errors speak for themselves
+	if len(outputs) == 0 {
+		result := &StructuredQueryResult{
+			Query:   query,
+			Success: len(errorMsgs) == 0,
+			Data:    []map[string]interface{}{},
+			Columns: []string{},
+			Summary: "No data returned",
+			Metadata: map[string]interface{}{
+				"tool_count":    len(toolResults),
+				"processed_at":  time.Now(),
+				"local_parsing": true,
+			},
+		}
+		if !result.Success {
+			result.ErrorMsg = strings.Join(errorMsgs, "; ")
+			result.Summary = result.ErrorMsg
+		}
+		return result, nil
+	}
+
+	toolResultsStr := strings.Join(toolSummaries, "\n\n")
+
+	prompt := fmt.Sprintf(`You are a data analyst preparing tool output for a table in Grafana. The user asked: "%s"
+
+Tool execution results (may be summarized for large datasets):
+%s
+
+The results are in a format that could not be parsed automatically. Do NOT copy any values from them. Instead, describe how to extract rows from the text; your description is applied by a program to the complete results.
+
+Your response MUST be a valid JSON object with this exact structure:
+{
+  "pattern": "",
+  "delimiter": "",
+  "columns": [],
+  "skip_lines": 0,
+  "summary": "Brief summary of the findings"
+}
+
+Use either:
+- "pattern": a regular expression in RE2 syntax with named groups, e.g. "^(?P<timestamp>\\S+) (?P<level>\\w+) (?P<message>.*)$". It is matched against each line; every named group becomes a column and lines that do not match are skipped.
+- "delimiter": the separator of the cells on each line, or "whitespace" for runs of spaces. "columns" names the cells; leave it empty when the first line is a header.
+
+"skip_lines" is the number of lines before the first row or header, e.g. a title.
+For log queries, use columns like: timestamp, level, message, service.
+Note: Some results may be truncated due to size limits. Focus on the structure and patterns shown.
+
+JSON Response:`, query, toolResultsStr)
+
+	generate := p.generate
+	if p.generateJSON != nil {
+		generate = p.generateJSON
+	}
+	response, err := generate(ctx, prompt)
+	if err != nil {
+		// Returned as an error so a fallback provider can be tried
+		return nil, err
+	}
+
+	// Parse the JSON response
+	var spec structuring.Spec
+
+	if fence := strings.Index(response, "```json"); fence >= 0 {
+		response = response[fence+7:]
+	}
+
+	// Try to extract JSON from response if it's wrapped in markdown or other text
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}") + 1
+	if start < 0 || end <= start {
+		return &StructuredQueryResult{
+			Query:    query,
+			Success:  false,
+			ErrorMsg: "No valid JSON found in LLM response",
+		}, nil
+	}
+	if err := json.Unmarshal([]byte(response[start:end]), &spec); err != nil {
+		return &StructuredQueryResult{
+			Query:    query,
+			Success:  false,
+			ErrorMsg: fmt.Sprintf("Failed to parse structuring spec: %v", err),
+		}, nil
+	}
+
+	// The agent structures the result of a single tool call; the results of
+	// several are extracted as one text
+	texts := make([]string, len(outputs))
+	for i, output := range outputs {
+		texts[i] = output.Text
+	}
+	output := structuring.Output{Tool: outputs[0].Tool, Text: strings.Join(texts, "\n")}
+	result := structuredResult(query, structuring.ApplySpec(&spec, output))
+	result.Metadata["tool_count"] = len(toolResults)
+	result.Metadata["arguments"] = toolResults[0].Arguments
+	result.Metadata["tool_name"] = toolResults[0].ToolName
+
+	return result, nil
+}
+
+// summarizeResult creates a summary of large result data
+func (p *promptProvider) summarizeResult(dataStr string, maxLines int) string {
+	lines := strings.Split(dataStr, "\n")
+
+	if len(lines) <= maxLines {
+		return dataStr
+	}
+
+	// Take first few lines and last few lines
+	takeFirst := maxLines / 2
+	takeLast := maxLines - takeFirst
+
+	summary := strings.Builder{}
+
+	// First lines
+	for i := 0; i < takeFirst && i < len(lines); i++ {
+		summary.WriteString(lines[i])
+		summary.WriteString("\n")
+	}
+
+	// Truncation indicator
+	summary.WriteString(fmt.Sprintf("... [%d lines omitted] ...\n", len(lines)-maxLines))
+
+	// Last lines
+	startLast := len(lines) - takeLast
+	if startLast < takeFirst {
+		startLast = takeFirst
+	}
+
+	for i := startLast; i < len(lines); i++ {
+		summary.WriteString(lines[i])
+		summary.WriteString("\n")
+	}
+
+	return summary.String()
+}
+
+// FixQuerySyntax generates a corrected tool call based on syntax error feedback
+func (p *promptProvider) FixQuerySyntax(ctx context.Context, originalQuery string, toolName string, errorMessage string, tools []mcp.Tool) (*ToolCall, error) {
+	// Format tools for the prompt
+	toolsDesc := make([]string, len(tools))
+	for i, tool := range tools {
+		toolsDesc[i] = fmt.Sprintf("- %s: %s", tool.Name, tool.Description)
+	}
+	toolsText := strings.Join(toolsDesc, "\n")
+
+	prompt := fmt.Sprintf(`You are an intelligent agent that fixes query syntax errors.
+
+Original User Query: %s
+Tool Used: %s
+Error Message: %s
+
+Available Tools:
+%s
+
+The previous query failed with a syntax error. Please analyze the error and generate a corrected tool call.
+
+For LogQL queries, common syntax errors include:
+- Missing quotes around label values
+- Incorrect time range syntax (use [1h], [5m], etc.)
+- Invalid label selectors
+- Missing braces around selectors
+
+Please respond with a JSON object in this exact format:
+{
+  "tool_name": "%s",
+  "arguments": {"key": "value"},
+  "reasoning": "explanation of the fix applied"
+}
+
+Corrected JSON Response:`, originalQuery, toolName, errorMessage, toolsText, toolName)
+
+	response, err := p.generate(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get syntax fix from %s: %w", p.name, err)
+	}
+
+	// Parse the JSON response
+	var result map[string]interface{}
+
+	// Try to extract JSON from response if it's wrapped in markdown or other text
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}") + 1
+	if start >= 0 && end > start {
+		jsonStr := response[start:end]
+		if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
+			return nil, fmt.Errorf("failed to parse syntax fix response: %w", err)
+		}
+	} else {
+		return nil, fmt.Errorf("no valid JSON found in syntax fix response: %s", response)
+	}
+
+	// Extract tool call information
+	fixedToolName, ok := result["tool_name"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid tool_name in syntax fix response")
+	}
+
+	reasoning, _ := result["reasoning"].(string)
+	arguments, _ := result["arguments"].(map[string]interface{})
+	if arguments == nil {
+		arguments = make(map[string]interface{})
+	}
+
+	return &ToolCall{
+		ToolName:  fixedToolName,
+		Arguments: arguments,
+		Reasoning: reasoning,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+// ProviderFactory creates an LLM provider from the datasource settings
+type ProviderFactory func(settings models.MCPDataSourceSettings) (LLMProvider, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]ProviderFactory)
+)
+
+func init() {
+	RegisterProvider("mock", func(settings models.MCPDataSourceSettings) (LLMProvider, error) {
+		return NewMockProvider(settings), nil
+	})
+	RegisterProvider("anthropic", func(settings models.MCPDataSourceSettings) (LLMProvider, error) {
+		return NewAnthropicProvider(settings)
+	})
+	RegisterProvider("openai", func(settings models.MCPDataSourceSettings) (LLMProvider, error) {
+		return NewOpenAIProvider(settings)
+	})
+	RegisterProvider("azure", func(settings models.MCPDataSourceSettings) (LLMProvider, error) {
+		return NewAzureOpenAIProvider(settings)
+	})
+	RegisterProvider("gemini", func(settings models.MCPDataSourceSettings) (LLMProvider, error) {
+		return NewGeminiProvider(settings)
+	})
+	RegisterProvider("ollama", func(settings models.MCPDataSourceSettings) (LLMProvider, error) {
+		return NewOllamaProvider(settings)
+	})
+	RegisterProvider("openai_compatible", func(settings models.MCPDataSourceSettings) (LLMProvider, error) {
+		return NewOpenAICompatibleProvider(settings)
+	})
+}
+
+// RegisterProvider makes an LLM provider available under name (case-insensitive),
+// replacing any provider previously registered with that name
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[strings.ToLower(name)] = factory
+}
+
+// RegisteredProviders returns the names of all registered providers, sorted
+func RegisteredProviders() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// createLLMProvider creates the LLM provider registered under settings.LLMProvider.
+// The mock provider is used when no provider is configured.
+func createLLMProvider(settings models.MCPDataSourceSettings) (LLMProvider, error) {
+	name := strings.ToLower(settings.LLMProvider)
+	if name == "" {
+		name = "mock"
+	}
+
+	providersMu.RLock()
+	factory, ok := providers[name]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported LLM provider: %s (supported: %s)", settings.LLMProvider, strings.Join(RegisteredProviders(), ", "))
+	}
+
+	return factory(settings)
+}
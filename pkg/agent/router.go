@@ -0,0 +1,250 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"grafana-mcpclient-datasource/pkg/llmhttp"
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+// Agent tasks that can be routed to their own model
+const (
+	TaskResponse    = "response"
+	TaskToolCall    = "tool_call"
+	TaskSyntaxFix   = "syntax_fix"
+	TaskStructuring = "structuring"
+)
+
+// APIError is returned by providers when the LLM API responds with a non-success status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// isFallbackError reports whether err is worth retrying with the next provider in
+// the chain: rate limiting (429), server errors (5xx), timeouts and hosts whose
+// circuit breaker is open. Nothing is retried once the query context itself is done.
+func isFallbackError(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, llmhttp.ErrCircuitOpen) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// routedProvider implements LLMProvider over an ordered chain of providers per task.
+// Each task starts with the primary provider (using the task's model when one is
+// configured) and falls back to the configured fallback providers in order.
+type routedProvider struct {
+	chains         map[string][]routeEntry
+	attemptTimeout time.Duration
+	logger         log.Logger
+
+	mu           sync.Mutex
+	used         map[string]string
+	fallbackUsed bool
+}
+
+// routeEntry is a provider in a chain, labelled "provider" or "provider/model"
+type routeEntry struct {
+	label    string
+	provider LLMProvider
+}
+
+// newRoutedProvider creates the provider chains for every task from the settings
+func newRoutedProvider(settings models.MCPDataSourceSettings) (*routedProvider, error) {
+	r := &routedProvider{
+		chains:         make(map[string][]routeEntry),
+		attemptTimeout: settings.GetLLMAttemptTimeout(),
+		logger:         log.DefaultLogger,
+		used:           make(map[string]string),
+	}
+
+	// Providers are shared between tasks that use the same provider and model
+	created := make(map[string]LLMProvider)
+	entry := func(providerSettings models.MCPDataSourceSettings) (routeEntry, error) {
+		label := providerLabel(providerSettings)
+		if provider, ok := created[label]; ok {
+			return routeEntry{label: label, provider: provider}, nil
+		}
+		provider, err := createLLMProvider(providerSettings)
+		if err != nil {
+			return routeEntry{}, fmt.Errorf("%s: %w", label, err)
+		}
+		created[label] = provider
+		return routeEntry{label: label, provider: provider}, nil
+	}
+
+	var fallbacks []routeEntry
+	for _, fallback := range settings.LLMFallbacks {
+		e, err := entry(fallbackSettings(settings, fallback))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create fallback provider %w", err)
+		}
+		fallbacks = append(fallbacks, e)
+	}
+
+	// Responses use the model of the primary provider
+	taskModels := map[string]string{
+		TaskResponse:    "",
+		TaskToolCall:    settings.LLMToolCallModel,
+		TaskSyntaxFix:   settings.LLMSyntaxFixModel,
+		TaskStructuring: settings.LLMStructuringModel,
+	}
+	for task, model := range taskModels {
+		primary, err := entry(withModel(settings, model))
+		if err != nil {
+			return nil, err
+		}
+		r.chains[task] = append([]routeEntry{primary}, fallbacks...)
+	}
+
+	return r, nil
+}
+
+// fallbackSettings derives the settings of a fallback provider. Connection settings
+// of the primary provider are only inherited when the fallback uses the same provider.
+func fallbackSettings(settings models.MCPDataSourceSettings, fallback models.LLMFallback) models.MCPDataSourceSettings {
+	providerSettings := settings
+	providerSettings.LLMProvider = fallback.Provider
+	providerSettings.LLMModel = ""
+	providerSettings = withModel(providerSettings, fallback.Model)
+	if fallback.Provider != settings.LLMProvider {
+		providerSettings.LLMAPIKey = settings.LLMProviderAPIKeys[fallback.Provider]
+		providerSettings.LLMBaseURL = ""
+		providerSettings.LLMHeaders = nil
+	}
+	if fallback.BaseURL != "" {
+		providerSettings.LLMBaseURL = fallback.BaseURL
+	}
+	return providerSettings
+}
+
+// withModel returns the settings with model, if one is given. Azure OpenAI
+// serves a model through a deployment and ignores the model name, so for azure
+// the model names the deployment.
+func withModel(settings models.MCPDataSourceSettings, model string) models.MCPDataSourceSettings {
+	if model == "" {
+		return settings
+	}
+	settings.LLMModel = model
+	if settings.LLMProvider == "azure" {
+		settings.AzureDeployment = model
+	}
+	return settings
+}
+
+func providerLabel(settings models.MCPDataSourceSettings) string {
+	provider := settings.LLMProvider
+	if provider == "" {
+		provider = "mock"
+	}
+	model := settings.LLMModel
+	if provider == "azure" {
+		model = settings.AzureDeployment
+	}
+	if model == "" {
+		return provider
+	}
+	return provider + "/" + model
+}
+
+// callChain runs call against each provider of the task's chain until one succeeds
+// or fails with an error that does not warrant a fallback
+func callChain[T any](ctx context.Context, r *routedProvider, task string, call func(ctx context.Context, provider LLMProvider) (T, error)) (T, error) {
+	chain := r.chains[task]
+
+	var result T
+	var err error
+	for i, entry := range chain {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if i < len(chain)-1 && r.attemptTimeout > 0 {
+			// Bound every attempt but the last so a hanging provider leaves time to fall back
+			attemptCtx, cancel = context.WithTimeout(ctx, r.attemptTimeout)
+		}
+		result, err = call(attemptCtx, entry.provider)
+		cancel()
+
+		if err == nil {
+			r.recordUse(task, entry.label, i > 0)
+			return result, nil
+		}
+		if i == len(chain)-1 || !isFallbackError(ctx, err) {
+			return result, err
+		}
+		r.logger.Warn("LLM provider failed, trying next provider", "task", task, "provider", entry.label, "next", chain[i+1].label, "error", err)
+	}
+	return result, err
+}
+
+func (r *routedProvider) recordUse(task, label string, fallback bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.used[task] = label
+	if fallback {
+		r.fallbackUsed = true
+	}
+}
+
+// Usage returns the provider used for each task so far, and whether any task
+// was answered by a fallback provider
+func (r *routedProvider) Usage() (map[string]string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	used := make(map[string]string, len(r.used))
+	for task, label := range r.used {
+		used[task] = label
+	}
+	return used, r.fallbackUsed
+}
+
+// GenerateResponse generates a response with the response chain
+func (r *routedProvider) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+	return callChain(ctx, r, TaskResponse, func(ctx context.Context, provider LLMProvider) (string, error) {
+		return provider.GenerateResponse(ctx, prompt)
+	})
+}
+
+// GenerateToolCall selects a tool with the tool call chain
+func (r *routedProvider) GenerateToolCall(ctx context.Context, query string, tools []mcp.Tool) (*ToolCall, error) {
+	return callChain(ctx, r, TaskToolCall, func(ctx context.Context, provider LLMProvider) (*ToolCall, error) {
+		return provider.GenerateToolCall(ctx, query, tools)
+	})
+}
+
+// GenerateStructuredResults structures tool results with the structuring chain
+func (r *routedProvider) GenerateStructuredResults(ctx context.Context, query string, toolResults []ToolResult) (*StructuredQueryResult, error) {
+	return callChain(ctx, r, TaskStructuring, func(ctx context.Context, provider LLMProvider) (*StructuredQueryResult, error) {
+		return provider.GenerateStructuredResults(ctx, query, toolResults)
+	})
+}
+
+// FixQuerySyntax fixes a tool call with the syntax fix chain
+func (r *routedProvider) FixQuerySyntax(ctx context.Context, originalQuery string, toolName string, errorMessage string, tools []mcp.Tool) (*ToolCall, error) {
+	return callChain(ctx, r, TaskSyntaxFix, func(ctx context.Context, provider LLMProvider) (*ToolCall, error) {
+		return provider.FixQuerySyntax(ctx, originalQuery, toolName, errorMessage, tools)
+	})
+}
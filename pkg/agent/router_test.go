@@ -0,0 +1,182 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+func TestRoutedProviderFallsBack(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusInternalServerError, 529} {
+		primary := newLLMServer[OpenAIRequest](t, nil, llmResponse{status: status, body: http.StatusText(status)})
+		fallback := newLLMServer[OpenAIRequest](t, nil, chatCompletion("from fallback"))
+
+		router, err := newRoutedProvider(models.MCPDataSourceSettings{
+			LLMProvider:   "openai_compatible",
+			LLMBaseURL:    primary.URL,
+			LLMModel:      "primary-model",
+			LLMFallbacks:  []models.LLMFallback{{Provider: "openai_compatible", Model: "fallback-model", BaseURL: fallback.URL}},
+			LLMMaxRetries: -1, // fall back on the first failure
+		})
+		require.NoError(t, err)
+
+		response, err := router.GenerateResponse(context.Background(), "ping")
+		require.NoError(t, err, "status %d", status)
+		assert.Equal(t, "from fallback", response)
+
+		used, fallbackUsed := router.Usage()
+		assert.Equal(t, map[string]string{TaskResponse: "openai_compatible/fallback-model"}, used)
+		assert.True(t, fallbackUsed)
+	}
+}
+
+func TestRoutedProviderDoesNotFallBackOnClientErrors(t *testing.T) {
+	primary := newLLMServer[OpenAIRequest](t, nil, llmResponse{status: http.StatusBadRequest, body: http.StatusText(http.StatusBadRequest)})
+	fallbackCalled := false
+	fallback := newLLMServer(t, func(*http.Request, OpenAIRequest) { fallbackCalled = true }, chatCompletion("from fallback"))
+
+	router, err := newRoutedProvider(models.MCPDataSourceSettings{
+		LLMProvider:  "openai_compatible",
+		LLMBaseURL:   primary.URL,
+		LLMModel:     "primary-model",
+		LLMFallbacks: []models.LLMFallback{{Provider: "openai_compatible", Model: "fallback-model", BaseURL: fallback.URL}},
+	})
+	require.NoError(t, err)
+
+	_, err = router.GenerateResponse(context.Background(), "ping")
+	require.Error(t, err)
+	assert.False(t, fallbackCalled)
+}
+
+func TestRoutedProviderFallsBackOnTimeout(t *testing.T) {
+	release := make(chan struct{})
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer primary.Close()
+	defer close(release)
+	fallback := newLLMServer[OpenAIRequest](t, nil, chatCompletion("from fallback"))
+
+	router, err := newRoutedProvider(models.MCPDataSourceSettings{
+		LLMProvider:  "openai_compatible",
+		LLMBaseURL:   primary.URL,
+		LLMModel:     "primary-model",
+		LLMFallbacks: []models.LLMFallback{{Provider: "openai_compatible", Model: "fallback-model", BaseURL: fallback.URL}},
+	})
+	require.NoError(t, err)
+	router.attemptTimeout = 50 * time.Millisecond
+
+	response, err := router.GenerateResponse(context.Background(), "ping")
+	require.NoError(t, err)
+	assert.Equal(t, "from fallback", response)
+}
+
+func TestRoutedProviderPerTaskModels(t *testing.T) {
+	var mu sync.Mutex
+	var gotModels []string
+	server := newLLMServer(t, func(_ *http.Request, request OpenAIRequest) {
+		mu.Lock()
+		gotModels = append(gotModels, request.Model)
+		mu.Unlock()
+	}, chatCompletion(`{"tool_name": "loki_query", "arguments": {}, "reasoning": "logs"}`))
+
+	router, err := newRoutedProvider(models.MCPDataSourceSettings{
+		LLMProvider:       "openai_compatible",
+		LLMBaseURL:        server.URL,
+		LLMModel:          "default-model",
+		LLMToolCallModel:  "fast-model",
+		LLMSyntaxFixModel: "strong-model",
+	})
+	require.NoError(t, err)
+
+	tools := []mcp.Tool{{Name: "loki_query"}}
+	_, err = router.GenerateToolCall(context.Background(), "error logs", tools)
+	require.NoError(t, err)
+	_, err = router.FixQuerySyntax(context.Background(), "error logs", "loki_query", "parse error", tools)
+	require.NoError(t, err)
+	_, err = router.GenerateResponse(context.Background(), "summarize")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"fast-model", "strong-model", "default-model"}, gotModels)
+
+	used, fallbackUsed := router.Usage()
+	assert.Equal(t, map[string]string{
+		TaskToolCall:  "openai_compatible/fast-model",
+		TaskSyntaxFix: "openai_compatible/strong-model",
+		TaskResponse:  "openai_compatible/default-model",
+	}, used)
+	assert.False(t, fallbackUsed)
+}
+
+func TestRoutedProviderAzurePerTaskDeployments(t *testing.T) {
+	var mu sync.Mutex
+	var gotPaths []string
+	server := newLLMServer(t, func(r *http.Request, _ OpenAIRequest) {
+		mu.Lock()
+		gotPaths = append(gotPaths, r.URL.Path)
+		mu.Unlock()
+	}, chatCompletion(`{"tool_name": "loki_query", "arguments": {}, "reasoning": "logs"}`))
+
+	router, err := newRoutedProvider(models.MCPDataSourceSettings{
+		LLMProvider:      "azure",
+		LLMAPIKey:        "azure-key",
+		AzureEndpoint:    server.URL,
+		AzureDeployment:  "gpt-4o",
+		LLMModel:         "ignored",
+		LLMToolCallModel: "gpt-4o-mini",
+	})
+	require.NoError(t, err)
+
+	_, err = router.GenerateToolCall(context.Background(), "error logs", []mcp.Tool{{Name: "loki_query"}})
+	require.NoError(t, err)
+	_, err = router.GenerateResponse(context.Background(), "summarize")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"/openai/deployments/gpt-4o-mini/chat/completions",
+		"/openai/deployments/gpt-4o/chat/completions",
+	}, gotPaths)
+	used, _ := router.Usage()
+	assert.Equal(t, map[string]string{
+		TaskToolCall: "azure/gpt-4o-mini",
+		TaskResponse: "azure/gpt-4o",
+	}, used)
+}
+
+func TestFallbackSettings(t *testing.T) {
+	settings := models.MCPDataSourceSettings{
+		LLMProvider:        "openai_compatible",
+		LLMAPIKey:          "local-key",
+		LLMBaseURL:         "http://localhost:8000/v1",
+		LLMHeaders:         map[string]string{"X-Team": "obs"},
+		LLMProviderAPIKeys: map[string]string{"anthropic": "anthropic-key"},
+	}
+
+	sameProvider := fallbackSettings(settings, models.LLMFallback{Provider: "openai_compatible", Model: "small"})
+	assert.Equal(t, "local-key", sameProvider.LLMAPIKey)
+	assert.Equal(t, "http://localhost:8000/v1", sameProvider.LLMBaseURL)
+	assert.Equal(t, "small", sameProvider.LLMModel)
+
+	otherProvider := fallbackSettings(settings, models.LLMFallback{Provider: "anthropic"})
+	assert.Equal(t, "anthropic-key", otherProvider.LLMAPIKey)
+	assert.Empty(t, otherProvider.LLMBaseURL)
+	assert.Nil(t, otherProvider.LLMHeaders)
+
+	_, err := newRoutedProvider(models.MCPDataSourceSettings{
+		LLMFallbacks: []models.LLMFallback{{Provider: "openai"}},
+	})
+	require.Error(t, err, "fallback without an API key")
+	assert.Contains(t, err.Error(), "fallback provider openai")
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"strings"
+	"time"
+
+	"grafana-mcpclient-datasource/pkg/structuring"
+)
+
+// ResultTable is a named table of a structured result, with its own columns and
+// metadata
+type ResultTable = structuring.Table
+
+// structureLocally structures a tool result with the structuring engine, so every
+// provider gets the same tables for the formats it recognises. It returns nil
+// when the result should be structured by the LLM instead.
+func structureLocally(query string, toolResult ToolResult) *StructuredQueryResult {
+	tool := toolResult.ToolName
+	text, ok := toolResult.Data.(string)
+	if !toolResult.Success || !ok {
+		return nil
+	}
+	if structured := structuring.Structure([]structuring.Output{{Tool: tool, Text: text}}); structured != nil {
+		return localResult(query, structured)
+	}
+
+	if strings.Contains(text, "No logs found") {
+		return localResult(query, &structuring.Result{Summary: "No logs found"})
+	}
+
+	// If data is small enough and looks simple, the LLM can tell how to extract rows from it
+	if len(text) <= 1000 && strings.Count(text, "\n") <= 20 {
+		return nil
+	}
+
+	// Large unstructured data is shown a line per row
+	return localResult(query, structuring.Lines(structuring.Output{Tool: tool, Text: text}))
+}
+
+// localResult returns the structured query result of a tool result structured
+// without the LLM
+func localResult(query string, structured *structuring.Result) *StructuredQueryResult {
+	result := structuredResult(query, structured)
+	result.Metadata["tool_count"] = 1
+	result.Metadata["local_parsing"] = true
+	return result
+}
+
+// structuredResult converts the result of the structuring engine into a
+// successful structured query result
+func structuredResult(query string, structured *structuring.Result) *StructuredQueryResult {
+	result := &StructuredQueryResult{
+		Query:   query,
+		Data:    structured.Data,
+		Columns: structured.Columns,
+		Frames:  structured.Frames,
+		Tables:  structured.Tables,
+		Summary: structured.Summary,
+		Success: true,
+		Metadata: map[string]interface{}{
+			"processed_at": time.Now(),
+		},
+	}
+	if result.Data == nil {
+		result.Data = []map[string]interface{}{}
+	}
+	if result.Columns == nil {
+		result.Columns = []string{}
+	}
+	for key, value := range structured.Metadata {
+		result.Metadata[key] = value
+	}
+	return result
+}
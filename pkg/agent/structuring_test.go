@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStructureLocally(t *testing.T) {
+	result := structureLocally("error rate", ToolResult{ToolName: "query", Success: true, Data: "service,rate\napi,0.5"})
+	require.NotNil(t, result)
+	require.True(t, result.Success)
+	assert.Equal(t, []map[string]interface{}{{"service": "api", "rate": 0.5}}, result.Data)
+	assert.Equal(t, true, result.Metadata["local_parsing"])
+	assert.Equal(t, "csv", result.Metadata["format"])
+	assert.Equal(t, 1, result.Metadata["tool_count"])
+
+	// Small text none of the parsers accepts is left to the LLM
+	assert.Nil(t, structureLocally("states", ToolResult{ToolName: "status", Success: true, Data: "api is up\ndb is down"}))
+	assert.Nil(t, structureLocally("states", ToolResult{ToolName: "status", Success: false, Error: "connection refused"}))
+
+	result = structureLocally("states", ToolResult{ToolName: "status", Success: true, Data: strings.Repeat("api is up\n", 200)})
+	require.NotNil(t, result)
+	assert.Equal(t, []string{"line"}, result.Columns)
+	assert.Len(t, result.Data, 200, "large text is kept in full, a line per row")
+	assert.Equal(t, "lines", result.Metadata["format"])
+}
+
+func TestGenerateStructuredResultsAppliesLLMSpec(t *testing.T) {
+	var prompt string
+	provider := &promptProvider{name: "test", generate: func(_ context.Context, p string) (string, error) {
+		prompt = p
+		// Values in the response other than the spec are ignored
+		return "```json\n" + `{"pattern": "^(?P<service>\\S+) is (?P<state>\\w+)", "data": [{"service": "made up"}], "summary": "Service states"}` + "\n```", nil
+	}}
+
+	result, err := provider.GenerateStructuredResults(context.Background(), "service states", []ToolResult{
+		{ToolName: "status", Success: true, Data: "api is up\ndb is down"},
+	})
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(prompt, "Do NOT copy any values"))
+	require.True(t, result.Success)
+	assert.Equal(t, []string{"service", "state"}, result.Columns)
+	assert.Equal(t, []map[string]interface{}{{"service": "api", "state": "up"}, {"service": "db", "state": "down"}}, result.Data)
+	assert.Equal(t, "Service states", result.Summary)
+	assert.Equal(t, "llm_mapping", result.Metadata["format"])
+	assert.Equal(t, "status", result.Metadata["tool_name"])
+}
+
+func TestGenerateStructuredResultsKeepsLinesWhenSpecFails(t *testing.T) {
+	provider := &promptProvider{name: "test", generate: func(context.Context, string) (string, error) {
+		return `{"pattern": "^(?P<x>nothing)$"}`, nil
+	}}
+
+	result, err := provider.GenerateStructuredResults(context.Background(), "states", []ToolResult{
+		{ToolName: "status", Success: true, Data: "api is up\ndb is down"},
+	})
+	require.NoError(t, err)
+	require.True(t, result.Success)
+	assert.Equal(t, []string{"line"}, result.Columns)
+	assert.Equal(t, []map[string]interface{}{{"line": "api is up"}, {"line": "db is down"}}, result.Data)
+	assert.Contains(t, result.Metadata["structuring_error"], "matched no rows")
+}
+
+func TestGenerateStructuredResultsWithoutData(t *testing.T) {
+	provider := &promptProvider{name: "test", generate: func(context.Context, string) (string, error) {
+		t.Fatal("the LLM must not be asked to structure errors")
+		return "", nil
+	}}
+
+	result, err := provider.GenerateStructuredResults(context.Background(), "states", []ToolResult{
+		{ToolName: "status", Success: false, Error: "connection refused"},
+	})
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, "status: connection refused", result.ErrorMsg)
+}
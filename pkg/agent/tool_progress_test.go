@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/models"
+	"grafana-mcpclient-datasource/pkg/toolprogress"
+)
+
+// newTestMCPClient returns a client connected to a test server. Its "scan" tool
+// reports its progress and logs a message before returning, and its "latency"
+// tool returns structured content matching its output schema.
+func newTestMCPClient(t *testing.T, tracker *toolprogress.Tracker) *client.Client {
+	t.Helper()
+	// The client signals the handler of "scan" once it has received the notifications
+	// of the call, which the server writes asynchronously
+	received := make(chan struct{}, 1)
+	mcpServer := server.NewMCPServer("test", "1.0.0", server.WithLogging())
+	mcpServer.AddTool(mcp.NewTool("scan"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		require.NotNil(t, request.Params.Meta, "the call carries a progress token")
+		token := request.Params.Meta.ProgressToken
+		notify := server.ServerFromContext(ctx).SendNotificationToClient
+		require.NoError(t, notify(ctx, "notifications/progress", map[string]any{"progressToken": token, "progress": 1, "total": 4, "message": "Scanning chunks"}))
+		require.NoError(t, notify(ctx, "notifications/message", map[string]any{"level": "warning", "data": "slow query"}))
+		require.NoError(t, notify(ctx, "notifications/progress", map[string]any{"progressToken": "other-call", "progress": 3}))
+		select {
+		case <-received:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return mcp.NewToolResultText("done"), nil
+	})
+	mcpServer.AddTool(mcp.NewTool("latency", mcp.WithRawOutputSchema(json.RawMessage(`{
+		"type": "object",
+		"properties": {"p99": {"type": "number", "x-unit": "ms"}, "service": {"type": "string"}}
+	}`))), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultStructured(map[string]any{"p99": 120.5, "service": "api"}, `{"p99": 120.5, "service": "api"}`), nil
+	})
+	mcpClient := connectTestMCPClient(t, mcpServer)
+	mcpClient.OnNotification(func(notification mcp.JSONRPCNotification) {
+		tracker.Handle(notification)
+		// The progress of "other-call" is the last notification of "scan"
+		if notification.Params.AdditionalFields["progressToken"] == "other-call" {
+			received <- struct{}{}
+		}
+	})
+	return mcpClient
+}
+
+// connectTestMCPClient returns a client connected and initialized against mcpServer
+func connectTestMCPClient(t *testing.T, mcpServer *server.MCPServer) *client.Client {
+	t.Helper()
+	httpServer := server.NewTestStreamableHTTPServer(mcpServer)
+	t.Cleanup(httpServer.Close)
+
+	mcpClient, err := client.NewStreamableHttpClient(httpServer.URL + "/mcp")
+	require.NoError(t, err)
+	t.Cleanup(func() { mcpClient.Close() })
+	require.NoError(t, mcpClient.Start(context.Background()))
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = mcpClient.Initialize(context.Background(), initRequest)
+	require.NoError(t, err)
+	return mcpClient
+}
+
+func TestExecuteToolRelaysProgress(t *testing.T) {
+	tracker := toolprogress.NewTracker("test-")
+	a, err := NewAgent(newTestMCPClient(t, tracker), models.MCPDataSourceSettings{}, nil, tracker)
+	require.NoError(t, err)
+
+	ctx, events := collectProgress()
+	result, err := a.executeTool(ctx, ToolCall{ToolName: "scan"})
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Equal(t, "done", result.Data)
+
+	require.Len(t, *events, 2, "notifications of other calls are ignored")
+	assert.Equal(t, ProgressEvent{Stage: StageToolProgress, Tool: "scan", Message: "scan: 25% Scanning chunks", Progress: 1, Total: 4}, (*events)[0])
+	assert.Equal(t, ProgressEvent{Stage: StageToolLog, Tool: "scan", Message: "scan: [warning] slow query", Level: "warning"}, (*events)[1])
+
+	require.Len(t, result.Updates, 2)
+	assert.Equal(t, toolprogress.KindProgress, result.Updates[0].Kind)
+	assert.Equal(t, "slow query", result.Updates[1].Message)
+}
+
+func TestStructuredContentSkipsLLM(t *testing.T) {
+	tracker := toolprogress.NewTracker("test-")
+	mcpClient := newTestMCPClient(t, tracker)
+	tools, err := mcpClient.ListTools(context.Background(), mcp.ListToolsRequest{})
+	require.NoError(t, err)
+
+	a, err := NewAgent(mcpClient, models.MCPDataSourceSettings{}, nil, tracker)
+	require.NoError(t, err)
+
+	ctx, events := collectProgress()
+	result, err := a.ProcessQueryStructured(ctx, "p99 latency of the api", "latency", "", "", nil, tools.Tools)
+	require.NoError(t, err)
+	require.True(t, result.Success, result.ErrorMsg)
+
+	require.Len(t, result.Frames, 1)
+	p99 := result.Frames[0].Fields[0]
+	assert.Equal(t, "p99", p99.Name)
+	assert.Equal(t, "ms", p99.Config.Unit)
+	assert.Equal(t, 120.5, *p99.At(0).(*float64))
+	assert.Equal(t, true, result.Metadata["structured_content"])
+	for _, event := range *events {
+		assert.NotEqual(t, StageStructuringResults, event.Stage, "the LLM is not asked to structure the results")
+	}
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"context"
+	"errors"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan starts a span for an agent step using the plugin SDK tracer
+func (a *Agent) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attribute.String("grafana.datasource.uid", a.settings.DatasourceUID),
+		attribute.String("llm.provider", a.settings.LLMProvider),
+	)
+	return tracing.DefaultTracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// generateToolCall calls the LLM provider's GenerateToolCall within a span
+func (a *Agent) generateToolCall(ctx context.Context, query string, tools []mcp.Tool) (*ToolCall, error) {
+	ctx, span := a.startSpan(ctx, "LLMProvider.GenerateToolCall", attribute.Int("mcp.tools.count", len(tools)))
+	defer span.End()
+
+	toolCall, err := a.llmProvider.GenerateToolCall(ctx, query, tools)
+	if err != nil {
+		return nil, tracing.Error(span, err)
+	}
+	if toolCall != nil {
+		span.SetAttributes(attribute.String("mcp.tool.name", toolCall.ToolName))
+	}
+	return toolCall, nil
+}
+
+// fixQuerySyntax calls the LLM provider's FixQuerySyntax within a span
+func (a *Agent) fixQuerySyntax(ctx context.Context, originalQuery string, toolName string, errorMessage string, tools []mcp.Tool) (*ToolCall, error) {
+	ctx, span := a.startSpan(ctx, "LLMProvider.FixQuerySyntax", attribute.String("mcp.tool.name", toolName))
+	defer span.End()
+
+	toolCall, err := a.llmProvider.FixQuerySyntax(ctx, originalQuery, toolName, errorMessage, tools)
+	if err != nil {
+		return nil, tracing.Error(span, err)
+	}
+	return toolCall, nil
+}
+
+// generateStructuredResults calls the LLM provider's GenerateStructuredResults within a span
+func (a *Agent) generateStructuredResults(ctx context.Context, query string, toolResults []ToolResult) (*StructuredQueryResult, error) {
+	ctx, span := a.startSpan(ctx, "LLMProvider.GenerateStructuredResults", attribute.Int("mcp.tool_results.count", len(toolResults)))
+	defer span.End()
+
+	result, err := a.llmProvider.GenerateStructuredResults(ctx, query, toolResults)
+	if err != nil {
+		return nil, tracing.Error(span, err)
+	}
+	if !result.Success {
+		tracing.Error(span, errors.New(result.ErrorMsg))
+	}
+	span.SetAttributes(attribute.Int("result.rows", len(result.Data)))
+	return result, nil
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+
+	"grafana-mcpclient-datasource/pkg/conv"
+	"grafana-mcpclient-datasource/pkg/transform"
+)
+
+// GenerateTransforms asks the LLM for a transform pipeline that answers query
+// from table, e.g. "top 10 services by latency", and validates it against the
+// columns of the table. Only the column names and kinds are shown to the LLM;
+// the pipeline is run locally.
+func (a *Agent) GenerateTransforms(ctx context.Context, query string, table transform.Table) (transform.Pipeline, error) {
+	ctx, span := a.startSpan(ctx, "Agent.GenerateTransforms", attribute.Int("transform.columns.count", len(table.Columns)))
+	defer span.End()
+
+	prompt := fmt.Sprintf(`You are preparing a table for a Grafana panel. The user asked: "%s"
+
+The table has these columns:
+%s
+
+Reply with a JSON array of transform steps that turns the table into what the user asked for, or [] if it already is. The steps run one after the other; columns added, renamed or removed by a step are what the next step sees. Steps:
+- {"type": "filter", "column": "status", "op": ">=", "value": 500}; op is one of =, !=, >, >=, <, <=, contains, =~, !~ (=~ and !~ take a regular expression)
+- {"type": "select", "columns": ["service", "latency"]}
+- {"type": "rename", "names": {"old name": "new name"}}
+- {"type": "group_by", "by": ["service"], "aggregates": [{"op": "count", "as": "requests"}, {"op": "avg", "column": "latency", "as": "avg_latency"}]}; op is one of count, sum, avg, min, max, first, last
+- {"type": "sort", "by": ["avg_latency"], "desc": true}
+- {"type": "limit", "count": 10}
+- {"type": "time_bucket", "column": "timestamp", "interval": "5m", "as": "bucket"}
+- {"type": "derive", "as": "latency_s", "expression": "latency_ms / 1000"}; expressions use + - * / %% and parentheses, names that are not identifiers go in backquotes
+
+JSON array:`, query, describeColumns(table))
+
+	response, err := a.llmProvider.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return nil, tracing.Error(span, err)
+	}
+
+	start := strings.Index(response, "[")
+	end := strings.LastIndex(response, "]") + 1
+	if start < 0 || end <= start {
+		return nil, tracing.Error(span, fmt.Errorf("no transform steps found in LLM response"))
+	}
+	var pipeline transform.Pipeline
+	if err := json.Unmarshal([]byte(response[start:end]), &pipeline); err != nil {
+		return nil, tracing.Error(span, fmt.Errorf("failed to parse transform steps: %w", err))
+	}
+	if err := pipeline.Validate(table.Columns); err != nil {
+		return nil, tracing.Error(span, fmt.Errorf("invalid transform steps: %w", err))
+	}
+	span.SetAttributes(attribute.Int("transform.steps.count", len(pipeline)))
+	return pipeline, nil
+}
+
+// kindNames names the kinds of values for the LLM
+var kindNames = map[string]string{
+	conv.KindInt:    "number",
+	conv.KindFloat:  "number",
+	conv.KindBool:   "boolean",
+	conv.KindTime:   "time",
+	conv.KindJSON:   "object",
+	conv.KindString: "text",
+}
+
+// describeColumns lists the columns of a table with the kind of their first value,
+// without any values
+func describeColumns(table transform.Table) string {
+	lines := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		kind := "empty"
+		for _, row := range table.Rows {
+			if valueKind := conv.Kind(row[column]); valueKind != "" {
+				kind = kindNames[valueKind]
+				break
+			}
+		}
+		lines[i] = fmt.Sprintf("- %s (%s)", column, kind)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/transform"
+)
+
+// replyProvider answers every prompt with reply and keeps the last prompt
+type replyProvider struct {
+	MockProvider
+	reply  string
+	prompt string
+}
+
+func (p *replyProvider) GenerateResponse(_ context.Context, prompt string) (string, error) {
+	p.prompt = prompt
+	return p.reply, nil
+}
+
+func TestGenerateTransforms(t *testing.T) {
+	table := transform.Table{
+		Columns: []string{"service", "latency"},
+		Rows:    []map[string]interface{}{{"service": "secret-service", "latency": 1.5}},
+	}
+	provider := &replyProvider{reply: "Here you go:\n```json\n" + `[{"type": "sort", "by": ["latency"], "desc": true}, {"type": "limit", "count": 10}]` + "\n```"}
+	a := &Agent{llmProvider: provider}
+
+	pipeline, err := a.GenerateTransforms(context.Background(), "top 10 by latency", table)
+	require.NoError(t, err)
+	assert.Equal(t, transform.Pipeline{
+		{Type: transform.TypeSort, By: []string{"latency"}, Desc: true},
+		{Type: transform.TypeLimit, Count: 10},
+	}, pipeline)
+	assert.Contains(t, provider.prompt, "- latency (number)")
+	assert.NotContains(t, provider.prompt, "secret-service", "values are not shown to the LLM")
+
+	provider.reply = `[{"type": "sort", "by": ["p99"]}]`
+	_, err = a.GenerateTransforms(context.Background(), "sort by p99", table)
+	assert.ErrorContains(t, err, `unknown column "p99"`)
+}
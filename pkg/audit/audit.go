@@ -0,0 +1,171 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"grafana-mcpclient-datasource/pkg/models"
+	"grafana-mcpclient-datasource/pkg/redact"
+)
+
+// Status values recorded for a tool invocation
+const (
+	StatusSuccess = "success"
+	StatusError   = "error"
+)
+
+// Event is a single audited tool invocation
+type Event struct {
+	Timestamp      time.Time              `json:"timestamp"`
+	UserLogin      string                 `json:"userLogin,omitempty"`
+	UserEmail      string                 `json:"userEmail,omitempty"`
+	UserRole       string                 `json:"userRole,omitempty"`
+	OrgID          int64                  `json:"orgId,omitempty"`
+	DatasourceUID  string                 `json:"datasourceUid"`
+	DatasourceName string                 `json:"datasourceName,omitempty"`
+	QueryType      string                 `json:"queryType"`
+	Tool           string                 `json:"tool"`
+	Arguments      map[string]interface{} `json:"arguments,omitempty"`
+	Status         string                 `json:"status"`
+	Error          string                 `json:"error,omitempty"`
+	ResultBytes    int                    `json:"resultBytes"`
+	DurationMs     int64                  `json:"durationMs"`
+}
+
+// Sink receives audit events
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, event Event) error
+	Close() error
+}
+
+// Auditor records tool invocations to the configured sinks.
+// A nil *Auditor is valid and records nothing.
+type Auditor struct {
+	sinks          []Sink
+	datasourceUID  string
+	datasourceName string
+	redactor       *redact.Redactor
+	logger         log.Logger
+}
+
+// NewAuditor creates an auditor with the sinks configured in settings.
+// Returns nil when auditing is not enabled.
+func NewAuditor(settings models.MCPDataSourceSettings, datasourceName string) (*Auditor, error) {
+	if len(settings.AuditSinks) == 0 {
+		return nil, nil
+	}
+
+	redactor, err := redact.NewRedactor(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redactor: %w", err)
+	}
+
+	auditor := &Auditor{
+		datasourceUID:  settings.DatasourceUID,
+		datasourceName: datasourceName,
+		redactor:       redactor,
+		logger:         log.DefaultLogger,
+	}
+
+	for _, sinkName := range settings.AuditSinks {
+		switch strings.ToLower(sinkName) {
+		case "log":
+			auditor.sinks = append(auditor.sinks, NewLogSink(log.DefaultLogger))
+		case "file":
+			sink, err := NewFileSink(settings.AuditFilePath)
+			if err != nil {
+				auditor.Close()
+				return nil, fmt.Errorf("failed to create audit file sink: %w", err)
+			}
+			auditor.sinks = append(auditor.sinks, sink)
+		case "webhook":
+			sink, err := NewWebhookSink(settings.AuditWebhookURL, settings.AuditWebhookToken)
+			if err != nil {
+				auditor.Close()
+				return nil, fmt.Errorf("failed to create audit webhook sink: %w", err)
+			}
+			auditor.sinks = append(auditor.sinks, sink)
+		default:
+			auditor.Close()
+			return nil, fmt.Errorf("unsupported audit sink: %s (supported: log, file, webhook)", sinkName)
+		}
+	}
+
+	return auditor, nil
+}
+
+// RecordToolCall records a single tool invocation. User and organization are read
+// from the plugin context that the SDK stores in ctx.
+func (a *Auditor) RecordToolCall(ctx context.Context, queryType, tool string, arguments map[string]interface{}, start time.Time, resultBytes int, callErr error) {
+	if a == nil {
+		return
+	}
+
+	event := Event{
+		Timestamp:      start.UTC(),
+		DatasourceUID:  a.datasourceUID,
+		DatasourceName: a.datasourceName,
+		QueryType:      queryType,
+		Tool:           tool,
+		Arguments:      a.redactor.Arguments(arguments),
+		Status:         StatusSuccess,
+		ResultBytes:    resultBytes,
+		DurationMs:     time.Since(start).Milliseconds(),
+	}
+	if callErr != nil {
+		event.Status = StatusError
+		event.Error = a.redactor.String(callErr.Error())
+	}
+
+	pluginCtx := backend.PluginConfigFromContext(ctx)
+	event.OrgID = pluginCtx.OrgID
+	if pluginCtx.User != nil {
+		event.UserLogin = pluginCtx.User.Login
+		event.UserEmail = pluginCtx.User.Email
+		event.UserRole = pluginCtx.User.Role
+	}
+
+	// Audit delivery should not be cut short by the query being cancelled
+	sinkCtx := context.WithoutCancel(ctx)
+	for _, sink := range a.sinks {
+		if err := sink.Write(sinkCtx, event); err != nil {
+			a.logger.Error("Failed to write audit event", "sink", sink.Name(), "tool", tool, "error", err)
+		}
+	}
+}
+
+// Close releases the resources held by the sinks
+func (a *Auditor) Close() {
+	if a == nil {
+		return
+	}
+	for _, sink := range a.sinks {
+		if err := sink.Close(); err != nil {
+			a.logger.Warn("Failed to close audit sink", "sink", sink.Name(), "error", err)
+		}
+	}
+}
+
+// ContentSize returns the size in bytes of tool result content: the length of
+// text content, and the JSON-encoded length of any other content type
+func ContentSize(contents []mcp.Content) int {
+	size := 0
+	for _, content := range contents {
+		if textContent, ok := mcp.AsTextContent(content); ok {
+			size += len(textContent.Text)
+			continue
+		}
+		if encoded, err := json.Marshal(content); err == nil {
+			size += len(encoded)
+		}
+	}
+	return size
+}
@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/models"
+	"grafana-mcpclient-datasource/pkg/redact"
+)
+
+func TestNewAuditorDisabled(t *testing.T) {
+	auditor, err := NewAuditor(models.MCPDataSourceSettings{}, "ds")
+	require.NoError(t, err)
+	assert.Nil(t, auditor)
+
+	// A nil auditor is safe to use
+	auditor.RecordToolCall(context.Background(), "tool_call", "loki_query", nil, time.Now(), 0, nil)
+	auditor.Close()
+}
+
+func TestNewAuditorUnsupportedSink(t *testing.T) {
+	_, err := NewAuditor(models.MCPDataSourceSettings{AuditSinks: []string{"syslog"}}, "ds")
+	assert.Error(t, err)
+}
+
+func TestFileSinkRecordsRedactedEvent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	auditor, err := NewAuditor(models.MCPDataSourceSettings{
+		DatasourceUID:   "ds-uid",
+		AuditSinks:      []string{"file"},
+		AuditFilePath:   path,
+		Arguments:       map[string]string{"password": "hunter2", "host": "db"},
+		SecureArguments: []string{"password"},
+	}, "MCP")
+	require.NoError(t, err)
+
+	ctx := backend.WithPluginContext(context.Background(), backend.PluginContext{
+		OrgID: 3,
+		User:  &backend.User{Login: "alice", Email: "alice@example.com", Role: "Editor"},
+	})
+
+	auditor.RecordToolCall(ctx, "tool_call", "sql_query", map[string]interface{}{
+		"password": "hunter2",
+		"query":    "SELECT 1 -- hunter2",
+		"limit":    10,
+	}, time.Now().Add(-50*time.Millisecond), 42, errors.New("login failed for hunter2"))
+	auditor.Close()
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	require.True(t, scanner.Scan())
+
+	var event Event
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+
+	assert.Equal(t, "alice", event.UserLogin)
+	assert.Equal(t, int64(3), event.OrgID)
+	assert.Equal(t, "ds-uid", event.DatasourceUID)
+	assert.Equal(t, "MCP", event.DatasourceName)
+	assert.Equal(t, "sql_query", event.Tool)
+	assert.Equal(t, StatusError, event.Status)
+	assert.Equal(t, "login failed for [REDACTED]", event.Error)
+	assert.Equal(t, redact.SecretPlaceholder, event.Arguments["password"])
+	assert.Equal(t, "SELECT 1 -- [REDACTED]", event.Arguments["query"])
+	assert.Equal(t, 42, event.ResultBytes)
+	assert.GreaterOrEqual(t, event.DurationMs, int64(50))
+	assert.False(t, scanner.Scan())
+}
+
+func TestWebhookSink(t *testing.T) {
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret-token", r.Header.Get("Authorization"))
+		var event Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received <- event
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	auditor, err := NewAuditor(models.MCPDataSourceSettings{
+		AuditSinks:        []string{"webhook"},
+		AuditWebhookURL:   server.URL,
+		AuditWebhookToken: "secret-token",
+	}, "MCP")
+	require.NoError(t, err)
+
+	auditor.RecordToolCall(context.Background(), "natural_language", "loki_query", map[string]interface{}{"query": `{job="api"}`}, time.Now(), 128, nil)
+
+	select {
+	case event := <-received:
+		assert.Equal(t, "loki_query", event.Tool)
+		assert.Equal(t, StatusSuccess, event.Status)
+		assert.Equal(t, 128, event.ResultBytes)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook did not receive the audit event")
+	}
+}
+
+func TestWebhookSinkDoesNotWaitForTheEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	sink, err := newWebhookSink(server.URL, "", 1)
+	require.NoError(t, err)
+
+	start := time.Now()
+	var errs []error
+	for i := 0; i < 5; i++ {
+		if err := sink.Write(context.Background(), Event{Tool: "loki_query"}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	assert.Less(t, time.Since(start), time.Second)
+	require.NotEmpty(t, errs, "events beyond the queue are dropped")
+	assert.ErrorContains(t, errs[0], "queue is full")
+}
@@ -0,0 +1,225 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// LogSink writes audit events to the plugin log
+type LogSink struct {
+	logger log.Logger
+}
+
+// NewLogSink creates a sink that writes to the given logger
+func NewLogSink(logger log.Logger) *LogSink {
+	return &LogSink{logger: logger}
+}
+
+// Name returns the sink name
+func (s *LogSink) Name() string { return "log" }
+
+// Write logs the event as a single structured log line
+func (s *LogSink) Write(_ context.Context, event Event) error {
+	args, _ := json.Marshal(event.Arguments)
+	s.logger.Info("Audit: tool invocation",
+		"user", event.UserLogin,
+		"orgId", event.OrgID,
+		"datasourceUid", event.DatasourceUID,
+		"queryType", event.QueryType,
+		"tool", event.Tool,
+		"arguments", string(args),
+		"status", event.Status,
+		"error", event.Error,
+		"resultBytes", event.ResultBytes,
+		"durationMs", event.DurationMs)
+	return nil
+}
+
+// Close is a no-op for the log sink
+func (s *LogSink) Close() error { return nil }
+
+// FileSink appends audit events to a JSON-lines file
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens (or creates) the JSON-lines file at path for appending
+func NewFileSink(path string) (*FileSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("audit file path is required")
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+
+	return &FileSink{file: file}, nil
+}
+
+// Name returns the sink name
+func (s *FileSink) Name() string { return "file" }
+
+// Write appends the event as one JSON line
+func (s *FileSink) Write(_ context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying file
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Limits of the webhook sink, so a slow or unreachable endpoint never delays
+// queries: events are queued and posted in the background, and dropped when
+// the queue is full
+const (
+	webhookQueueSize    = 256
+	webhookTimeout      = 3 * time.Second
+	webhookCloseTimeout = 5 * time.Second
+)
+
+// WebhookSink posts each audit event as JSON to an HTTP endpoint
+type WebhookSink struct {
+	url    string
+	token  string
+	client *http.Client
+	logger log.Logger
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan Event
+	done   chan struct{}
+}
+
+// NewWebhookSink creates a sink that posts events to webhookURL, optionally
+// authenticating with a bearer token
+func NewWebhookSink(webhookURL, token string) (*WebhookSink, error) {
+	return newWebhookSink(webhookURL, token, webhookQueueSize)
+}
+
+func newWebhookSink(webhookURL, token string, queueSize int) (*WebhookSink, error) {
+	if webhookURL == "" {
+		return nil, fmt.Errorf("audit webhook URL is required")
+	}
+	if _, err := url.ParseRequestURI(webhookURL); err != nil {
+		return nil, fmt.Errorf("invalid audit webhook URL: %w", err)
+	}
+
+	s := &WebhookSink{
+		url:    webhookURL,
+		token:  token,
+		client: &http.Client{Timeout: webhookTimeout},
+		logger: log.DefaultLogger,
+		queue:  make(chan Event, queueSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Name returns the sink name
+func (s *WebhookSink) Name() string { return "webhook" }
+
+// Write queues the event to be posted to the webhook. It never waits for the
+// endpoint, and fails if the queue is full.
+func (s *WebhookSink) Write(_ context.Context, event Event) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return fmt.Errorf("audit webhook sink is closed")
+	}
+
+	select {
+	case s.queue <- event:
+		return nil
+	default:
+		return fmt.Errorf("audit webhook queue is full, event dropped")
+	}
+}
+
+// run posts the queued events until the sink is closed
+func (s *WebhookSink) run() {
+	defer close(s.done)
+	for event := range s.queue {
+		if err := s.post(event); err != nil {
+			s.logger.Error("Failed to write audit event", "sink", s.Name(), "tool", event.Tool, "error", err)
+		}
+	}
+}
+
+// post sends an event to the webhook
+func (s *WebhookSink) post(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook request failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close stops accepting events and waits a few seconds for the queued ones to
+// be posted
+func (s *WebhookSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-time.After(webhookCloseTimeout):
+		return fmt.Errorf("%d audit events were not posted to the webhook", len(s.queue))
+	}
+}
@@ -0,0 +1,173 @@
+// Package conv converts the values of tool results, decoded from JSON or parsed
+// from text, into numbers, times, booleans and text. Transform steps, schema hints
+// and type inference all convert values with it, so they agree on every value.
+package conv
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are the layouts of the times ParseTime parses from text
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", time.DateOnly}
+
+// ToFloat converts numbers and numbers in text into a float64
+func ToFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		number, err := v.Float64()
+		return number, err == nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// ToInt converts integers and integers in text into an int64. Integer types,
+// json.Number and text convert exactly; floats only up to 2^53, beyond which they
+// may have been rounded.
+func ToInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint:
+		return int64(v), v <= math.MaxInt64
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case json.Number:
+		if n, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return n, true
+		}
+	case string:
+		if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return n, true
+		}
+	}
+	// Integers may also be written with a fraction or an exponent, e.g. 1e3
+	if number, ok := ToFloat(value); ok && NumberKind(number) == KindInt {
+		return int64(number), true
+	}
+	return 0, false
+}
+
+// ToTime converts a time, a time in text or a Unix timestamp into a time.
+// Timestamps are taken as seconds, milliseconds, microseconds or nanoseconds
+// depending on their magnitude.
+func ToTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		if t, ok := ParseTime(v); ok {
+			return t, true
+		}
+	}
+	timestamp, ok := ToFloat(value)
+	if !ok {
+		return time.Time{}, false
+	}
+	return epochTime(timestamp), true
+}
+
+// ParseTime parses a time in text
+func ParseTime(text string) (time.Time, bool) {
+	text = strings.TrimSpace(text)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// epochTime converts a Unix timestamp in seconds, milliseconds, microseconds or
+// nanoseconds into a time
+func epochTime(timestamp float64) time.Time {
+	switch magnitude := math.Abs(timestamp); {
+	case magnitude < 1e11:
+		return time.UnixMilli(int64(math.Round(timestamp * 1e3))).UTC()
+	case magnitude < 1e14:
+		return time.UnixMilli(int64(timestamp)).UTC()
+	case magnitude < 1e17:
+		return time.UnixMicro(int64(timestamp)).UTC()
+	default:
+		return time.Unix(0, int64(timestamp)).UTC()
+	}
+}
+
+// ToBool converts booleans and booleans in text into a bool
+func ToBool(value interface{}) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		return b, err == nil
+	default:
+		return false, false
+	}
+}
+
+// ToString returns a value as text: times in RFC 3339, objects and arrays as JSON
+func ToString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case json.RawMessage:
+		return string(v)
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,93 @@
+package conv
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToTime(t *testing.T) {
+	want := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"time", want},
+		{"RFC 3339", "2024-05-01T10:00:00Z"},
+		{"SQL", "2024-05-01 10:00:00"},
+		{"seconds", float64(want.Unix())},
+		{"seconds in text", "1714557600"},
+		{"milliseconds", want.UnixMilli()},
+		{"microseconds", json.Number("1714557600000000")},
+		{"nanoseconds", uint64(want.UnixNano())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ToTime(tt.value)
+			assert.True(t, ok)
+			assert.True(t, want.Equal(got), "got %s", got)
+		})
+	}
+
+	_, ok := ToTime("yesterday")
+	assert.False(t, ok)
+}
+
+func TestToFloat(t *testing.T) {
+	for _, value := range []interface{}{int8(2), int16(2), int32(2), 2, uint8(2), float32(2), 2.0, json.Number("2"), " 2 "} {
+		number, ok := ToFloat(value)
+		assert.True(t, ok, "%T", value)
+		assert.Equal(t, 2.0, number)
+	}
+	_, ok := ToFloat(true)
+	assert.False(t, ok)
+}
+
+func TestToInt(t *testing.T) {
+	for _, value := range []interface{}{int8(2), int32(2), 2, uint64(2), 2.0, json.Number("2"), json.Number("2e0"), " 2 "} {
+		number, ok := ToInt(value)
+		assert.True(t, ok, "%T", value)
+		assert.Equal(t, int64(2), number)
+	}
+
+	// Beyond 2^53 integers stay exact, floats may have been rounded
+	number, ok := ToInt(json.Number("9007199254740993"))
+	assert.True(t, ok)
+	assert.Equal(t, int64(9007199254740993), number)
+	for _, value := range []interface{}{2.5, 9007199254740994.0, json.Number("1e19"), uint64(math.MaxUint64), "api"} {
+		_, ok := ToInt(value)
+		assert.False(t, ok, "%#v", value)
+	}
+}
+
+func TestToString(t *testing.T) {
+	assert.Equal(t, `{"a":1}`, ToString(map[string]interface{}{"a": 1}))
+	assert.Equal(t, "2024-05-01T10:00:00Z", ToString(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "1.5", ToString(1.5))
+}
+
+func TestKind(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, ""},
+		{" ", ""},
+		{"12", KindInt},
+		{int64(12), KindInt},
+		{json.Number("9007199254740993"), KindInt},
+		{9007199254740994.0, KindFloat},
+		{"12.5", KindFloat},
+		{"007", KindString},
+		{"TRUE", KindBool},
+		{"2024-05-01", KindTime},
+		{[]interface{}{1.0}, KindJSON},
+		{"api", KindString},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Kind(tt.value), "%#v", tt.value)
+	}
+}
@@ -0,0 +1,157 @@
+package conv
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// inferenceSampleSize is how many values of a column inferColumnType looks at
+const inferenceSampleSize = 1000
+
+// inferenceThreshold is the share of the sampled values that must fit a type for
+// the column to get it; the values that do not are reported as failures
+const inferenceThreshold = 0.9
+
+// inferColumnType returns the best common type of the values of a column from
+// a sample spread over the column: integers, other numbers, booleans and times
+// when nearly all sampled values are one, JSON if any value is an object or an
+// array, and otherwise text
+func inferColumnType(values []interface{}) string {
+	var present []interface{}
+	for _, value := range values {
+		if Kind(value) != "" {
+			present = append(present, value)
+		}
+	}
+	if len(present) == 0 {
+		return KindString
+	}
+
+	step := 1
+	if len(present) > inferenceSampleSize {
+		step = len(present) / inferenceSampleSize
+	}
+	counts := make(map[string]int)
+	sampled := 0
+	for i := 0; i < len(present) && sampled < inferenceSampleSize; i += step {
+		counts[Kind(present[i])]++
+		sampled++
+	}
+
+	fits := func(count int) bool {
+		return float64(count) >= inferenceThreshold*float64(sampled)
+	}
+	switch {
+	case counts[KindJSON] > 0:
+		return KindJSON
+	case fits(counts[KindInt]) && counts[KindFloat] == 0:
+		return KindInt
+	case fits(counts[KindInt] + counts[KindFloat]):
+		return KindFloat
+	case fits(counts[KindBool]):
+		return KindBool
+	case fits(counts[KindTime]):
+		return KindTime
+	default:
+		return KindString
+	}
+}
+
+// coercionFailure is a value that could not be converted to the type of its column
+type coercionFailure struct {
+	row   int
+	value interface{}
+}
+
+// InferField returns a field of the type inferColumnType infers for values, and a
+// notice on the values that could not be converted to it, which are left empty.
+// Every structured result gets its fields this way, whatever it was parsed from.
+func InferField(name string, values []interface{}) (*data.Field, []data.Notice) {
+	columnType := inferColumnType(values)
+	field, failures := coerceField(name, columnType, values)
+	if len(failures) == 0 {
+		return field, nil
+	}
+	first := failures[0]
+	return field, []data.Notice{{
+		Severity: data.NoticeSeverityWarning,
+		Text: fmt.Sprintf("%d of %d values of %s are not a valid %s and were left empty, e.g. %q in row %d",
+			len(failures), len(values), name, columnType, ToString(first.value), first.row+1),
+	}}
+}
+
+// coerceField converts values to a field of columnType and returns the values
+// that could not be converted
+func coerceField(name, columnType string, values []interface{}) (*data.Field, []coercionFailure) {
+	var failures []coercionFailure
+	convert := func(i int, value interface{}, ok bool) bool {
+		if !ok && Kind(value) != "" {
+			failures = append(failures, coercionFailure{row: i, value: value})
+		}
+		return ok
+	}
+
+	switch columnType {
+	case KindInt:
+		ints := make([]*int64, len(values))
+		for i, value := range values {
+			if n, ok := ToInt(value); convert(i, value, ok) {
+				ints[i] = &n
+			}
+		}
+		return data.NewField(name, nil, ints), failures
+	case KindFloat:
+		floats := make([]*float64, len(values))
+		for i, value := range values {
+			if number, ok := ToFloat(value); convert(i, value, ok) {
+				floats[i] = &number
+			}
+		}
+		return data.NewField(name, nil, floats), failures
+	case KindBool:
+		bools := make([]*bool, len(values))
+		for i, value := range values {
+			if b, ok := ToBool(value); convert(i, value, ok) {
+				bools[i] = &b
+			}
+		}
+		return data.NewField(name, nil, bools), failures
+	case KindTime:
+		times := make([]*time.Time, len(values))
+		for i, value := range values {
+			if t, ok := ToTime(value); convert(i, value, ok) {
+				times[i] = &t
+			}
+		}
+		return data.NewField(name, nil, times), failures
+	case KindJSON:
+		documents := make([]*json.RawMessage, len(values))
+		for i, value := range values {
+			if value == nil {
+				continue
+			}
+			document, ok := value.(json.RawMessage)
+			if !ok {
+				encoded, err := json.Marshal(value)
+				if !convert(i, value, err == nil) {
+					continue
+				}
+				document = encoded
+			}
+			documents[i] = &document
+		}
+		return data.NewField(name, nil, documents), failures
+	default:
+		strs := make([]*string, len(values))
+		for i, value := range values {
+			if value != nil {
+				text := ToString(value)
+				strs[i] = &text
+			}
+		}
+		return data.NewField(name, nil, strs), nil
+	}
+}
@@ -0,0 +1,73 @@
+package conv
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferColumnType(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []interface{}
+		want   string
+	}{
+		{"integers", []interface{}{1.0, "2", nil, int64(3)}, KindInt},
+		{"numbers in text", []interface{}{"12.5", "3", ""}, KindFloat},
+		{"booleans", []interface{}{true, "False", nil}, KindBool},
+		{"times", []interface{}{"2024-05-01T10:00:00Z", time.Now(), "2024-05-01"}, KindTime},
+		{"objects", []interface{}{map[string]interface{}{"a": 1.0}, "text"}, KindJSON},
+		{"identifiers with leading zeros", []interface{}{"007", "012"}, KindString},
+		{"mixed numbers and text", []interface{}{1.0, "a", 2.0, "b"}, KindString},
+		{"empty", []interface{}{nil, " "}, KindString},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, inferColumnType(tt.values))
+		})
+	}
+}
+
+func TestInferFieldReportsFailures(t *testing.T) {
+	values := make([]interface{}, 20)
+	for i := range values {
+		values[i] = float64(i) + 0.5
+	}
+	values[3] = "N/A"
+	values[7] = ""
+
+	field, notices := InferField("latency", values)
+	assert.Equal(t, data.FieldTypeNullableFloat64, field.Type())
+	assert.Equal(t, 0.5, *field.At(0).(*float64))
+	assert.Nil(t, field.At(3))
+	assert.Nil(t, field.At(7))
+	require.Len(t, notices, 1)
+	assert.Equal(t, data.NoticeSeverityWarning, notices[0].Severity)
+	assert.Equal(t, `1 of 20 values of latency are not a valid float64 and were left empty, e.g. "N/A" in row 4`, notices[0].Text)
+}
+
+func TestInferFieldConvertsValues(t *testing.T) {
+	field, notices := InferField("count", []interface{}{"12", 3.0, nil})
+	assert.Empty(t, notices)
+	assert.Equal(t, data.FieldTypeNullableInt64, field.Type())
+	assert.Equal(t, int64(12), *field.At(0).(*int64))
+	assert.Nil(t, field.At(2))
+
+	field, notices = InferField("id", []interface{}{json.Number("9007199254740993"), json.Number("1")})
+	assert.Empty(t, notices)
+	assert.Equal(t, int64(9007199254740993), *field.At(0).(*int64), "integers beyond 2^53 stay exact")
+
+	field, notices = InferField("details", []interface{}{map[string]interface{}{"a": 1.0}, "text"})
+	assert.Empty(t, notices)
+	assert.Equal(t, data.FieldTypeNullableJSON, field.Type())
+	assert.Equal(t, json.RawMessage(`{"a":1}`), *field.At(0).(*json.RawMessage))
+	assert.Equal(t, json.RawMessage(`"text"`), *field.At(1).(*json.RawMessage))
+
+	field, _ = InferField("name", []interface{}{1.0, "a", 2.5, "b"})
+	assert.Equal(t, data.FieldTypeNullableString, field.Type())
+	assert.Equal(t, "2.5", *field.At(2).(*string))
+}
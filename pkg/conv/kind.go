@@ -0,0 +1,83 @@
+package conv
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of values, which are also the types inferred for columns
+const (
+	KindTime   = "time"
+	KindInt    = "int64"
+	KindFloat  = "float64"
+	KindBool   = "bool"
+	KindJSON   = "JSON"
+	KindString = "string"
+)
+
+// maxExactInt is the largest integer a float64 holds exactly
+const maxExactInt = 1 << 53
+
+// Kind returns the kind a single value fits best. Numbers, booleans and times in
+// text count as such, except numbers with leading zeros, which are usually
+// identifiers. Integers that fit an int64 are integers even beyond 2^53, unless
+// they are floats. Empty values have no kind.
+func Kind(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return KindBool
+	case time.Time:
+		return KindTime
+	case map[string]interface{}, []interface{}, json.RawMessage:
+		return KindJSON
+	case string:
+		text := strings.TrimSpace(v)
+		switch {
+		case text == "":
+			return ""
+		case strings.EqualFold(text, "true") || strings.EqualFold(text, "false"):
+			return KindBool
+		case hasLeadingZero(text):
+			return KindString
+		}
+		if _, ok := ToInt(text); ok {
+			return KindInt
+		}
+		if number, err := strconv.ParseFloat(text, 64); err == nil {
+			return NumberKind(number)
+		}
+		if _, ok := ParseTime(text); ok {
+			return KindTime
+		}
+		return KindString
+	default:
+		if _, ok := ToInt(value); ok {
+			return KindInt
+		}
+		if number, ok := ToFloat(value); ok {
+			return NumberKind(number)
+		}
+		return KindString
+	}
+}
+
+// NumberKind tells integers a float64 holds exactly, which fit an int64 field,
+// from other numbers
+func NumberKind(number float64) string {
+	if number == math.Trunc(number) && math.Abs(number) <= maxExactInt {
+		return KindInt
+	}
+	return KindFloat
+}
+
+// hasLeadingZero reports whether text is a number written with leading zeros,
+// e.g. 007
+func hasLeadingZero(text string) bool {
+	text = strings.TrimPrefix(text, "-")
+	return len(text) > 1 && text[0] == '0' && text[1] >= '0' && text[1] <= '9'
+}
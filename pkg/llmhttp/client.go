@@ -0,0 +1,273 @@
+package llmhttp
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+
+	"grafana-mcpclient-datasource/pkg/metrics"
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+// defaultBaseDelay is the first retry delay without Retry-After; it doubles on every retry
+const defaultBaseDelay = 500 * time.Millisecond
+
+// httpClient is shared by all LLM clients so connections to LLM hosts are reused
+// across queries and datasources. Requests are bounded by their contexts, not by a
+// client timeout, so streaming responses are not cut off.
+var httpClient = &http.Client{Transport: newTransport()}
+
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 32
+	return transport
+}
+
+// config holds the settings that shape the shared state of a datasource
+type config struct {
+	requestsPerMinute int
+	tokensPerMinute   int
+	maxRetries        int
+	maxBackoff        time.Duration
+	breakerThreshold  int
+	breakerCooldown   time.Duration
+}
+
+func configFromSettings(settings models.MCPDataSourceSettings) config {
+	return config{
+		requestsPerMinute: settings.LLMRequestsPerMinute,
+		tokensPerMinute:   settings.LLMTokensPerMinute,
+		maxRetries:        settings.GetLLMMaxRetries(),
+		maxBackoff:        settings.GetLLMMaxBackoff(),
+		breakerThreshold:  settings.GetLLMCircuitBreakerThreshold(),
+		breakerCooldown:   settings.GetLLMCircuitBreakerCooldown(),
+	}
+}
+
+// datasourceState is the rate limiter and the circuit breakers (one per LLM host)
+// shared by every query of a datasource
+type datasourceState struct {
+	config   config
+	limiter  *limiter
+	breakers map[string]*breaker
+}
+
+var (
+	statesMu sync.Mutex
+	states   = make(map[string]*datasourceState)
+)
+
+// Client sends the LLM API requests of one datasource to one LLM host
+type Client struct {
+	datasourceUID string
+	host          string
+	limiter       *limiter
+	breaker       *breaker
+	maxRetries    int
+	maxBackoff    time.Duration
+	baseDelay     time.Duration
+	logger        log.Logger
+}
+
+// For returns a client for requests to endpoint. Clients of the same datasource share
+// its rate limits, and clients for the same host also share the circuit breaker. The
+// shared state is reset when the datasource settings change.
+func For(settings models.MCPDataSourceSettings, endpoint string) *Client {
+	cfg := configFromSettings(settings)
+	host := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	statesMu.Lock()
+	defer statesMu.Unlock()
+
+	state, ok := states[settings.DatasourceUID]
+	if !ok || state.config != cfg {
+		state = &datasourceState{
+			config: cfg,
+			limiter: &limiter{
+				requests: newBucket(cfg.requestsPerMinute, time.Now),
+				tokens:   newBucket(cfg.tokensPerMinute, time.Now),
+			},
+			breakers: make(map[string]*breaker),
+		}
+		states[settings.DatasourceUID] = state
+	}
+	b, ok := state.breakers[host]
+	if !ok {
+		b = newBreaker(cfg.breakerThreshold, cfg.breakerCooldown, time.Now)
+		state.breakers[host] = b
+	}
+
+	return &Client{
+		datasourceUID: settings.DatasourceUID,
+		host:          host,
+		limiter:       state.limiter,
+		breaker:       b,
+		maxRetries:    cfg.maxRetries,
+		maxBackoff:    cfg.maxBackoff,
+		baseDelay:     defaultBaseDelay,
+		logger:        log.DefaultLogger,
+	}
+}
+
+// EstimateTokens roughly estimates the prompt tokens of a request body, at about
+// four bytes per token. The estimate is charged against the tokens per minute limit
+// before the request and corrected with ObserveTokens once the usage is known.
+func EstimateTokens(body []byte) int {
+	return len(body)/4 + 1
+}
+
+// Do sends req once the datasource rate limits allow it, retrying with jittered
+// exponential backoff on 429, 529 and 5xx responses. Retry-After is honored as long
+// as it fits within the maximum backoff and the request deadline; otherwise the
+// failing response is returned right away so the caller can fall back. The caller
+// checks the status code of the returned response and closes its body.
+func (c *Client) Do(req *http.Request, estimatedTokens int) (*http.Response, error) {
+	ctx := req.Context()
+	if !c.breaker.allow() {
+		return nil, fmt.Errorf("%w (%s)", ErrCircuitOpen, c.host)
+	}
+	if err := c.limiter.wait(ctx, estimatedTokens); err != nil {
+		c.breaker.release()
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				c.breaker.release()
+			} else {
+				c.recordFailure()
+			}
+			return nil, err
+		}
+		if !retryable(resp.StatusCode) {
+			c.breaker.success()
+			return resp, nil
+		}
+
+		delay, ok := c.retryDelay(req, resp, attempt)
+		if !ok {
+			if resp.StatusCode == http.StatusTooManyRequests {
+				// Rate limiting says nothing about the health of the host
+				c.breaker.release()
+			} else {
+				c.recordFailure()
+			}
+			return resp, nil
+		}
+
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		metrics.ObserveLLMRetry(c.datasourceUID, c.host, resp.StatusCode)
+		c.logger.Debug("Retrying LLM request", "host", c.host, "status", resp.StatusCode, "attempt", attempt+1, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			c.breaker.release()
+			return nil, ctx.Err()
+		}
+
+		// Retries count against the request rate but not again against the token rate
+		if err := c.limiter.wait(ctx, 0); err != nil {
+			c.breaker.release()
+			return nil, err
+		}
+		if req, err = rewind(req); err != nil {
+			c.breaker.release()
+			return nil, err
+		}
+	}
+}
+
+// ObserveTokens corrects the tokens per minute limit with the usage reported by the
+// LLM API for a request sent with estimatedTokens
+func (c *Client) ObserveTokens(estimatedTokens, usedTokens int) {
+	c.limiter.observeTokens(estimatedTokens, usedTokens)
+}
+
+func (c *Client) recordFailure() {
+	if c.breaker.failure() {
+		metrics.ObserveLLMCircuitOpen(c.datasourceUID, c.host)
+		c.logger.Warn("LLM circuit breaker opened", "host", c.host)
+	}
+}
+
+// retryable reports whether a response status is worth retrying: rate limiting (429),
+// overloaded (529) and other server errors
+func retryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// retryDelay returns how long to wait before retrying req, or false when it must not
+// be retried
+func (c *Client) retryDelay(req *http.Request, resp *http.Response, attempt int) (time.Duration, bool) {
+	if attempt >= c.maxRetries || (req.Body != nil && req.GetBody == nil) {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if retryAfter, ok := parseRetryAfter(resp.Header, time.Now()); ok {
+		if retryAfter > c.maxBackoff {
+			return 0, false
+		}
+		// A little jitter keeps clients told the same Retry-After from all coming back at once
+		delay = retryAfter + rand.N(c.baseDelay)
+	} else {
+		backoff := min(c.baseDelay<<attempt, c.maxBackoff)
+		delay = backoff/2 + rand.N(backoff/2+1)
+	}
+
+	if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < delay {
+		return 0, false
+	}
+	return delay, true
+}
+
+// parseRetryAfter reads the delay requested by the server from the retry-after-ms
+// header (OpenAI, Azure) or the standard Retry-After header in seconds or as a date
+func parseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if value := header.Get("retry-after-ms"); value != "" {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// rewind returns a copy of req with a fresh body for another attempt
+func rewind(req *http.Request) (*http.Request, error) {
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewind request body: %w", err)
+		}
+		retry.Body = body
+	}
+	return retry, nil
+}
@@ -0,0 +1,189 @@
+package llmhttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+// newStatusSequenceServer answers with the given statuses in order, repeating the
+// last one, and counts the requests it received
+func newStatusSequenceServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"prompt":"ping"}`, string(body), "every attempt sends the full body")
+
+		call := int(calls.Add(1)) - 1
+		status := statuses[min(call, len(statuses)-1)]
+		for name, values := range header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newTestClient(settings models.MCPDataSourceSettings, endpoint string) *Client {
+	c := For(settings, endpoint)
+	c.baseDelay = time.Millisecond
+	return c
+}
+
+func post(t *testing.T, ctx context.Context, c *Client, url string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString(`{"prompt":"ping"}`))
+	require.NoError(t, err)
+	resp, err := c.Do(req, 10)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	server, calls := newStatusSequenceServer(t, nil, http.StatusInternalServerError, 529, http.StatusOK)
+	c := newTestClient(models.MCPDataSourceSettings{DatasourceUID: t.Name()}, server.URL)
+
+	resp, err := post(t, context.Background(), c, server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	server, calls := newStatusSequenceServer(t, nil, http.StatusBadRequest)
+	c := newTestClient(models.MCPDataSourceSettings{DatasourceUID: t.Name()}, server.URL)
+
+	resp, err := post(t, context.Background(), c, server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestClientGivesUpAfterMaxRetries(t *testing.T) {
+	server, calls := newStatusSequenceServer(t, nil, http.StatusServiceUnavailable)
+	c := newTestClient(models.MCPDataSourceSettings{DatasourceUID: t.Name(), LLMMaxRetries: 2}, server.URL)
+
+	resp, err := post(t, context.Background(), c, server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestClientHonorsRetryAfter(t *testing.T) {
+	server, calls := newStatusSequenceServer(t, http.Header{"Retry-After": {"1"}}, http.StatusTooManyRequests, http.StatusOK)
+	c := newTestClient(models.MCPDataSourceSettings{DatasourceUID: t.Name()}, server.URL)
+
+	start := time.Now()
+	resp, err := post(t, context.Background(), c, server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestClientReturnsWhenRetryAfterIsTooLong(t *testing.T) {
+	server, calls := newStatusSequenceServer(t, http.Header{"Retry-After": {"120"}}, http.StatusTooManyRequests)
+	c := newTestClient(models.MCPDataSourceSettings{DatasourceUID: t.Name()}, server.URL)
+
+	resp, err := post(t, context.Background(), c, server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load(), "waiting beyond the maximum backoff is left to the caller")
+
+	server, calls = newStatusSequenceServer(t, http.Header{"Retry-After": {"5"}}, http.StatusTooManyRequests)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err = post(t, ctx, newTestClient(models.MCPDataSourceSettings{DatasourceUID: t.Name()}, server.URL), server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load(), "waiting beyond the request deadline is pointless")
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	server, calls := newStatusSequenceServer(t, nil, http.StatusInternalServerError)
+	settings := models.MCPDataSourceSettings{DatasourceUID: t.Name(), LLMMaxRetries: -1, LLMCircuitBreakerThreshold: 2}
+	c := newTestClient(settings, server.URL)
+	now := time.Now()
+	c.breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		_, err := post(t, context.Background(), c, server.URL)
+		require.NoError(t, err)
+	}
+
+	_, err := post(t, context.Background(), newTestClient(settings, server.URL), server.URL)
+	require.ErrorIs(t, err, ErrCircuitOpen, "clients for the same host share the breaker")
+	assert.Equal(t, int32(2), calls.Load())
+
+	// After the cooldown a single probe is let through
+	now = now.Add(settings.GetLLMCircuitBreakerCooldown())
+	assert.True(t, c.breaker.allow())
+	assert.False(t, c.breaker.allow(), "only one probe at a time")
+	c.breaker.success()
+	assert.True(t, c.breaker.allow())
+}
+
+func TestClientRateLimit(t *testing.T) {
+	server, calls := newStatusSequenceServer(t, nil, http.StatusOK)
+	c := newTestClient(models.MCPDataSourceSettings{DatasourceUID: t.Name(), LLMRequestsPerMinute: 1}, server.URL)
+
+	_, err := post(t, context.Background(), c, server.URL)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = post(t, ctx, c, server.URL)
+	require.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+	b := newBucket(60, func() time.Time { return now })
+
+	assert.Zero(t, b.reserve(60))
+	assert.Equal(t, time.Second, b.reserve(1))
+	assert.Equal(t, 2*time.Second, b.reserve(1), "waiting requests queue up behind each other")
+
+	now = now.Add(2 * time.Second)
+	assert.Zero(t, b.reserve(0))
+
+	b.adjust(-100)
+	assert.Equal(t, 60.0, b.tokens, "returned tokens never exceed the capacity")
+
+	assert.Nil(t, newBucket(0, time.Now))
+	assert.Zero(t, (*bucket)(nil).reserve(1000), "no limit configured")
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	delay, ok := parseRetryAfter(http.Header{"Retry-After": {"3"}}, now)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, delay)
+
+	delay, ok = parseRetryAfter(http.Header{"Retry-After": {now.Add(10 * time.Second).Format(http.TimeFormat)}}, now)
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Second, delay)
+
+	delay, ok = parseRetryAfter(http.Header{"Retry-After-Ms": {"250"}, "Retry-After": {"1"}}, now)
+	assert.True(t, ok)
+	assert.Equal(t, 250*time.Millisecond, delay)
+
+	_, ok = parseRetryAfter(http.Header{"Retry-After": {"soon"}}, now)
+	assert.False(t, ok)
+}
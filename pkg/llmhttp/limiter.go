@@ -0,0 +1,124 @@
+package llmhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a request cannot get through the datasource rate
+// limit before its context deadline
+var ErrRateLimited = errors.New("LLM rate limit of the datasource exceeded")
+
+// bucket is a token bucket refilled continuously at rate per second up to capacity.
+// Reservations may take the bucket below zero; later callers then wait for the debt
+// to be refilled, which keeps waiting requests in arrival order.
+type bucket struct {
+	mu       sync.Mutex
+	capacity float64
+	rate     float64
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+}
+
+// newBucket returns a full bucket allowing perMinute tokens per minute, or nil
+// when perMinute is not positive (unlimited)
+func newBucket(perMinute int, now func() time.Time) *bucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &bucket{
+		capacity: float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		tokens:   float64(perMinute),
+		last:     now(),
+		now:      now,
+	}
+}
+
+func (b *bucket) refill() {
+	now := b.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+// reserve takes n tokens and returns how long the caller has to wait before using them
+func (b *bucket) reserve(n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// adjust takes n more tokens from the bucket, or returns them when n is negative
+func (b *bucket) adjust(n float64) {
+	if b == nil || n == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	b.tokens -= n
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// limiter limits the requests and tokens per minute of a datasource
+type limiter struct {
+	requests *bucket
+	tokens   *bucket
+}
+
+// wait blocks until a request of estimatedTokens may be sent. Requests that would
+// have to wait beyond the context deadline fail right away with ErrRateLimited.
+func (l *limiter) wait(ctx context.Context, estimatedTokens int) error {
+	requestWait := l.requests.reserve(1)
+	tokenWait := l.tokens.reserve(float64(estimatedTokens))
+	delay := max(requestWait, tokenWait)
+	if delay == 0 {
+		return nil
+	}
+
+	release := func() {
+		l.requests.adjust(-1)
+		l.tokens.adjust(-float64(estimatedTokens))
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		release()
+		return fmt.Errorf("%w: request would have to wait %s", ErrRateLimited, delay.Round(time.Millisecond))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		release()
+		return ctx.Err()
+	}
+}
+
+// observeTokens corrects the token bucket once the actual usage of a request is known
+func (l *limiter) observeTokens(estimatedTokens, usedTokens int) {
+	if usedTokens <= 0 {
+		return
+	}
+	l.tokens.adjust(float64(usedTokens - estimatedTokens))
+}
@@ -0,0 +1,181 @@
+package mcpcontent
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Types of content items
+const (
+	TypeText     = "text"
+	TypeImage    = "image"
+	TypeAudio    = "audio"
+	TypeResource = "resource"
+)
+
+// Item is a piece of the content of a tool result. Embedded resources and the
+// resources behind resource links are both returned as resource items.
+type Item struct {
+	Type     string
+	Text     string // text content, or the contents of a text resource
+	Data     string // base64 encoded data of images, audio and blob resources
+	MIMEType string
+	URI      string
+	Name     string
+}
+
+// ResourceReader reads resources from an MCP server, *client.Client implements it
+type ResourceReader interface {
+	ReadResource(ctx context.Context, request mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error)
+}
+
+// Resolve converts the content of a tool result into items, reading the resources
+// of resource links with reader. Links that cannot be read are skipped and
+// reported in the returned error, along with unsupported content.
+func Resolve(ctx context.Context, reader ResourceReader, contents []mcp.Content) ([]Item, error) {
+	var items []Item
+	var errs []error
+	for _, content := range contents {
+		if text, ok := mcp.AsTextContent(content); ok {
+			items = append(items, Item{Type: TypeText, Text: text.Text})
+			continue
+		}
+		if image, ok := mcp.AsImageContent(content); ok {
+			items = append(items, Item{Type: TypeImage, Data: image.Data, MIMEType: image.MIMEType})
+			continue
+		}
+		if audio, ok := mcp.AsAudioContent(content); ok {
+			items = append(items, Item{Type: TypeAudio, Data: audio.Data, MIMEType: audio.MIMEType})
+			continue
+		}
+		if resource, ok := mcp.AsEmbeddedResource(content); ok {
+			items = append(items, resourceItem(resource.Resource, ""))
+			continue
+		}
+		if link, ok := asResourceLink(content); ok {
+			linked, err := readLink(ctx, reader, link)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			items = append(items, linked...)
+			continue
+		}
+		errs = append(errs, fmt.Errorf("unsupported content type %T", content))
+	}
+	return items, errors.Join(errs...)
+}
+
+// asResourceLink returns content as a resource link, mcp has no As helper for it
+func asResourceLink(content mcp.Content) (mcp.ResourceLink, bool) {
+	switch link := content.(type) {
+	case mcp.ResourceLink:
+		return link, true
+	case *mcp.ResourceLink:
+		return *link, true
+	default:
+		return mcp.ResourceLink{}, false
+	}
+}
+
+// readLink reads the resource a resource link points to
+func readLink(ctx context.Context, reader ResourceReader, link mcp.ResourceLink) ([]Item, error) {
+	if reader == nil {
+		return nil, fmt.Errorf("cannot read linked resource %s", link.URI)
+	}
+	result, err := reader.ReadResource(ctx, mcp.ReadResourceRequest{
+		Params: mcp.ReadResourceParams{URI: link.URI},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read linked resource %s: %w", link.URI, err)
+	}
+
+	items := make([]Item, 0, len(result.Contents))
+	for _, contents := range result.Contents {
+		item := resourceItem(contents, link.Name)
+		if item.MIMEType == "" {
+			item.MIMEType = link.MIMEType
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// resourceItem converts the contents of a resource into an item
+func resourceItem(contents mcp.ResourceContents, name string) Item {
+	item := Item{Type: TypeResource, Name: name}
+	if text, ok := mcp.AsTextResourceContents(contents); ok {
+		item.Text, item.URI, item.MIMEType = text.Text, text.URI, text.MIMEType
+	} else if blob, ok := mcp.AsBlobResourceContents(contents); ok {
+		item.Data, item.URI, item.MIMEType = blob.Blob, blob.URI, blob.MIMEType
+	}
+	if item.Name == "" {
+		item.Name = resourceName(item.URI)
+	}
+	return item
+}
+
+// resourceName returns the last path segment of a resource URI
+func resourceName(uri string) string {
+	uri = strings.TrimRight(uri, "/")
+	if i := strings.LastIndexAny(uri, "/:"); i >= 0 {
+		uri = uri[i+1:]
+	}
+	return uri
+}
+
+// IsMedia reports whether the item is an image or audio, which are only shown,
+// never passed to the LLM
+func (i Item) IsMedia() bool {
+	return i.Type == TypeImage || i.Type == TypeAudio || i.Type == TypeResource && strings.HasPrefix(i.mediaType(), "image/")
+}
+
+// DataURL returns the data of the item as a data URL, e.g. for an image cell
+func (i Item) DataURL() string {
+	mimeType := i.MIMEType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return "data:" + mimeType + ";base64," + i.Data
+}
+
+// AsText returns the text of text items and text resources, decoding text blobs.
+// Media and binary resources have no text.
+func (i Item) AsText() (string, bool) {
+	if i.IsMedia() {
+		return "", false
+	}
+	content, err := i.Content()
+	if err != nil || i.Data != "" && (!isTextType(i.mediaType()) || !utf8.ValidString(content)) {
+		return "", false
+	}
+	return content, true
+}
+
+// Content returns the contents of a resource as text, decoding blobs
+func (i Item) Content() (string, error) {
+	if i.Data == "" {
+		return i.Text, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(i.Data)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 data of %s: %w", i.URI, err)
+	}
+	return string(decoded), nil
+}
+
+// mediaType returns the MIME type of the item without parameters, in lower case
+func (i Item) mediaType() string {
+	mediaType, _, err := mime.ParseMediaType(i.MIMEType)
+	if err != nil {
+		return strings.ToLower(i.MIMEType)
+	}
+	return mediaType
+}
@@ -0,0 +1,80 @@
+package mcpcontent
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReader serves text resources by URI
+type fakeReader map[string]mcp.TextResourceContents
+
+func (r fakeReader) ReadResource(_ context.Context, request mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	contents, ok := r[request.Params.URI]
+	if !ok {
+		return nil, errors.New("resource not found")
+	}
+	return &mcp.ReadResourceResult{Contents: []mcp.ResourceContents{contents}}, nil
+}
+
+func TestResolve(t *testing.T) {
+	reader := fakeReader{
+		"reports://errors.csv": {URI: "reports://errors.csv", Text: "service,errors\napi,3\n"},
+	}
+	contents := []mcp.Content{
+		mcp.NewTextContent("2 attachments"),
+		mcp.NewImageContent("iVBORw0KGgo=", "image/png"),
+		mcp.NewEmbeddedResource(mcp.TextResourceContents{URI: "file:///tmp/hosts.json", MIMEType: "application/json", Text: `[{"host":"a"}]`}),
+		mcp.NewResourceLink("reports://errors.csv", "errors.csv", "", "text/csv"),
+		mcp.NewResourceLink("reports://missing.csv", "missing.csv", "", "text/csv"),
+	}
+
+	items, err := Resolve(context.Background(), reader, contents)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "reports://missing.csv")
+
+	require.Len(t, items, 4)
+	assert.Equal(t, Item{Type: TypeText, Text: "2 attachments"}, items[0])
+	assert.True(t, items[1].IsMedia())
+	assert.Equal(t, "data:image/png;base64,iVBORw0KGgo=", items[1].DataURL())
+	assert.Equal(t, Item{Type: TypeResource, Name: "hosts.json", URI: "file:///tmp/hosts.json", MIMEType: "application/json", Text: `[{"host":"a"}]`}, items[2])
+	assert.Equal(t, Item{Type: TypeResource, Name: "errors.csv", URI: "reports://errors.csv", MIMEType: "text/csv", Text: "service,errors\napi,3\n"}, items[3], "the link supplies the missing MIME type")
+}
+
+func TestFrame(t *testing.T) {
+	blob := func(text string) string { return base64.StdEncoding.EncodeToString([]byte(text)) }
+
+	image, err := Frame(Item{Type: TypeImage, Data: "iVBORw0KGgo=", MIMEType: "image/png"})
+	require.NoError(t, err)
+	assert.Equal(t, "image", image.Name)
+	assert.Equal(t, "data:image/png;base64,iVBORw0KGgo=", image.Fields[0].At(0))
+	assert.Equal(t, map[string]interface{}{"type": "image"}, image.Fields[0].Config.Custom["cellOptions"])
+
+	dump, err := Frame(Item{Type: TypeResource, Name: "dump", MIMEType: "application/octet-stream", URI: "file:///dump", Data: blob("\x00\x01")})
+	require.NoError(t, err)
+	assert.Equal(t, "dump", dump.Name)
+	assert.Equal(t, int64(2), dump.Fields[2].At(0))
+
+	// Text is structured by the caller
+	for _, item := range []Item{
+		{Type: TypeText, Text: "text"},
+		{Type: TypeResource, Name: "errors", MIMEType: "text/csv; charset=utf-8", Data: blob("service,errors\napi,3\n")},
+	} {
+		frame, err := Frame(item)
+		require.NoError(t, err)
+		assert.Nil(t, frame)
+	}
+}
+
+func TestIsData(t *testing.T) {
+	assert.True(t, Item{MIMEType: "application/json"}.IsData())
+	assert.True(t, Item{MIMEType: "text/csv; charset=utf-8"}.IsData())
+	assert.True(t, Item{MIMEType: "application/x-ndjson"}.IsData())
+	assert.False(t, Item{MIMEType: "text/plain"}.IsData())
+	assert.False(t, Item{}.IsData())
+}
@@ -0,0 +1,77 @@
+package mcpcontent
+
+import (
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Frame converts an image, audio or binary resource item into a frame named after
+// its resource: images and audio into data URL fields, binary resources into their
+// URI, MIME type and size. Text items and text resources have no frame of their
+// own, they are structured like the text of the result, so Frame returns nil for
+// them.
+func Frame(item Item) (*data.Frame, error) {
+	name := item.FrameName()
+	if item.IsMedia() {
+		return mediaFrame(name, item), nil
+	}
+	if _, ok := item.AsText(); ok {
+		return nil, nil
+	}
+
+	decoded, err := item.Content()
+	if err != nil {
+		return nil, err
+	}
+	return data.NewFrame(name,
+		data.NewField("uri", nil, []string{item.URI}),
+		data.NewField("mime_type", nil, []string{item.MIMEType}),
+		data.NewField("size", nil, []int64{int64(len(decoded))}),
+	), nil
+}
+
+// FrameName returns the name of the frames of the item: the name of its resource,
+// or else its type
+func (i Item) FrameName() string {
+	if i.Name == "" {
+		return i.Type
+	}
+	return i.Name
+}
+
+// IsData reports whether the MIME type of the item declares data in a format with
+// rows, JSON, NDJSON, CSV or TSV, rather than free text
+func (i Item) IsData() bool {
+	mediaType := i.mediaType()
+	return isJSONType(mediaType) || isNDJSONType(mediaType) || mediaType == "text/csv" || mediaType == "text/tab-separated-values"
+}
+
+// mediaFrame returns a frame with the data URL of an image or audio item. Images
+// are shown as images in table cells.
+func mediaFrame(name string, item Item) *data.Frame {
+	field := data.NewField(item.Type, nil, []string{item.DataURL()})
+	if item.Type != TypeAudio {
+		field.Name = TypeImage
+		field.Config = &data.FieldConfig{Custom: map[string]interface{}{
+			"cellOptions": map[string]interface{}{"type": "image"},
+		}}
+	}
+	return data.NewFrame(name, field, data.NewField("mime_type", nil, []string{item.MIMEType}))
+}
+
+func isJSONType(mediaType string) bool {
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isNDJSONType(mediaType string) bool {
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines", "application/jsonlines":
+		return true
+	}
+	return false
+}
+
+func isTextType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") || isJSONType(mediaType) || isNDJSONType(mediaType) || mediaType == ""
+}
@@ -0,0 +1,529 @@
+package mcpcontent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"grafana-mcpclient-datasource/pkg/conv"
+	"grafana-mcpclient-datasource/pkg/structuring"
+)
+
+// Keywords of output schema properties that carry the unit of a field. JSON Schema
+// has no unit keyword, so the common extensions are accepted.
+var unitKeywords = []string{"x-unit", "unit", "x-grafana-unit"}
+
+// maxExactInteger is 2^53; from there on a float64 no longer holds every integer,
+// so a decoded value may have been rounded
+const maxExactInteger = 1 << 53
+
+// Structured is the structuredContent of a tool result
+type Structured struct {
+	// Content is the decoded structuredContent
+	Content interface{}
+
+	// Document is the text content holding the same JSON document, or empty if the
+	// tool returned none. It gives the order of the keys, which Content loses.
+	Document string
+}
+
+// StructuredContent returns the structuredContent of a tool result, or nil if it
+// has none. Its numbers are json.Number, so integers above 2^53 keep all their
+// digits. The client decodes structuredContent with float64 numbers, so they are
+// taken from a text content that holds the same document, which tools are
+// expected to return for compatibility. Without one, the float64 numbers are
+// returned.
+func StructuredContent(result *mcp.CallToolResult) *Structured {
+	if result == nil || result.StructuredContent == nil {
+		return nil
+	}
+	for _, content := range result.Content {
+		text, ok := mcp.AsTextContent(content)
+		if !ok {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(text.Text))
+		decoder.UseNumber()
+		var exact interface{}
+		if err := decoder.Decode(&exact); err != nil || decoder.More() {
+			continue
+		}
+		if reflect.DeepEqual(floatNumbers(exact), result.StructuredContent) {
+			return &Structured{Content: exact, Document: text.Text}
+		}
+	}
+	return &Structured{Content: result.StructuredContent}
+}
+
+// floatNumbers returns a copy of v with its json.Number values as float64, the
+// way the client decodes them
+func floatNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		f, err := value.Float64()
+		if err != nil {
+			return value
+		}
+		return f
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			converted[key] = floatNumbers(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for i, item := range value {
+			converted[i] = floatNumbers(item)
+		}
+		return converted
+	default:
+		return v
+	}
+}
+
+// StructuredFrame builds a frame from the structuredContent of a tool result. An
+// object with a single array of objects gives a row per element, with the other
+// properties in the frame metadata; any other object gives a single row.
+//
+// Field types, units and display names come from outputSchema, the tool's declared
+// output schema as returned by OutputSchema, which may be nil; without it the
+// types are inferred from the values. Declared properties come first in the order
+// of the schema, followed by the other keys in the order of the document. Values
+// that do not match their declared type are left empty and reported in the
+// returned error.
+func StructuredFrame(name string, structured *Structured, outputSchema json.RawMessage) (*data.Frame, error) {
+	if structured == nil {
+		return nil, errors.New("no structured content")
+	}
+	var root map[string]interface{}
+	if len(outputSchema) > 0 {
+		if err := json.Unmarshal(outputSchema, &root); err != nil {
+			return nil, fmt.Errorf("invalid output schema: %w", err)
+		}
+	}
+	schema := &schemaResolver{root: root}
+	rows, rowSchema, extra, err := structuredRows(structured.Content, schema.resolve(root))
+	if err != nil {
+		return nil, err
+	}
+	rowSchema = schema.resolve(rowSchema)
+	properties, _ := rowSchema["properties"].(map[string]interface{})
+
+	frame := data.NewFrame(name)
+	if len(extra) > 0 {
+		frame.Meta = &data.FrameMeta{Custom: extra}
+	}
+
+	var errs []error
+	propertyOrder := declaredOrder(outputSchema, properties)
+	for _, column := range structuredColumns(rows, propertyOrder, structuring.KeyOrder(structured.Document)) {
+		values := make([]interface{}, len(rows))
+		for i, row := range rows {
+			values[i] = row[column]
+		}
+		propertySchema, _ := properties[column].(map[string]interface{})
+		field, err := schemaField(column, values, schema.resolve(propertySchema))
+		if err != nil {
+			errs = append(errs, err)
+		}
+		frame.Fields = append(frame.Fields, field)
+	}
+	return frame, errors.Join(errs...)
+}
+
+// structuredRows finds the rows of structured content and the schema of a row
+func structuredRows(content interface{}, schema map[string]interface{}) ([]map[string]interface{}, map[string]interface{}, map[string]interface{}, error) {
+	switch v := content.(type) {
+	case []interface{}:
+		items, _ := schema["items"].(map[string]interface{})
+		return objectRows(v), items, nil, nil
+	case map[string]interface{}:
+		// An object wrapping a single array of objects, e.g. {"series": [...], "total": 3}
+		var arrayKey string
+		for key, value := range v {
+			if array, ok := value.([]interface{}); ok && len(array) > 0 && isObjectArray(array) {
+				if arrayKey != "" {
+					arrayKey = ""
+					break
+				}
+				arrayKey = key
+			}
+		}
+		if arrayKey == "" {
+			return []map[string]interface{}{v}, schema, nil, nil
+		}
+
+		extra := make(map[string]interface{})
+		for key, value := range v {
+			if key != arrayKey {
+				extra[key] = value
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		arraySchema, _ := properties[arrayKey].(map[string]interface{})
+		items, _ := arraySchema["items"].(map[string]interface{})
+		return objectRows(v[arrayKey].([]interface{})), items, extra, nil
+	default:
+		return nil, nil, nil, fmt.Errorf("structured content is %T, not an object or array", content)
+	}
+}
+
+func isObjectArray(array []interface{}) bool {
+	for _, element := range array {
+		if _, ok := element.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// objectRows returns the elements of an array as rows, wrapping values that are
+// not objects in a "value" column
+func objectRows(array []interface{}) []map[string]interface{} {
+	rows := make([]map[string]interface{}, len(array))
+	for i, element := range array {
+		if object, ok := element.(map[string]interface{}); ok {
+			rows[i] = object
+		} else {
+			rows[i] = map[string]interface{}{"value": element}
+		}
+	}
+	return rows
+}
+
+// declaredOrder returns the names of properties in the order they are written in
+// the output schema. The "properties" objects of the schema are decoded in no
+// particular order, so the one holding exactly these names is looked up in the
+// raw schema. Without one, the names are in alphabetical order.
+func declaredOrder(outputSchema json.RawMessage, properties map[string]interface{}) []string {
+	var order []string
+	for _, names := range propertyLists(outputSchema) {
+		if len(names) != len(properties) {
+			continue
+		}
+		matches := true
+		for _, name := range names {
+			if _, ok := properties[name]; !ok {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			order = names
+			break
+		}
+	}
+	if order != nil {
+		return order
+	}
+
+	order = make([]string, 0, len(properties))
+	for name := range properties {
+		order = append(order, name)
+	}
+	sort.Strings(order)
+	return order
+}
+
+// propertyLists returns the names of every "properties" object of a JSON schema,
+// each in the order they are written
+func propertyLists(schema json.RawMessage) [][]string {
+	var lists [][]string
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(schema, &object); err == nil {
+		for key, value := range object {
+			if key == "properties" {
+				lists = append(lists, structuring.ObjectKeys(string(value)))
+			}
+			lists = append(lists, propertyLists(value)...)
+		}
+		return lists
+	}
+	var array []json.RawMessage
+	if err := json.Unmarshal(schema, &array); err == nil {
+		for _, element := range array {
+			lists = append(lists, propertyLists(element)...)
+		}
+	}
+	return lists
+}
+
+// structuredColumns returns the declared properties followed by the undeclared
+// keys found in the rows, in the order they first appear in documentOrder. Keys
+// missing from documentOrder follow in alphabetical order.
+func structuredColumns(rows []map[string]interface{}, declared []string, documentOrder []string) []string {
+	columns := append([]string(nil), declared...)
+	seen := make(map[string]bool, len(declared))
+	for _, key := range declared {
+		seen[key] = true
+	}
+
+	inRows := make(map[string]bool)
+	for _, row := range rows {
+		for key := range row {
+			inRows[key] = true
+		}
+	}
+	for _, key := range documentOrder {
+		if inRows[key] && !seen[key] {
+			seen[key] = true
+			columns = append(columns, key)
+		}
+	}
+
+	var missing []string
+	for key := range inRows {
+		if !seen[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return append(columns, missing...)
+}
+
+// schemaField returns the field for a column typed by its property schema. Columns
+// without a declared type get the type inferred from their values, the way every
+// other structured result does.
+func schemaField(name string, values []interface{}, schema map[string]interface{}) (*data.Field, error) {
+	var field *data.Field
+	var invalid int
+	var errs []error
+	switch schemaType(schema) {
+	case "integer":
+		field, invalid = integerField(name, values)
+	case "number":
+		field, invalid = numberField(name, values)
+	case "boolean":
+		field, invalid = booleanField(name, values)
+	case "string":
+		switch schema["format"] {
+		case "date-time":
+			field, invalid = timeField(name, values, time.RFC3339Nano)
+		case "date":
+			field, invalid = timeField(name, values, time.DateOnly)
+		default:
+			field = stringField(name, values)
+		}
+	case "object", "array":
+		field = stringField(name, values)
+	default:
+		var notices []data.Notice
+		field, notices = conv.InferField(name, values)
+		for _, notice := range notices {
+			errs = append(errs, errors.New(notice.Text))
+		}
+	}
+	field.Config = schemaFieldConfig(schema)
+
+	if invalid > 0 {
+		errs = append(errs, fmt.Errorf("%d values of %s do not match the declared type %s", invalid, name, schemaType(schema)))
+	}
+	return field, errors.Join(errs...)
+}
+
+// schemaType returns the declared type of a property, ignoring "null" in type lists
+func schemaType(schema map[string]interface{}) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, element := range t {
+			if s, ok := element.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// schemaFieldConfig returns the unit, display name and description of a property
+func schemaFieldConfig(schema map[string]interface{}) *data.FieldConfig {
+	var config data.FieldConfig
+	for _, keyword := range unitKeywords {
+		if unit, ok := schema[keyword].(string); ok && unit != "" {
+			config.Unit = unit
+			break
+		}
+	}
+	config.DisplayName, _ = schema["title"].(string)
+	config.Description, _ = schema["description"].(string)
+	if config.Unit == "" && config.DisplayName == "" && config.Description == "" {
+		return nil
+	}
+	return &config
+}
+
+func integerField(name string, values []interface{}) (*data.Field, int) {
+	field := make([]*int64, len(values))
+	invalid := 0
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+		case json.Number:
+			n, err := strconv.ParseInt(v.String(), 10, 64)
+			if err != nil {
+				// Integers may also be written with a fraction or an exponent, e.g. 1e3
+				f, ferr := v.Float64()
+				if ferr != nil || f != math.Trunc(f) || math.Abs(f) >= maxExactInteger {
+					invalid++
+					continue
+				}
+				n = int64(f)
+			}
+			field[i] = &n
+		case float64:
+			// From 2^53 on the value may have been rounded when it was decoded, and
+			// it may not fit an int64
+			if v != math.Trunc(v) || math.Abs(v) >= maxExactInteger {
+				invalid++
+				continue
+			}
+			n := int64(v)
+			field[i] = &n
+		case string:
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				invalid++
+				continue
+			}
+			field[i] = &n
+		default:
+			invalid++
+		}
+	}
+	return data.NewField(name, nil, field), invalid
+}
+
+func numberField(name string, values []interface{}) (*data.Field, int) {
+	field := make([]*float64, len(values))
+	invalid := 0
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+		case json.Number:
+			n, err := v.Float64()
+			if err != nil {
+				invalid++
+				continue
+			}
+			field[i] = &n
+		case float64:
+			field[i] = &v
+		case string:
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				invalid++
+				continue
+			}
+			field[i] = &n
+		default:
+			invalid++
+		}
+	}
+	return data.NewField(name, nil, field), invalid
+}
+
+func booleanField(name string, values []interface{}) (*data.Field, int) {
+	field := make([]*bool, len(values))
+	invalid := 0
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+		case bool:
+			field[i] = &v
+		default:
+			invalid++
+		}
+	}
+	return data.NewField(name, nil, field), invalid
+}
+
+func timeField(name string, values []interface{}, layout string) (*data.Field, int) {
+	field := make([]*time.Time, len(values))
+	invalid := 0
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		text, ok := value.(string)
+		if !ok {
+			invalid++
+			continue
+		}
+		t, err := time.Parse(layout, text)
+		if err != nil {
+			invalid++
+			continue
+		}
+		field[i] = &t
+	}
+	return data.NewField(name, nil, field), invalid
+}
+
+// stringField returns values as text, encoding values that are not strings as JSON
+func stringField(name string, values []interface{}) *data.Field {
+	field := make([]*string, len(values))
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		text, ok := value.(string)
+		if !ok {
+			encoded, _ := json.Marshal(value)
+			text = string(encoded)
+		}
+		field[i] = &text
+	}
+	return data.NewField(name, nil, field)
+}
+
+// OutputSchema returns the output schema of tool as written, or nil if it declares
+// none
+func OutputSchema(tool mcp.Tool) json.RawMessage {
+	if tool.RawOutputSchema != nil {
+		return tool.RawOutputSchema
+	}
+	if tool.OutputSchema.Type == "" {
+		return nil
+	}
+	raw, err := json.Marshal(tool.OutputSchema)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// schemaResolver resolves local references ("#/$defs/...") of an output schema
+type schemaResolver struct {
+	root map[string]interface{}
+}
+
+func (r *schemaResolver) resolve(schema map[string]interface{}) map[string]interface{} {
+	for depth := 0; depth < 10; depth++ {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+		target := interface{}(r.root)
+		for _, segment := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			object, _ := target.(map[string]interface{})
+			target = object[segment]
+		}
+		resolved, ok := target.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		schema = resolved
+	}
+	return schema
+}
@@ -0,0 +1,157 @@
+package mcpcontent
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeJSON(t *testing.T, text string) map[string]interface{} {
+	t.Helper()
+	var value map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(text), &value))
+	return value
+}
+
+func TestStructuredFrameWithSchema(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"series": {"type": "array", "items": {"$ref": "#/$defs/point"}},
+			"total": {"type": "integer"}
+		},
+		"$defs": {
+			"point": {
+				"type": "object",
+				"properties": {
+					"time": {"type": "string", "format": "date-time"},
+					"latency": {"type": ["number", "null"], "x-unit": "ms", "title": "Latency"},
+					"requests": {"type": "integer"},
+					"labels": {"type": "object"}
+				}
+			}
+		}
+	}`)
+	content := &Structured{Content: decodeJSON(t, `{
+		"total": 2,
+		"series": [
+			{"time": "2025-01-01T12:00:00.123456789Z", "latency": 12.5, "requests": 42, "labels": {"job": "api"}},
+			{"time": "2025-01-01T12:01:00Z", "latency": null, "requests": "17", "extra": true}
+		]
+	}`)}
+
+	frame, err := StructuredFrame("query_range", content, schema)
+	require.NoError(t, err)
+	assert.Equal(t, "query_range", frame.Name)
+	assert.Equal(t, map[string]interface{}{"total": float64(2)}, frame.Meta.Custom)
+
+	names := make([]string, len(frame.Fields))
+	for i, field := range frame.Fields {
+		names[i] = field.Name
+	}
+	assert.Equal(t, []string{"time", "latency", "requests", "labels", "extra"}, names)
+
+	timestamps, latency, requests, labels := frame.Fields[0], frame.Fields[1], frame.Fields[2], frame.Fields[3]
+	assert.Equal(t, data.FieldTypeNullableString, labels.Type())
+	assert.Equal(t, `{"job":"api"}`, *labels.At(0).(*string))
+
+	assert.Equal(t, data.FieldTypeNullableFloat64, latency.Type())
+	assert.Equal(t, "ms", latency.Config.Unit)
+	assert.Equal(t, "Latency", latency.Config.DisplayName)
+	assert.Nil(t, latency.At(1))
+
+	assert.Equal(t, data.FieldTypeNullableInt64, requests.Type())
+	assert.Equal(t, int64(17), *requests.At(1).(*int64))
+
+	assert.Equal(t, data.FieldTypeNullableTime, timestamps.Type())
+	assert.Equal(t, time.Date(2025, 1, 1, 12, 0, 0, 123456789, time.UTC), *timestamps.At(0).(*time.Time), "timestamps keep their precision")
+}
+
+func TestStructuredFrameReportsMismatches(t *testing.T) {
+	schema := json.RawMessage(`{"type": "object", "properties": {"count": {"type": "integer"}, "up": {"type": "boolean"}}}`)
+	frame, err := StructuredFrame("status", &Structured{Content: decodeJSON(t, `{"count": "many", "up": true}`)}, schema)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 values of count do not match the declared type integer")
+	require.NotNil(t, frame)
+	assert.Equal(t, 1, frame.Rows())
+	assert.Nil(t, frame.Fields[0].At(0))
+}
+
+func TestStructuredContentKeepsLargeIntegers(t *testing.T) {
+	text := `{"id": 9007199254740993, "bytes": 1.5e3, "ratio": 0.5}`
+	result := mcp.NewToolResultStructured(decodeJSON(t, text), text)
+	schema := json.RawMessage(`{"type": "object", "properties": {"id": {"type": "integer"}, "bytes": {"type": "integer"}, "ratio": {"type": "number"}}}`)
+
+	frame, err := StructuredFrame("object", StructuredContent(result), schema)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9007199254740993), *frame.Fields[0].At(0).(*int64))
+	assert.Equal(t, int64(1500), *frame.Fields[1].At(0).(*int64))
+	assert.Equal(t, 0.5, *frame.Fields[2].At(0).(*float64))
+
+	// Without a schema, and for undeclared properties, integers stay exact too
+	frame, err = StructuredFrame("object", StructuredContent(result), nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9007199254740993), *frame.Fields[0].At(0).(*int64))
+
+	// Without the text, integers that may have been rounded are reported
+	result.Content = nil
+	frame, err = StructuredFrame("object", StructuredContent(result), schema)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 values of id do not match the declared type integer")
+	assert.Nil(t, frame.Fields[0].At(0))
+
+	// Text that is not the same document is not used
+	result.Content = []mcp.Content{mcp.NewTextContent(`{"id": 1}`)}
+	assert.Equal(t, &Structured{Content: result.StructuredContent}, StructuredContent(result))
+}
+
+func TestStructuredFrameKeepsSourceOrder(t *testing.T) {
+	text := `{"rows": [{"zone": "eu", "status": "up", "host": "a", "region": "west", "count": 3}]}`
+	result := mcp.NewToolResultStructured(decodeJSON(t, text), text)
+	schema := json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"rows": {
+				"type": "array",
+				"items": {
+					"type": "object",
+					"properties": {"zone": {"type": "string"}, "status": {"type": "string"}, "host": {"type": "string"}}
+				}
+			}
+		}
+	}`)
+
+	frame, err := StructuredFrame("hosts", StructuredContent(result), schema)
+	require.NoError(t, err)
+	names := make([]string, len(frame.Fields))
+	for i, field := range frame.Fields {
+		names[i] = field.Name
+	}
+	assert.Equal(t, []string{"zone", "status", "host", "region", "count"}, names, "declared properties in schema order, then the others in document order")
+}
+
+func TestStructuredFrameWithoutSchema(t *testing.T) {
+	frame, err := StructuredFrame("hosts", &Structured{Content: decodeJSON(t, `{"hosts": [{"name": "a", "cpu": 0.5}, {"name": "b", "cpu": 0.25}], "page": {"next": null}}`)}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, frame.Rows())
+	assert.Equal(t, data.FieldTypeNullableFloat64, frame.Fields[0].Type())
+
+	_, err = StructuredFrame("scalar", &Structured{Content: "text"}, nil)
+	assert.Error(t, err)
+}
+
+func TestOutputSchema(t *testing.T) {
+	assert.Nil(t, OutputSchema(mcp.NewTool("plain")))
+
+	tool := mcp.NewTool("raw", mcp.WithRawOutputSchema(json.RawMessage(`{"type":"object","properties":{"n":{"type":"integer"}}}`)))
+	assert.JSONEq(t, `{"type":"object","properties":{"n":{"type":"integer"}}}`, string(OutputSchema(tool)))
+
+	var decoded mcp.Tool
+	require.NoError(t, json.Unmarshal([]byte(`{"name":"listed","inputSchema":{"type":"object"},"outputSchema":{"type":"object","properties":{"n":{"type":"integer"}}}}`), &decoded))
+	assert.Contains(t, string(OutputSchema(decoded)), `"n"`)
+}
@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// All collectors are registered with the default Prometheus registerer, which is
+// the registry the plugin SDK exposes through the plugin metrics endpoint.
+const (
+	namespace = "grafana_plugin"
+	subsystem = "mcpclient"
+)
+
+// Status label values shared by the collectors
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Unknown is the label value recorded for client-supplied values outside the
+// known set, so that they cannot grow the label set
+const Unknown = "unknown"
+
+var (
+	// QueriesTotal counts processed queries by query type and status
+	QueriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "queries_total",
+		Help:      "Total number of queries processed, by query type and status.",
+	}, []string{"datasource_uid", "query_type", "status"})
+
+	// ToolCallDuration tracks the latency of MCP tool calls per tool
+	ToolCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "tool_call_duration_seconds",
+		Help:      "Duration of MCP tool calls in seconds, by tool and status.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"datasource_uid", "tool", "status"})
+
+	// LLMTokensTotal counts tokens consumed by LLM providers
+	LLMTokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "llm_tokens_total",
+		Help:      "Total number of LLM tokens used, by provider, model and token type (input, output).",
+	}, []string{"datasource_uid", "provider", "model", "type"})
+
+	// LLMRetriesTotal counts LLM HTTP requests retried after a 429, 529 or 5xx response
+	LLMRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "llm_retries_total",
+		Help:      "Total number of retried LLM HTTP requests, by host and response status code.",
+	}, []string{"datasource_uid", "host", "status_code"})
+
+	// LLMCircuitOpensTotal counts how often the circuit breaker of an LLM host opened
+	LLMCircuitOpensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "llm_circuit_opens_total",
+		Help:      "Total number of times the circuit breaker of an LLM host opened.",
+	}, []string{"datasource_uid", "host"})
+
+	// SyntaxFixAttemptsTotal counts FixQuerySyntax retries made by the agent
+	SyntaxFixAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "syntax_fix_attempts_total",
+		Help:      "Total number of agent retry attempts that asked the LLM to fix query syntax, by status.",
+	}, []string{"datasource_uid", "status"})
+
+	// CacheLookupsTotal counts cache lookups; the hit ratio is hits / (hits + misses)
+	CacheLookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "cache_lookups_total",
+		Help:      "Total number of cache lookups, by cache and result (hit, miss).",
+	}, []string{"datasource_uid", "cache", "result"})
+
+	// ConnectionAttemptsTotal counts attempts to create an MCP client connection
+	ConnectionAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "connection_attempts_total",
+		Help:      "Total number of MCP server connection attempts, by status.",
+	}, []string{"datasource_uid", "status"})
+
+	// ReconnectsTotal counts connections made after the previous one was dropped on a
+	// transport error
+	ReconnectsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "reconnects_total",
+		Help:      "Total number of MCP server reconnects.",
+	}, []string{"datasource_uid"})
+)
+
+// queryTypes are the query type label values; other query types are recorded as
+// Unknown
+var queryTypes = map[string]bool{
+	"natural_language": true,
+	"tool_call":        true,
+	"list_tools":       true,
+	"invalid":          true,
+}
+
+// Cache label values
+const (
+	CacheGeneratedToolCall = "generated_tool_call"
+	CacheTools             = "tools"
+)
+
+// statusFromError maps an error to a status label value
+func statusFromError(err error) string {
+	if err != nil {
+		return StatusError
+	}
+	return StatusOK
+}
+
+// ObserveQuery records a processed query under its query type label
+func ObserveQuery(datasourceUID, queryType string, err error) {
+	if queryType == "" {
+		queryType = "natural_language"
+	}
+	if !queryTypes[queryType] {
+		queryType = Unknown
+	}
+	QueriesTotal.WithLabelValues(datasourceUID, queryType, statusFromError(err)).Inc()
+}
+
+// ObserveToolCall records the latency of a single MCP tool call
+func ObserveToolCall(datasourceUID, tool string, start time.Time, success bool) {
+	status := StatusOK
+	if !success {
+		status = StatusError
+	}
+	ToolCallDuration.WithLabelValues(datasourceUID, tool, status).Observe(time.Since(start).Seconds())
+}
+
+// ObserveLLMTokens records input and output token usage reported by an LLM provider
+func ObserveLLMTokens(datasourceUID, provider, model string, inputTokens, outputTokens int) {
+	if inputTokens > 0 {
+		LLMTokensTotal.WithLabelValues(datasourceUID, provider, model, "input").Add(float64(inputTokens))
+	}
+	if outputTokens > 0 {
+		LLMTokensTotal.WithLabelValues(datasourceUID, provider, model, "output").Add(float64(outputTokens))
+	}
+}
+
+// ObserveLLMRetry records an LLM HTTP request retried after a response with statusCode
+func ObserveLLMRetry(datasourceUID, host string, statusCode int) {
+	LLMRetriesTotal.WithLabelValues(datasourceUID, host, strconv.Itoa(statusCode)).Inc()
+}
+
+// ObserveLLMCircuitOpen records the circuit breaker of an LLM host opening
+func ObserveLLMCircuitOpen(datasourceUID, host string) {
+	LLMCircuitOpensTotal.WithLabelValues(datasourceUID, host).Inc()
+}
+
+// ObserveSyntaxFixAttempt records a single FixQuerySyntax retry
+func ObserveSyntaxFixAttempt(datasourceUID string, err error) {
+	SyntaxFixAttemptsTotal.WithLabelValues(datasourceUID, statusFromError(err)).Inc()
+}
+
+// ObserveCacheLookup records a cache hit or miss
+func ObserveCacheLookup(datasourceUID, cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheLookupsTotal.WithLabelValues(datasourceUID, cache, result).Inc()
+}
+
+// ObserveConnection records an MCP connection attempt; reconnect marks attempts
+// made after the previous client was dropped on a transport error
+func ObserveConnection(datasourceUID string, err error, reconnect bool) {
+	ConnectionAttemptsTotal.WithLabelValues(datasourceUID, statusFromError(err)).Inc()
+	if reconnect && err == nil {
+		ReconnectsTotal.WithLabelValues(datasourceUID).Inc()
+	}
+}
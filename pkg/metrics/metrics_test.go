@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveQuery(t *testing.T) {
+	ObserveQuery("ds-query", "tool_call", nil)
+	ObserveQuery("ds-query", "tool_call", errors.New("boom"))
+	ObserveQuery("ds-query", "", nil)
+	ObserveQuery("ds-query", "made_up_type", nil)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(QueriesTotal.WithLabelValues("ds-query", "tool_call", StatusOK)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(QueriesTotal.WithLabelValues("ds-query", "tool_call", StatusError)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(QueriesTotal.WithLabelValues("ds-query", "natural_language", StatusOK)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(QueriesTotal.WithLabelValues("ds-query", "unknown", StatusOK)))
+}
+
+func TestObserveLLMTokens(t *testing.T) {
+	ObserveLLMTokens("ds-tokens", "anthropic", "claude", 120, 30)
+	ObserveLLMTokens("ds-tokens", "anthropic", "claude", 80, 0)
+
+	assert.Equal(t, 200.0, testutil.ToFloat64(LLMTokensTotal.WithLabelValues("ds-tokens", "anthropic", "claude", "input")))
+	assert.Equal(t, 30.0, testutil.ToFloat64(LLMTokensTotal.WithLabelValues("ds-tokens", "anthropic", "claude", "output")))
+}
+
+func TestObserveConnection(t *testing.T) {
+	ObserveConnection("ds-conn", errors.New("refused"), false)
+	ObserveConnection("ds-conn", nil, true)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(ConnectionAttemptsTotal.WithLabelValues("ds-conn", StatusError)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(ConnectionAttemptsTotal.WithLabelValues("ds-conn", StatusOK)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(ReconnectsTotal.WithLabelValues("ds-conn")))
+}
+
+func TestObserveToolCall(t *testing.T) {
+	ObserveToolCall("ds-tool", "loki_query", time.Now().Add(-time.Second), true)
+
+	assert.Equal(t, 1, testutil.CollectAndCount(ToolCallDuration, "grafana_plugin_mcpclient_tool_call_duration_seconds"))
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -18,13 +20,52 @@ type MCPDataSourceSettings struct {
 	// MCP server tools (stored when datasource is configured)
 	Tools []MCPTool `json:"tools,omitempty"` // tools available on the server
 
+	// Tool policy enforced for every tool call and for the tools offered to the LLM
+	ToolAllowlist         []string `json:"toolAllowlist"`         // glob patterns of tool names that may be called (empty allows all)
+	ToolDenylist          []string `json:"toolDenylist"`          // glob patterns of tool names that may never be called
+	ReadOnlyTools         bool     `json:"readOnlyTools"`         // only allow tools annotated with readOnlyHint
+	BlockDestructiveTools bool     `json:"blockDestructiveTools"` // block destructive tools, including unannotated ones
+
 	// Agent settings for natural language processing
-	LLMProvider  string `json:"llmProvider"`  // "openai", "anthropic", "azure"
-	LLMModel     string `json:"llmModel"`     // model name (e.g., "gpt-4", "claude-3-sonnet")
-	LLMAPIKey    string `json:"llmApiKey"`    // API key for LLM service
-	SystemPrompt string `json:"systemPrompt"` // system prompt always sent to LLM
-	MaxTokens    int    `json:"maxTokens"`    // maximum tokens for LLM responses
-	AgentRetries int    `json:"agentRetries"` // number of retry attempts for agent calls
+	LLMProvider  string            `json:"llmProvider"`  // registered provider name: "anthropic", "openai", "openai_compatible", "ollama", "azure", "gemini", "mock"
+	LLMModel     string            `json:"llmModel"`     // model name (e.g., "gpt-4", "claude-3-sonnet")
+	LLMAPIKey    string            `json:"llmApiKey"`    // API key for LLM service
+	LLMBaseURL   string            `json:"llmBaseUrl"`   // base URL override for the openai, openai_compatible and gemini providers (e.g., "http://localhost:8000/v1")
+	LLMHeaders   map[string]string `json:"-"`            // extra HTTP headers sent with every LLM request, from secure JSON data
+	SystemPrompt string            `json:"systemPrompt"` // system prompt always sent to LLM
+	MaxTokens    int               `json:"maxTokens"`    // maximum tokens for LLM responses
+	AgentRetries int               `json:"agentRetries"` // number of retry attempts for agent calls
+
+	// Fallback chain and per-task model routing
+	LLMFallbacks        []LLMFallback     `json:"llmFallbacks"`        // providers tried in order when the previous one fails with 429, 5xx or a timeout
+	LLMAttemptTimeout   int               `json:"llmAttemptTimeout"`   // seconds a provider may take before the next fallback is tried (default: 30)
+	LLMToolCallModel    string            `json:"llmToolCallModel"`    // model for tool selection (default: llmModel)
+	LLMSyntaxFixModel   string            `json:"llmSyntaxFixModel"`   // model for fixing query syntax errors (default: llmModel)
+	LLMStructuringModel string            `json:"llmStructuringModel"` // model for structuring tool results (default: llmModel)
+	LLMProviderAPIKeys  map[string]string `json:"-"`                   // fallback provider API keys, from secure "llmApiKey_<provider>" fields
+
+	// LLM HTTP rate limiting, retries and circuit breaking, shared by all LLM calls of the datasource
+	LLMRequestsPerMinute       int `json:"llmRequestsPerMinute"`       // maximum LLM requests per minute (0: unlimited)
+	LLMTokensPerMinute         int `json:"llmTokensPerMinute"`         // maximum LLM tokens per minute, estimated before each request (0: unlimited)
+	LLMMaxRetries              int `json:"llmMaxRetries"`              // retries on 429, 529 and 5xx responses (default: 3, -1 disables retries)
+	LLMMaxBackoff              int `json:"llmMaxBackoff"`              // longest delay in seconds before a retry, including Retry-After (default: 30)
+	LLMCircuitBreakerThreshold int `json:"llmCircuitBreakerThreshold"` // consecutive failures that open the circuit for an LLM host (default: 5)
+	LLMCircuitBreakerCooldown  int `json:"llmCircuitBreakerCooldown"`  // seconds an open circuit rejects requests before a probe is let through (default: 30)
+
+	// Ollama settings (llmProvider "ollama")
+	OllamaHost        string `json:"ollamaHost"`        // Ollama server URL (default: "http://localhost:11434")
+	OllamaKeepAlive   string `json:"ollamaKeepAlive"`   // how long the model stays loaded after a request (e.g., "10m", "-1" keeps it loaded)
+	OllamaLoadTimeout int    `json:"ollamaLoadTimeout"` // seconds to wait for the first token, including model load (default: 300)
+
+	// Azure OpenAI settings (llmProvider "azure"); API key auth uses llmApiKey
+	AzureEndpoint      string `json:"azureEndpoint"`      // resource endpoint (e.g., "https://my-resource.openai.azure.com")
+	AzureDeployment    string `json:"azureDeployment"`    // deployment name that requests are routed to
+	AzureAPIVersion    string `json:"azureApiVersion"`    // API version (default: "2024-10-21")
+	AzureAuthType      string `json:"azureAuthType"`      // "api_key" (default) or "client_credentials" (Entra ID)
+	AzureTenantID      string `json:"azureTenantId"`      // Entra ID tenant for client credentials
+	AzureClientID      string `json:"azureClientId"`      // Entra ID application (client) ID
+	AzureClientSecret  string `json:"azureClientSecret"`  // Entra ID client secret (stored securely)
+	AzureAuthorityHost string `json:"azureAuthorityHost"` // Entra ID authority (default: "https://login.microsoftonline.com")
 
 	// Advanced settings
 	MaxRetries        int  `json:"maxRetries"`
@@ -33,9 +74,31 @@ type MCPDataSourceSettings struct {
 	EnableCompression bool `json:"enableCompression"`
 	MaxMessageSize    int  `json:"maxMessageSize"`
 
+	// Redaction applied to text sent to LLMs, logs and audit sinks
+	RedactionDetectors []string `json:"redactionDetectors"` // built-in detectors: "secrets", "email", "ip" (empty uses all three)
+	RedactionPatterns  []string `json:"redactionPatterns"`  // additional regular expressions to redact
+	DisableRedaction   bool     `json:"disableRedaction"`   // disable detectors and patterns (secure arguments are always masked)
+
+	// Audit settings for tool invocations
+	AuditSinks        []string `json:"auditSinks"`        // "log", "file", "webhook"
+	AuditFilePath     string   `json:"auditFilePath"`     // JSON-lines file used by the "file" sink
+	AuditWebhookURL   string   `json:"auditWebhookUrl"`   // endpoint used by the "webhook" sink
+	AuditWebhookToken string   `json:"auditWebhookToken"` // bearer token for the webhook (stored securely)
+
 	// Query settings
 	DefaultQueryTimeout  int `json:"defaultQueryTimeout"` // timeout in seconds
 	MaxConcurrentQueries int `json:"maxConcurrentQueries"`
+
+	// DatasourceUID is the UID of the Grafana datasource instance, set from the
+	// instance settings (not part of the stored JSON configuration)
+	DatasourceUID string `json:"-"`
+}
+
+// LLMFallback is a provider in the LLM fallback chain
+type LLMFallback struct {
+	Provider string `json:"provider"`          // registered provider name
+	Model    string `json:"model,omitempty"`   // model name (provider default if empty)
+	BaseURL  string `json:"baseUrl,omitempty"` // base URL override
 }
 
 // GeneratedToolCall represents a tool call generated by the LLM
@@ -72,6 +135,18 @@ type MCPQuery struct {
 	// Generated tool call (stored to avoid LLM calls on dashboard refresh)
 	GeneratedToolCall *GeneratedToolCall `json:"generatedToolCall,omitempty"`
 
+	// Live channel progress/<progressId> that receives the progress of the query,
+	// set from the request rather than the query JSON
+	ProgressID string `json:"-"`
+
+	// Extraction of a table from the JSON result of a tool call query
+	Extraction *Extraction `json:"extraction,omitempty"`
+
+	// Transformations of the rows of the result, run locally before they are
+	// framed; a transform pipeline, decoded when the query runs
+	Transforms         json.RawMessage `json:"transforms,omitempty"`
+	GenerateTransforms bool            `json:"generateTransforms,omitempty"` // let the LLM write the transforms when there are none
+
 	// Advanced options
 	Timeout       int                    `json:"timeout"`       // query timeout in seconds
 	MaxResults    int                    `json:"maxResults"`    // maximum number of results to return
@@ -79,11 +154,53 @@ type MCPQuery struct {
 	CustomOptions map[string]interface{} `json:"customOptions"` // additional query options
 }
 
+// Column types of a schema hint
+const (
+	ColumnTypeTime   = "time"
+	ColumnTypeNumber = "number"
+	ColumnTypeString = "string"
+	ColumnTypeBool   = "bool"
+	ColumnTypeEnum   = "enum"
+)
+
+// SchemaHint describes the frame a query returns. It is given in the "schema"
+// custom option of the query.
+type SchemaHint struct {
+	Columns    []ColumnHint `json:"columns"`              // columns in the order they are shown, others follow
+	TimeColumn string       `json:"timeColumn,omitempty"` // column converted to time and moved first
+}
+
+// ColumnHint describes a column of the frame a query returns
+type ColumnHint struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`        // time, number, string, bool or enum
+	Unit        string `json:"unit,omitempty"`        // Grafana unit, e.g. "ms" or "bytes"
+	DisplayName string `json:"displayName,omitempty"` // name shown instead of the column name
+}
+
+// Extraction describes how the JSON result of a tool call becomes a table.
+// Expressions are JMESPath, or JSONPath when they start with $.
+type Extraction struct {
+	Rows       string             `json:"rows"`                 // selects the rows, e.g. data.result or $.items[*]
+	Columns    []ExtractionColumn `json:"columns,omitempty"`    // columns evaluated on each row; all properties of the rows if empty
+	TimeColumn string             `json:"timeColumn,omitempty"` // column converted to time and moved first, for time series
+}
+
+// ExtractionColumn is a column of an extraction: an expression evaluated on each
+// row, typed and labelled like a column of a schema hint
+type ExtractionColumn struct {
+	ColumnHint
+	Expression string `json:"expression"` // evaluated on each row; the property named like the column if empty
+}
+
 // MCPTool represents an MCP tool available on the server
 type MCPTool struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	Schema      map[string]interface{} `json:"schema"`
+	Name            string                 `json:"name"`
+	Description     string                 `json:"description"`
+	Schema          map[string]interface{} `json:"schema"`
+	OutputSchema    map[string]interface{} `json:"outputSchema,omitempty"`    // schema of the structured content the tool returns
+	ReadOnlyHint    *bool                  `json:"readOnlyHint,omitempty"`    // MCP tool annotation
+	DestructiveHint *bool                  `json:"destructiveHint,omitempty"` // MCP tool annotation
 }
 
 // MCPResource represents an MCP resource available on the server
@@ -148,6 +265,31 @@ type MCPConnectionStatus struct {
 	AvailableTools []MCPTool              `json:"availableTools,omitempty"`
 }
 
+// GetSchemaHint returns the schema hint in the custom options of the query, or nil
+// if it has none
+func (q *MCPQuery) GetSchemaHint() (*SchemaHint, error) {
+	option, ok := q.CustomOptions["schema"]
+	if !ok || option == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(option)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema hint: %w", err)
+	}
+	var hint SchemaHint
+	if err := json.Unmarshal(encoded, &hint); err != nil {
+		return nil, fmt.Errorf("invalid schema hint: %w", err)
+	}
+	for _, column := range hint.Columns {
+		switch column.Type {
+		case "", ColumnTypeTime, ColumnTypeNumber, ColumnTypeString, ColumnTypeBool, ColumnTypeEnum:
+		default:
+			return nil, fmt.Errorf("invalid schema hint: column %s has unknown type %q", column.Name, column.Type)
+		}
+	}
+	return &hint, nil
+}
+
 // GetConnectionTimeout returns the connection timeout in seconds, with a default value
 func (s *MCPDataSourceSettings) GetConnectionTimeout() time.Duration {
 	if s.ConnectionTimeout <= 0 {
@@ -204,6 +346,86 @@ func (s *MCPDataSourceSettings) GetAgentRetries() int {
 	return s.AgentRetries
 }
 
+// GetOllamaHost returns the Ollama server URL with a default value
+func (s *MCPDataSourceSettings) GetOllamaHost() string {
+	if s.OllamaHost == "" {
+		return "http://localhost:11434"
+	}
+	return s.OllamaHost
+}
+
+// GetOllamaLoadTimeout returns the time to wait for the first Ollama token with a default value
+func (s *MCPDataSourceSettings) GetOllamaLoadTimeout() time.Duration {
+	if s.OllamaLoadTimeout <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(s.OllamaLoadTimeout) * time.Second
+}
+
+// GetAzureAPIVersion returns the Azure OpenAI API version with a default value
+func (s *MCPDataSourceSettings) GetAzureAPIVersion() string {
+	if s.AzureAPIVersion == "" {
+		return "2024-10-21"
+	}
+	return s.AzureAPIVersion
+}
+
+// GetAzureAuthorityHost returns the Entra ID authority host with a default value
+func (s *MCPDataSourceSettings) GetAzureAuthorityHost() string {
+	if s.AzureAuthorityHost == "" {
+		return "https://login.microsoftonline.com"
+	}
+	return s.AzureAuthorityHost
+}
+
+// GetLLMAttemptTimeout returns how long one provider of the fallback chain may take
+// before the next one is tried. Without fallbacks there is no per-provider limit.
+func (s *MCPDataSourceSettings) GetLLMAttemptTimeout() time.Duration {
+	if len(s.LLMFallbacks) == 0 {
+		return 0
+	}
+	if s.LLMAttemptTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(s.LLMAttemptTimeout) * time.Second
+}
+
+// GetLLMMaxRetries returns the number of LLM HTTP retries with a default value.
+// A negative setting disables retries.
+func (s *MCPDataSourceSettings) GetLLMMaxRetries() int {
+	if s.LLMMaxRetries < 0 {
+		return 0
+	}
+	if s.LLMMaxRetries == 0 {
+		return 3
+	}
+	return s.LLMMaxRetries
+}
+
+// GetLLMMaxBackoff returns the longest delay before an LLM HTTP retry with a default value
+func (s *MCPDataSourceSettings) GetLLMMaxBackoff() time.Duration {
+	if s.LLMMaxBackoff <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(s.LLMMaxBackoff) * time.Second
+}
+
+// GetLLMCircuitBreakerThreshold returns the consecutive failures that open the circuit with a default value
+func (s *MCPDataSourceSettings) GetLLMCircuitBreakerThreshold() int {
+	if s.LLMCircuitBreakerThreshold <= 0 {
+		return 5
+	}
+	return s.LLMCircuitBreakerThreshold
+}
+
+// GetLLMCircuitBreakerCooldown returns how long an open circuit rejects requests with a default value
+func (s *MCPDataSourceSettings) GetLLMCircuitBreakerCooldown() time.Duration {
+	if s.LLMCircuitBreakerCooldown <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(s.LLMCircuitBreakerCooldown) * time.Second
+}
+
 // GetSystemPrompt returns the system prompt, with a default if empty
 func (s *MCPDataSourceSettings) GetSystemPrompt() string {
 	if s.SystemPrompt == "" {
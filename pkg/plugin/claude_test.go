@@ -109,7 +109,7 @@ func TestClaudeIntegration(t *testing.T) {
 			queryCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second) // Longer timeout for API calls
 			defer cancel()
 
-			response := ds.query(queryCtx, backend.PluginContext{}, dataQuery)
+			response := ds.query(queryCtx, backend.PluginContext{}, "", dataQuery)
 
 			if response.Error != nil {
 				t.Logf("Query error: %v", response.Error)
@@ -209,7 +209,7 @@ func TestClaudeDirectIntegration(t *testing.T) {
 	t.Logf("Testing Claude directly with model: %s", model)
 
 	// Test Claude provider directly
-	provider, err := agent.NewAnthropicProvider(apiKey, model)
+	provider, err := agent.NewAnthropicProvider(models.MCPDataSourceSettings{LLMAPIKey: apiKey, LLMModel: model})
 	require.NoError(t, err)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -3,20 +3,34 @@ package plugin
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/mark3labs/mcp-go/client"
+	mcptransport "github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
 	"grafana-mcpclient-datasource/pkg/agent"
+	"grafana-mcpclient-datasource/pkg/audit"
+	"grafana-mcpclient-datasource/pkg/mcpcontent"
+	"grafana-mcpclient-datasource/pkg/metrics"
 	"grafana-mcpclient-datasource/pkg/models"
+	"grafana-mcpclient-datasource/pkg/policy"
+	"grafana-mcpclient-datasource/pkg/redact"
+	"grafana-mcpclient-datasource/pkg/structuring"
+	"grafana-mcpclient-datasource/pkg/toolprogress"
 )
 
 // Make sure Datasource implements required interfaces. This is important to do
@@ -28,6 +42,7 @@ var (
 	_ backend.QueryDataHandler      = (*Datasource)(nil)
 	_ backend.CheckHealthHandler    = (*Datasource)(nil)
 	_ backend.CallResourceHandler   = (*Datasource)(nil)
+	_ backend.StreamHandler         = (*Datasource)(nil)
 	_ instancemgmt.InstanceDisposer = (*Datasource)(nil)
 )
 
@@ -43,6 +58,7 @@ func NewDatasource(ctx context.Context, settings backend.DataSourceInstanceSetti
 	if err := json.Unmarshal(settings.JSONData, &config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal settings: %w", err)
 	}
+	config.DatasourceUID = settings.UID
 
 	// Read secure fields from DecryptedSecureJSONData
 	if settings.DecryptedSecureJSONData != nil {
@@ -51,6 +67,37 @@ func NewDatasource(ctx context.Context, settings backend.DataSourceInstanceSetti
 			config.LLMAPIKey = llmApiKey
 		}
 
+		// API keys of fallback LLM providers, stored as llmApiKey_<provider>
+		for key, value := range settings.DecryptedSecureJSONData {
+			if provider, found := strings.CutPrefix(key, "llmApiKey_"); found && value != "" {
+				if config.LLMProviderAPIKeys == nil {
+					config.LLMProviderAPIKeys = make(map[string]string)
+				}
+				config.LLMProviderAPIKeys[provider] = value
+			}
+		}
+
+		// Extra headers of LLM requests often carry gateway credentials, so their
+		// values are stored as llmHeader_<name>
+		for key, value := range settings.DecryptedSecureJSONData {
+			if name, found := strings.CutPrefix(key, "llmHeader_"); found && name != "" && value != "" {
+				if config.LLMHeaders == nil {
+					config.LLMHeaders = make(map[string]string)
+				}
+				config.LLMHeaders[name] = value
+			}
+		}
+
+		// Azure OpenAI Entra ID client secret
+		if secret, exists := settings.DecryptedSecureJSONData["azureClientSecret"]; exists {
+			config.AzureClientSecret = secret
+		}
+
+		// Audit webhook token
+		if token, exists := settings.DecryptedSecureJSONData["auditWebhookToken"]; exists {
+			config.AuditWebhookToken = token
+		}
+
 		// Handle secure arguments
 		if config.Arguments == nil {
 			config.Arguments = make(map[string]string)
@@ -85,9 +132,29 @@ func NewDatasource(ctx context.Context, settings backend.DataSourceInstanceSetti
 		log.DefaultLogger.Info("MCP arguments configured", "keys", argKeys)
 	}
 
+	toolPolicy, err := policy.NewToolPolicy(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure tool policy: %w", err)
+	}
+
+	redactor, err := redact.NewRedactor(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure redaction: %w", err)
+	}
+
+	auditor, err := audit.NewAuditor(config, settings.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure audit log: %w", err)
+	}
+
 	return &Datasource{
 		settings:       config,
 		mcpClient:      nil, // Lazy initialization
+		auditor:        auditor,
+		toolPolicy:     toolPolicy,
+		redactor:       redactor,
+		progress:       newProgressHub(),
+		toolProgress:   toolprogress.NewTracker("grafana-mcp-"),
 		logger:         log.DefaultLogger,
 		datasourceUID:  settings.UID,
 		datasourceID:   settings.ID,
@@ -100,10 +167,40 @@ func NewDatasource(ctx context.Context, settings backend.DataSourceInstanceSetti
 type Datasource struct {
 	settings       models.MCPDataSourceSettings
 	mcpClient      *client.Client
+	auditor        *audit.Auditor
+	toolPolicy     *policy.ToolPolicy
+	redactor       *redact.Redactor
+	progress       *progressHub
+	toolProgress   *toolprogress.Tracker
 	logger         log.Logger
 	datasourceUID  string
 	datasourceID   int64
 	datasourceName string
+
+	// clientMu guards mcpClient; connectionLost is set when the client was dropped
+	// after a transport error, so that creating the next one counts as a reconnect
+	clientMu       sync.Mutex
+	connectionLost bool
+
+	// listedTools are the tools of the MCP server, reused for listedToolsTTL when
+	// no tools are stored in the settings
+	toolsMu       sync.Mutex
+	listedTools   []mcp.Tool
+	toolsListedAt time.Time
+}
+
+// listedToolsTTL is how long the tools listed by the MCP server are reused
+const listedToolsTTL = 5 * time.Minute
+
+// traceContextPropagator propagates W3C trace context to MCP servers
+var traceContextPropagator = propagation.TraceContext{}
+
+// traceContextHeaders returns the W3C trace context headers (traceparent, tracestate)
+// for the span in ctx, so the trace continues into instrumented MCP servers
+func traceContextHeaders(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	traceContextPropagator.Inject(ctx, carrier)
+	return carrier
 }
 
 func createMCPClient(config models.MCPDataSourceSettings) (*client.Client, error) {
@@ -134,7 +231,7 @@ func createMCPClient(config models.MCPDataSourceSettings) (*client.Client, error
 			if !strings.HasSuffix(sseURL, "/sse") {
 				sseURL = strings.TrimSuffix(sseURL, "/") + "/sse"
 			}
-			mcpClient, err = client.NewSSEMCPClient(sseURL)
+			mcpClient, err = client.NewSSEMCPClient(sseURL, client.WithHeaderFunc(traceContextHeaders))
 			if err != nil {
 				return nil, fmt.Errorf("failed to create SSE client: %w", err)
 			}
@@ -153,7 +250,7 @@ func createMCPClient(config models.MCPDataSourceSettings) (*client.Client, error
 			streamURL := strings.TrimSuffix(config.ServerURL, "/") + streamPath
 			log.DefaultLogger.Info("Creating stream transport client", "url", streamURL, "path", streamPath)
 
-			mcpClient, err = client.NewStreamableHttpClient(streamURL)
+			mcpClient, err = client.NewStreamableHttpClient(streamURL, mcptransport.WithHTTPHeaderFunc(traceContextHeaders))
 			if err != nil {
 				return nil, fmt.Errorf("failed to create streamable HTTP client: %w", err)
 			}
@@ -205,19 +302,53 @@ func createMCPClient(config models.MCPDataSourceSettings) (*client.Client, error
 
 // getMCPClient returns the MCP client, creating it if necessary (lazy initialization)
 func (d *Datasource) getMCPClient() (*client.Client, error) {
+	d.clientMu.Lock()
+	defer d.clientMu.Unlock()
 	if d.mcpClient != nil {
 		return d.mcpClient, nil
 	}
 
 	mcpClient, err := createMCPClient(d.settings)
+	metrics.ObserveConnection(d.datasourceUID, err, d.connectionLost)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create MCP client: %w", err)
 	}
+	d.connectionLost = false
+
+	// Route progress notifications and log messages to the running tool calls
+	mcpClient.OnNotification(d.toolProgress.Handle)
+	if mcpClient.GetServerCapabilities().Logging != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := mcpClient.SetLevel(ctx, mcp.SetLevelRequest{Params: mcp.SetLevelParams{Level: mcp.LoggingLevelInfo}})
+		cancel()
+		if err != nil {
+			d.logger.Warn("Failed to set the MCP server log level", "error", err)
+		}
+	}
 
 	d.mcpClient = mcpClient
 	return d.mcpClient, nil
 }
 
+// dropMCPClient closes and forgets the MCP client when err is a transport error,
+// e.g. the server restarted or ended the session, so that the next request
+// connects again. Errors reported by the server keep the client.
+func (d *Datasource) dropMCPClient(mcpClient *client.Client, err error) {
+	var transportErr *mcptransport.Error
+	if !errors.As(err, &transportErr) {
+		return
+	}
+	d.clientMu.Lock()
+	defer d.clientMu.Unlock()
+	if d.mcpClient != mcpClient {
+		return
+	}
+	d.logger.Warn("Dropping the MCP client after a transport error", "error", err)
+	d.mcpClient.Close()
+	d.mcpClient = nil
+	d.connectionLost = true
+}
+
 // getStoredToolsAsMCP converts stored tools to mcp.Tool format for the agent
 func (d *Datasource) getStoredToolsAsMCP() []mcp.Tool {
 	mcpTools := make([]mcp.Tool, len(d.settings.Tools))
@@ -228,38 +359,64 @@ func (d *Datasource) getStoredToolsAsMCP() []mcp.Tool {
 			schemaBytes, _ := json.Marshal(tool.Schema)
 			json.Unmarshal(schemaBytes, &inputSchema)
 		}
+		var outputSchema json.RawMessage
+		if tool.OutputSchema != nil {
+			outputSchema, _ = json.Marshal(tool.OutputSchema)
+		}
 
 		mcpTools[i] = mcp.Tool{
-			Name:        tool.Name,
-			Description: tool.Description,
-			InputSchema: inputSchema,
+			Name:            tool.Name,
+			Description:     tool.Description,
+			InputSchema:     inputSchema,
+			RawOutputSchema: outputSchema,
+			Annotations: mcp.ToolAnnotation{
+				ReadOnlyHint:    tool.ReadOnlyHint,
+				DestructiveHint: tool.DestructiveHint,
+			},
 		}
 	}
 	if len(mcpTools) == 0 {
-		// Fetch tools from server
-		mcpClient, err := d.getMCPClient()
-		if err != nil {
-			d.logger.Error("Failed to get MCP client", "error", err)
-			return nil
-		}
-		tools, err := mcpClient.ListTools(context.Background(), mcp.ListToolsRequest{})
-		if err != nil {
-			d.logger.Error("Failed to list tools", "error", err)
-			return nil
-		}
-		mcpTools = tools.Tools
+		mcpTools = d.serverTools()
 	}
 	return mcpTools
 }
 
+// serverTools returns the tools listed by the MCP server. They are listed again
+// once listedToolsTTL has passed, so not every query asks the server for them.
+func (d *Datasource) serverTools() []mcp.Tool {
+	d.toolsMu.Lock()
+	defer d.toolsMu.Unlock()
+	if d.listedTools != nil && time.Since(d.toolsListedAt) < listedToolsTTL {
+		return d.listedTools
+	}
+
+	// Fetch tools from server
+	mcpClient, err := d.getMCPClient()
+	if err != nil {
+		d.logger.Error("Failed to get MCP client", "error", err)
+		return nil
+	}
+	tools, err := mcpClient.ListTools(context.Background(), mcp.ListToolsRequest{})
+	if err != nil {
+		d.dropMCPClient(mcpClient, err)
+		d.logger.Error("Failed to list tools", "error", err)
+		return nil
+	}
+	d.listedTools, d.toolsListedAt = tools.Tools, time.Now()
+	return d.listedTools
+}
+
 // Dispose here tells plugin SDK that plugin wants to clean up resources when a new instance
 // created. As soon as datasource settings change detected by SDK old datasource instance will
 // be disposed and a new one will be created using NewSampleDatasource factory function.
 func (d *Datasource) Dispose() {
 	// Clean up datasource instance resources.
+	d.clientMu.Lock()
 	if d.mcpClient != nil {
 		d.mcpClient.Close()
 	}
+	d.clientMu.Unlock()
+	d.auditor.Close()
 }
 
 // QueryData handles multiple queries and returns multiple responses.
@@ -269,12 +426,19 @@ func (d *Datasource) Dispose() {
 func (d *Datasource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
 	d.logger.Info("QueryData called", "queries", len(req.Queries))
 
+	ctx, span := tracing.DefaultTracer().Start(ctx, "MCPDatasource.QueryData", trace.WithAttributes(
+		attribute.String("grafana.datasource.uid", d.datasourceUID),
+		attribute.Int("queries.count", len(req.Queries)),
+	))
+	defer span.End()
+
 	// Create response struct
 	response := backend.NewQueryDataResponse()
 
 	// Loop over queries and execute them individually.
+	groupID := req.GetHTTPHeader(queryGroupIDHeader)
 	for _, q := range req.Queries {
-		res := d.query(ctx, req.PluginContext, q)
+		res := d.query(ctx, req.PluginContext, groupID, q)
 
 		// Save the response in a hashmap
 		// based on with RefID as identifier
@@ -284,13 +448,15 @@ func (d *Datasource) QueryData(ctx context.Context, req *backend.QueryDataReques
 	return response, nil
 }
 
-func (d *Datasource) query(ctx context.Context, _ backend.PluginContext, query backend.DataQuery) backend.DataResponse {
+func (d *Datasource) query(ctx context.Context, _ backend.PluginContext, groupID string, query backend.DataQuery) backend.DataResponse {
 	// Unmarshal the JSON into our query model.
 	var qm models.MCPQuery
 
 	if err := json.Unmarshal(query.JSON, &qm); err != nil {
+		metrics.ObserveQuery(d.datasourceUID, "invalid", err)
 		return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("json unmarshal: %v", err.Error()))
 	}
+	qm.ProgressID = queryProgressID(groupID, query.RefID)
 
 	// Extract time range from Grafana request if user wants to use dashboard time range
 	if qm.UseDashboardTimeRange {
@@ -299,21 +465,34 @@ func (d *Datasource) query(ctx context.Context, _ backend.PluginContext, query b
 		d.logger.Info("Using dashboard time range", "from", qm.TimeRangeFrom, "to", qm.TimeRangeTo)
 	}
 
+	ctx, span := tracing.DefaultTracer().Start(ctx, "MCPDatasource.query", trace.WithAttributes(
+		attribute.String("query.ref_id", query.RefID),
+		attribute.String("query.type", qm.QueryType),
+	))
+	defer span.End()
+
 	// Execute the query based on type
+	var res backend.DataResponse
 	switch qm.QueryType {
 	case "natural_language":
-		return d.executeQuery(ctx, qm)
+		res = d.executeQuery(ctx, qm)
 	case "tool_call":
-		return d.executeToolCall(ctx, qm)
+		res = d.executeToolCall(ctx, qm)
 	case "list_tools":
-		return d.listTools(ctx)
+		res = d.listTools(ctx)
 	default:
-		return d.executeQuery(ctx, qm)
+		res = d.executeQuery(ctx, qm)
 	}
+
+	metrics.ObserveQuery(d.datasourceUID, qm.QueryType, res.Error)
+	if res.Error != nil {
+		tracing.Error(span, res.Error)
+	}
+	return res
 }
 
 func (d *Datasource) executeQuery(ctx context.Context, query models.MCPQuery) backend.DataResponse {
-	d.logger.Info("Executing natural language query", "query", query.Query)
+	d.logger.Info("Executing natural language query", "query", d.redactor.String(query.Query))
 
 	if query.Query == "" {
 		return backend.ErrDataResponse(backend.StatusBadRequest, "query text is required for natural language queries")
@@ -327,7 +506,7 @@ func (d *Datasource) executeQuery(ctx context.Context, query models.MCPQuery) ba
 	}
 
 	// Create agent for intelligent query processing
-	agent, err := agent.NewAgent(mcpClient, d.settings)
+	queryAgent, err := agent.NewAgent(mcpClient, d.settings, d.auditor, d.toolProgress)
 	if err != nil {
 		d.logger.Error("Failed to create agent", "error", err)
 		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to create agent: %v", err))
@@ -337,25 +516,44 @@ func (d *Datasource) executeQuery(ctx context.Context, query models.MCPQuery) ba
 	queryCtx, cancel := context.WithTimeout(ctx, 60*time.Second) // Longer timeout for LLM processing
 	defer cancel()
 
+	// Report progress on the live channel the frontend subscribed to for this query
+	if progressIDPattern.MatchString(query.ProgressID) {
+		progress, finish := d.progress.start(query.ProgressID, progressUser(backend.PluginConfigFromContext(ctx).User))
+		defer finish()
+		queryCtx = agent.WithProgress(queryCtx, progress)
+	}
+
 	// Get stored tools to pass to the agent
 	storedTools := d.getStoredToolsAsMCP()
 
-	result, err := agent.ProcessQueryStructured(queryCtx, query.Query, query.ToolName, query.TimeRangeFrom, query.TimeRangeTo, query.GeneratedToolCall, storedTools)
+	result, err := queryAgent.ProcessQueryStructured(queryCtx, query.Query, query.ToolName, query.TimeRangeFrom, query.TimeRangeTo, query.GeneratedToolCall, storedTools)
 	if err != nil {
-		d.logger.Error("Failed to process natural language query", "query", query.Query, "error", err)
+		d.dropMCPClient(mcpClient, err)
+		d.logger.Error("Failed to process natural language query", "query", d.redactor.String(query.Query), "error", err)
 		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to process query: %v", err))
 	}
 
 	if !result.Success {
-		d.logger.Error("Failed to process natural language query", "query", query.Query, "error", result.ErrorMsg)
+		if blocked, _ := result.Metadata["policy_blocked"].(bool); blocked {
+			toolName, _ := result.Metadata["tool_name"].(string)
+			reason, _ := result.Metadata["policy_reason"].(string)
+			return policyBlockedResponse("natural_language", &policy.BlockedError{Tool: toolName, Reason: reason})
+		}
+		d.logger.Error("Failed to process natural language query", "query", d.redactor.String(query.Query), "error", d.redactor.String(result.ErrorMsg))
 		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to process query: %v", result.ErrorMsg))
 	}
 
-	// Create a single data frame from the structured result
-	frame := data.NewFrame("query_results")
+	transformNotices := transformResult(queryCtx, queryAgent, query, result)
 
-	// Handle case where we have no data
-	if len(result.Data) == 0 {
+	// The frame of the rows carries the metadata of the result; frames built
+	// without the LLM, e.g. a series per frame from a Prometheus result, and
+	// further tables, e.g. one per tool, follow it
+	frame := data.NewFrame("query_results")
+	var further []*data.Frame
+	if frames := resultFrames("query_results", result.Columns, result.Data, result.Frames, result.Tables); len(frames) > 0 {
+		frame, further = frames[0], frames[1:]
+	} else {
+		// Handle case where we have no data
 		// Create a frame with just the summary information
 		// frame.Fields = append(frame.Fields,
 		// 	data.NewField("message", nil, []string{result.Summary}),
@@ -380,112 +578,20 @@ func (d *Datasource) executeQuery(ctx context.Context, query models.MCPQuery) ba
 			Severity: data.NoticeSeverityInfo,
 			Text:     result.Summary,
 		})
-	} else {
-		// Create fields based on the structured data
-		// Initialize field slices based on columns
-		fieldData := make(map[string][]interface{})
-
-		// Initialize all fields
-		for _, col := range result.Columns {
-			fieldData[col] = make([]interface{}, 0, len(result.Data))
-		}
-
-		// Populate field data
-		for _, row := range result.Data {
-			for _, col := range result.Columns {
-				if val, exists := row[col]; exists {
-					fieldData[col] = append(fieldData[col], val)
-				} else {
-					fieldData[col] = append(fieldData[col], nil)
-				}
-			}
-		}
-
-		// Create fields for the frame
-		for _, col := range result.Columns {
-			// Determine the field type based on the first non-nil value
-			var field *data.Field
-			values := fieldData[col]
-
-			if len(values) > 0 {
-				// Find first non-nil value to determine type
-				var sampleValue interface{}
-				for _, v := range values {
-					if v != nil {
-						sampleValue = v
-						break
-					}
-				}
-
-				switch sampleValue.(type) {
-				case string:
-					stringValues := make([]string, len(values))
-					for i, v := range values {
-						if v != nil {
-							stringValues[i] = fmt.Sprintf("%v", v)
-						}
-					}
-					field = data.NewField(col, nil, stringValues)
-				case bool:
-					boolValues := make([]*bool, len(values))
-					for i, v := range values {
-						if v != nil {
-							if b, ok := v.(bool); ok {
-								boolValues[i] = &b
-							}
-						}
-					}
-					field = data.NewField(col, nil, boolValues)
-				case int, int32, int64:
-					floatValues := make([]*float64, len(values))
-					for i, v := range values {
-						if v != nil {
-							if val, ok := convertToFloat64(v); ok {
-								floatValues[i] = &val
-							}
-						}
-					}
-					field = data.NewField(col, nil, floatValues)
-				case float32, float64:
-					floatValues := make([]*float64, len(values))
-					for i, v := range values {
-						if v != nil {
-							if val, ok := convertToFloat64(v); ok {
-								floatValues[i] = &val
-							}
-						}
-					}
-					field = data.NewField(col, nil, floatValues)
-				default:
-					// Default to string
-					stringValues := make([]string, len(values))
-					for i, v := range values {
-						if v != nil {
-							stringValues[i] = fmt.Sprintf("%v", v)
-						}
-					}
-					field = data.NewField(col, nil, stringValues)
-				}
-			} else {
-				// Empty field, default to string
-				field = data.NewField(col, nil, []string{})
-			}
-
-			frame.Fields = append(frame.Fields, field)
-		}
 	}
 
 	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	if frame.Meta.Custom == nil {
 		// Add comprehensive metadata
-		frame.Meta = &data.FrameMeta{
-			Custom: map[string]interface{}{
-				"queryType":     "natural_language",
-				"originalQuery": query.Query,
-				"summary":       result.Summary,
-				"success":       result.Success,
-				"rowCount":      len(result.Data),
-				"columnCount":   len(result.Columns),
-			},
+		frame.Meta.Custom = map[string]interface{}{
+			"queryType":     "natural_language",
+			"originalQuery": query.Query,
+			"summary":       result.Summary,
+			"success":       result.Success,
+			"rowCount":      len(result.Data),
+			"columnCount":   len(result.Columns),
 		}
 	}
 
@@ -503,31 +609,35 @@ func (d *Datasource) executeQuery(ctx context.Context, query models.MCPQuery) ba
 		customMeta["error"] = result.ErrorMsg
 	}
 
-	return backend.DataResponse{
-		Frames: []*data.Frame{frame},
+	if contentErrors, ok := result.Metadata["structured_content_errors"].(string); ok {
+		frame.Meta.Notices = append(frame.Meta.Notices, data.Notice{Severity: data.NoticeSeverityWarning, Text: contentErrors})
 	}
-}
 
-// Helper function to convert various numeric types to float64
-func convertToFloat64(val interface{}) (float64, bool) {
-	switch v := val.(type) {
-	case int:
-		return float64(v), true
-	case int32:
-		return float64(v), true
-	case int64:
-		return float64(v), true
-	case float32:
-		return float64(v), true
-	case float64:
-		return v, true
-	default:
-		return 0, false
+	// Show what the tool reported while it was running
+	if updates, ok := result.Metadata["tool_updates"].([]toolprogress.Update); ok {
+		toolName, _ := result.Metadata["tool_name"].(string)
+		frame.Meta.Notices = append(frame.Meta.Notices, toolUpdateNotices(toolName, updates)...)
+	}
+
+	frame.Meta.Notices = append(frame.Meta.Notices, transformNotices...)
+	frame.Meta.Notices = append(frame.Meta.Notices, applyQuerySchemaHint(frame, query)...)
+
+	frames := append([]*data.Frame{frame}, further...)
+
+	// Images and audio returned by the tool get their own frames
+	attachmentFrames, err := itemFrames(result.Attachments)
+	if err != nil {
+		frame.Meta.Notices = append(frame.Meta.Notices, data.Notice{Severity: data.NoticeSeverityWarning, Text: err.Error()})
+	}
+	frames = append(frames, attachmentFrames...)
+
+	return backend.DataResponse{
+		Frames: frames,
 	}
 }
 
 func (d *Datasource) executeToolCall(ctx context.Context, query models.MCPQuery) backend.DataResponse {
-	d.logger.Info("Executing tool call", "tool", query.ToolName, "args", query.ToolArguments)
+	d.logger.Info("Executing tool call", "tool", query.ToolName, "args", d.redactor.String(query.ToolArguments))
 
 	if query.ToolName == "" {
 		return backend.ErrDataResponse(backend.StatusBadRequest, "tool name is required for tool call queries")
@@ -548,21 +658,66 @@ func (d *Datasource) executeToolCall(ctx context.Context, query models.MCPQuery)
 		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to get MCP client: %v", err))
 	}
 
-	toolCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Enforce the tool policy; annotation rules need the tool definitions
+	var policyTools []mcp.Tool
+	if d.toolPolicy.NeedsAnnotations() {
+		policyTools = d.getStoredToolsAsMCP()
+	}
+	if err := d.toolPolicy.CheckCall(query.ToolName, policyTools); err != nil {
+		var blocked *policy.BlockedError
+		if errors.As(err, &blocked) {
+			d.logger.Warn("Tool call blocked by policy", "tool", query.ToolName, "reason", blocked.Reason)
+			arguments, _ := args.(map[string]interface{})
+			d.auditor.RecordToolCall(ctx, "tool_call", query.ToolName, arguments, time.Now(), 0, err)
+			return policyBlockedResponse("tool_call", blocked)
+		}
+		return backend.ErrDataResponse(backend.StatusInternal, err.Error())
+	}
+
+	// Detach from Grafana's cancellation but keep the trace context for the MCP request
+	toolCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
 	defer cancel()
 
+	toolCtx, span := tracing.DefaultTracer().Start(toolCtx, "MCPClient.CallTool", trace.WithAttributes(
+		attribute.String("grafana.datasource.uid", d.datasourceUID),
+		attribute.String("mcp.tool.name", query.ToolName),
+	))
+	defer span.End()
+
+	// Report the progress of the tool on the live channel the frontend subscribed to
+	var progress agent.ProgressFunc
+	if progressIDPattern.MatchString(query.ProgressID) {
+		var finish func()
+		progress, finish = d.progress.start(query.ProgressID, progressUser(backend.PluginConfigFromContext(ctx).User))
+		defer finish()
+		progress(agent.ProgressEvent{Stage: agent.StageCallingTool, Tool: query.ToolName, Message: fmt.Sprintf("Calling %s…", query.ToolName)})
+	}
+	progressCall := d.toolProgress.Start(func(update toolprogress.Update) {
+		if progress != nil {
+			update.Message = d.redactor.MaskSecrets(update.Message)
+			progress(agent.ToolProgressEvent(query.ToolName, update))
+		}
+	})
+
+	start := time.Now()
 	result, err := mcpClient.CallTool(toolCtx, mcp.CallToolRequest{
 		Request: mcp.Request{
 			Method: "tools/call",
 		},
 		Params: mcp.CallToolParams{
+			Meta:      progressCall.Meta(),
 			Name:      query.ToolName,
 			Arguments: args,
 		},
 	})
+	progressCall.Done()
+	metrics.ObserveToolCall(d.datasourceUID, d.toolLabel(query.ToolName), start, err == nil && !result.IsError)
+	d.auditToolCall(toolCtx, query, args, start, result, err)
 	if err != nil {
-		d.logger.Error("Tool execution failed", "tool", query.ToolName, "error", err)
-		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("tool execution failed: %v", err))
+		d.dropMCPClient(mcpClient, err)
+		tracing.Error(span, err)
+		d.logger.Error("Tool execution failed", "tool", query.ToolName, "error", d.redactor.String(err.Error()))
+		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("tool execution failed: %s", d.redactor.MaskSecrets(err.Error())))
 	}
 
 	// Create frame with tool results
@@ -573,35 +728,181 @@ func (d *Datasource) executeToolCall(ctx context.Context, query models.MCPQuery)
 		data.NewField("timestamp", nil, []time.Time{time.Now()}),
 	)
 
-	// Add result content
-	if len(result.Content) > 0 {
-		resultTexts := make([]string, len(result.Content))
-		for i, content := range result.Content {
-			if textContent, ok := mcp.AsTextContent(content); ok {
-				resultTexts[i] = textContent.Text
-			} else {
-				resultTexts[i] = fmt.Sprintf("Non-text content: %T", content)
-			}
+	// Add the text content; images, audio and resources, including the ones behind
+	// resource links, are converted into frames of their own
+	items, contentErr := mcpcontent.Resolve(toolCtx, mcpClient, result.Content)
+	var resultTexts []string
+	for _, item := range items {
+		if item.Type == mcpcontent.TypeText {
+			resultTexts = append(resultTexts, item.Text)
 		}
+	}
+	if len(resultTexts) > 0 {
 		frame.Fields = append(frame.Fields,
 			data.NewField("result", nil, resultTexts),
 		)
 	}
+	contentFrames, framesErr := itemFrames(items)
+
+	// Prefer the structured content, typed by the output schema of the tool, over
+	// the equivalent text
+	var structuredFrame *data.Frame
+	var structuredErr error
+	if result.StructuredContent != nil && !result.IsError {
+		structuredFrame, structuredErr = mcpcontent.StructuredFrame(query.ToolName, mcpcontent.StructuredContent(result), d.toolOutputSchema(query.ToolName))
+	}
 
+	// Otherwise the text is parsed the way natural language queries parse it, e.g.
+	// JSON, CSV, logs or a Prometheus query result, without the LLM
+	var parsed *structuring.Result
+	if structuredFrame == nil && query.Extraction == nil && !result.IsError && len(resultTexts) > 0 {
+		outputs := make([]structuring.Output, len(resultTexts))
+		for i, text := range resultTexts {
+			outputs[i] = structuring.Output{Tool: query.ToolName, Text: text}
+		}
+		parsed = structuring.Structure(outputs)
+	}
+
+	// The transforms of the query run over the rows of the parsed text; frames
+	// built from structured content or an extraction have none
+	var transformNotices []data.Notice
+	if !result.IsError {
+		rows := &agent.StructuredQueryResult{}
+		if parsed != nil {
+			rows = &agent.StructuredQueryResult{Columns: parsed.Columns, Data: parsed.Data, Frames: parsed.Frames, Tables: parsed.Tables}
+		}
+		transformNotices = transformResult(toolCtx, nil, query, rows)
+		if parsed != nil {
+			parsed.Columns, parsed.Data, parsed.Tables = rows.Columns, rows.Data, rows.Tables
+		}
+	}
+
+	// The extraction of the query turns the JSON of the result into a table
+	var extractedFrame *data.Frame
+	var extractionErr error
+	if query.Extraction != nil && !result.IsError {
+		var document interface{}
+		var keyOrder []string
+		document, keyOrder, extractionErr = extractionDocument(result.StructuredContent, resultTexts)
+		if extractionErr == nil {
+			extractedFrame, extractionErr = extractionFrame(query.ToolName, document, keyOrder, query.Extraction)
+		}
+	}
+
+	customMeta := map[string]interface{}{
+		"toolName":  query.ToolName,
+		"toolArgs":  d.redactor.MaskSecrets(query.ToolArguments),
+		"isError":   result.IsError,
+		"queryType": "tool_call",
+	}
+	if structuredFrame != nil {
+		customMeta["structuredContent"] = true
+		if structuredFrame.Meta != nil {
+			customMeta["structuredProperties"] = structuredFrame.Meta.Custom
+		}
+		frame = structuredFrame
+	}
+	if extractedFrame != nil {
+		customMeta["extracted"] = true
+		frame = extractedFrame
+	}
+	if parsed != nil {
+		if frames := resultFrames("tool_call_result", parsed.Columns, parsed.Data, parsed.Frames, parsed.Tables); len(frames) > 0 {
+			customMeta["summary"] = parsed.Summary
+			customMeta["format"] = parsed.Metadata["format"]
+			frame = frames[0]
+			contentFrames = append(frames[1:], contentFrames...)
+		}
+	}
+	// Frames built from the result keep their type, e.g. time series or logs
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	frame.Meta.Custom = customMeta
+
+	updates := progressCall.Updates()
+	for i := range updates {
+		updates[i].Message = d.redactor.MaskSecrets(updates[i].Message)
+	}
+	frame.Meta.Notices = append(frame.Meta.Notices, toolUpdateNotices(query.ToolName, updates)...)
+	for _, err := range []error{contentErr, framesErr, structuredErr, extractionErr} {
+		if err != nil {
+			d.logger.Warn("Failed to convert tool result content", "tool", query.ToolName, "error", d.redactor.String(err.Error()))
+			frame.Meta.Notices = append(frame.Meta.Notices, data.Notice{
+				Severity: data.NoticeSeverityWarning,
+				Text:     d.redactor.MaskSecrets(err.Error()),
+			})
+		}
+	}
+	frame.Meta.Notices = append(frame.Meta.Notices, transformNotices...)
+	frame.Meta.Notices = append(frame.Meta.Notices, applyQuerySchemaHint(frame, query)...)
+
+	return backend.DataResponse{
+		Frames: append([]*data.Frame{frame}, contentFrames...),
+	}
+}
+
+// toolOutputSchema returns the output schema declared by a tool, or nil if it
+// declares none
+func (d *Datasource) toolOutputSchema(toolName string) json.RawMessage {
+	for _, tool := range d.getStoredToolsAsMCP() {
+		if tool.Name == toolName {
+			return mcpcontent.OutputSchema(tool)
+		}
+	}
+	return nil
+}
+
+// toolLabel returns the tool label of the metrics for a tool call: the name of
+// the tool if the MCP server lists it, else metrics.Unknown, since the name comes
+// from the query
+func (d *Datasource) toolLabel(toolName string) string {
+	for _, tool := range d.serverTools() {
+		if tool.Name == toolName {
+			return toolName
+		}
+	}
+	return metrics.Unknown
+}
+
+// policyBlockedResponse returns an error response with a frame describing why the
+// tool policy blocked a tool call
+func policyBlockedResponse(queryType string, blocked *policy.BlockedError) backend.DataResponse {
+	frame := data.NewFrame("policy_blocked",
+		data.NewField("tool_name", nil, []string{blocked.Tool}),
+		data.NewField("reason", nil, []string{blocked.Reason}),
+	)
 	frame.Meta = &data.FrameMeta{
 		Custom: map[string]interface{}{
-			"toolName":  query.ToolName,
-			"toolArgs":  query.ToolArguments,
-			"isError":   result.IsError,
-			"queryType": "tool_call",
+			"queryType":     queryType,
+			"policyBlocked": true,
 		},
+		Notices: []data.Notice{{
+			Severity: data.NoticeSeverityError,
+			Text:     blocked.Error(),
+		}},
 	}
 
 	return backend.DataResponse{
 		Frames: []*data.Frame{frame},
+		Error:  blocked,
+		Status: backend.StatusForbidden,
 	}
 }
 
+// auditToolCall records a direct tool call in the audit log
+func (d *Datasource) auditToolCall(ctx context.Context, query models.MCPQuery, args interface{}, start time.Time, result *mcp.CallToolResult, callErr error) {
+	arguments, _ := args.(map[string]interface{})
+	resultBytes := 0
+	if result != nil {
+		resultBytes = audit.ContentSize(result.Content)
+		if callErr == nil && result.IsError {
+			callErr = fmt.Errorf("tool returned an error result")
+		}
+	}
+	d.auditor.RecordToolCall(ctx, "tool_call", query.ToolName, arguments, start, resultBytes, callErr)
+}
+
 func (d *Datasource) listTools(ctx context.Context) backend.DataResponse {
 	d.logger.Info("Listing available tools")
 
@@ -617,6 +918,7 @@ func (d *Datasource) listTools(ctx context.Context) backend.DataResponse {
 
 	tools, err := mcpClient.ListTools(toolsCtx, mcp.ListToolsRequest{})
 	if err != nil {
+		d.dropMCPClient(mcpClient, err)
 		d.logger.Error("ListTools failed", "error", err)
 		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to list tools: %v", err))
 	}
@@ -679,6 +981,7 @@ func (d *Datasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRe
 	d.logger.Info("Listing MCP tools to verify connection")
 	tools, err := mcpClient.ListTools(healthCtx, mcp.ListToolsRequest{})
 	if err != nil {
+		d.dropMCPClient(mcpClient, err)
 		d.logger.Error("ListTools failed", "error", err)
 		return &backend.CheckHealthResult{
 			Status:  backend.HealthStatusError,
@@ -759,6 +1062,7 @@ func (d *Datasource) handleToolsResource(ctx context.Context, req *backend.CallR
 
 	tools, err := mcpClient.ListTools(toolsCtx, mcp.ListToolsRequest{})
 	if err != nil {
+		d.dropMCPClient(mcpClient, err)
 		d.logger.Error("Failed to list tools in resource handler", "error", err)
 		return sender.Send(&backend.CallResourceResponse{
 			Status: 500,
@@ -842,10 +1146,9 @@ func (d *Datasource) handleHealthResource(ctx context.Context, req *backend.Call
 
 func (d *Datasource) handleServersResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
 	// Return information about the connected MCP server
-	connected := false
-	if d.mcpClient != nil {
-		connected = true
-	}
+	d.clientMu.Lock()
+	connected := d.mcpClient != nil
+	d.clientMu.Unlock()
 
 	serverInfo := map[string]interface{}{
 		"serverUrl": d.settings.ServerURL,
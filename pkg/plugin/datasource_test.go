@@ -4,15 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
 
+	"grafana-mcpclient-datasource/pkg/metrics"
 	"grafana-mcpclient-datasource/pkg/models"
+	"grafana-mcpclient-datasource/pkg/policy"
 )
 
 func TestHealthCheck(t *testing.T) {
@@ -124,7 +132,7 @@ func TestListTools(t *testing.T) {
 	queryCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	response := ds.query(queryCtx, backend.PluginContext{}, dataQuery)
+	response := ds.query(queryCtx, backend.PluginContext{}, "", dataQuery)
 
 	if response.Error != nil {
 		t.Logf("Query error: %v", response.Error)
@@ -226,7 +234,7 @@ func TestNaturalLanguageQuery(t *testing.T) {
 			queryCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancel()
 
-			response := ds.query(queryCtx, backend.PluginContext{}, dataQuery)
+			response := ds.query(queryCtx, backend.PluginContext{}, "", dataQuery)
 
 			if response.Error != nil {
 				t.Logf("Query error: %v", response.Error)
@@ -307,3 +315,151 @@ func TestContainerNetworking(t *testing.T) {
 		})
 	}
 }
+
+func TestTraceContextHeaders(t *testing.T) {
+	// No span in context: nothing to propagate
+	assert.Empty(t, traceContextHeaders(context.Background()))
+
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	headers := traceContextHeaders(ctx)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", headers["traceparent"])
+}
+
+// newTestDatasource returns a datasource with config connected to mcpServer over
+// the streamable HTTP transport
+func newTestDatasource(t *testing.T, config models.MCPDataSourceSettings, mcpServer *server.MCPServer) *Datasource {
+	t.Helper()
+	httpServer := server.NewTestStreamableHTTPServer(mcpServer)
+	t.Cleanup(httpServer.Close)
+
+	config.ServerURL = httpServer.URL
+	config.Transport = "stream"
+	config.StreamPath = "/mcp"
+	settingsJSON, err := json.Marshal(config)
+	require.NoError(t, err)
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{UID: "test", JSONData: settingsJSON})
+	require.NoError(t, err)
+	ds := instance.(*Datasource)
+	t.Cleanup(ds.Dispose)
+	return ds
+}
+
+func TestReconnectAfterTransportError(t *testing.T) {
+	mcpServer := server.NewMCPServer("test", "1.0.0")
+	mcpServer.AddTool(mcp.NewTool("echo"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	var down atomic.Bool
+	handler := server.NewStreamableHTTPServer(mcpServer)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(httpServer.Close)
+
+	settingsJSON, err := json.Marshal(models.MCPDataSourceSettings{ServerURL: httpServer.URL, Transport: "stream", StreamPath: "/mcp"})
+	require.NoError(t, err)
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{UID: "test-reconnect", JSONData: settingsJSON})
+	require.NoError(t, err)
+	ds := instance.(*Datasource)
+	t.Cleanup(ds.Dispose)
+
+	require.NoError(t, ds.listTools(context.Background()).Error)
+	first := ds.mcpClient
+
+	// A transport error drops the client, the next query connects again
+	down.Store(true)
+	require.Error(t, ds.listTools(context.Background()).Error)
+	assert.Nil(t, ds.mcpClient)
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.ReconnectsTotal.WithLabelValues("test-reconnect")))
+
+	down.Store(false)
+	require.NoError(t, ds.listTools(context.Background()).Error)
+	assert.NotSame(t, first, ds.mcpClient)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.ReconnectsTotal.WithLabelValues("test-reconnect")))
+
+	// A transport error of a natural language query drops the client too
+	nlQuery := models.MCPQuery{QueryType: "natural_language", Query: "echo", ToolName: "echo"}
+	require.NoError(t, ds.executeQuery(context.Background(), nlQuery).Error)
+	down.Store(true)
+	require.Error(t, ds.executeQuery(context.Background(), nlQuery).Error)
+	assert.Nil(t, ds.mcpClient)
+
+	down.Store(false)
+	require.NoError(t, ds.executeQuery(context.Background(), nlQuery).Error)
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.ReconnectsTotal.WithLabelValues("test-reconnect")))
+
+	// Errors reported by the server keep the client
+	client := ds.mcpClient
+	require.Error(t, ds.executeToolCall(context.Background(), models.MCPQuery{QueryType: "tool_call", ToolName: "missing"}).Error)
+	assert.Same(t, client, ds.mcpClient)
+}
+
+func TestToolPolicyBlocksCalls(t *testing.T) {
+	var calls atomic.Int32
+	handler := func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		calls.Add(1)
+		return mcp.NewToolResultText("done"), nil
+	}
+	mcpServer := server.NewMCPServer("test", "1.0.0")
+	mcpServer.AddTool(mcp.NewTool("list_logs", mcp.WithReadOnlyHintAnnotation(true)), handler)
+	mcpServer.AddTool(mcp.NewTool("drop_logs", mcp.WithReadOnlyHintAnnotation(false), mcp.WithDestructiveHintAnnotation(true)), handler)
+
+	for name, settings := range map[string]models.MCPDataSourceSettings{
+		"deny pattern":      {ToolDenylist: []string{"drop_*"}},
+		"destructive tools": {BlockDestructiveTools: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ds := newTestDatasource(t, settings, mcpServer)
+			calls.Store(0)
+
+			for _, res := range []backend.DataResponse{
+				ds.executeToolCall(context.Background(), models.MCPQuery{QueryType: "tool_call", ToolName: "drop_logs"}),
+				ds.executeQuery(context.Background(), models.MCPQuery{QueryType: "natural_language", Query: "drop the logs", ToolName: "drop_logs"}),
+			} {
+				var blocked *policy.BlockedError
+				require.ErrorAs(t, res.Error, &blocked)
+				assert.Equal(t, backend.StatusForbidden, res.Status)
+				assert.Equal(t, "drop_logs", res.Frames[0].Fields[0].At(0))
+				assert.Equal(t, true, res.Frames[0].Meta.Custom.(map[string]interface{})["policyBlocked"])
+			}
+			assert.Equal(t, int32(0), calls.Load(), "blocked calls never reach the server")
+
+			res := ds.executeToolCall(context.Background(), models.MCPQuery{QueryType: "tool_call", ToolName: "list_logs"})
+			require.NoError(t, res.Error)
+			assert.Equal(t, int32(1), calls.Load())
+		})
+	}
+}
+
+func TestToolCallMetricLabel(t *testing.T) {
+	mcpServer := server.NewMCPServer("test", "1.0.0")
+	mcpServer.AddTool(mcp.NewTool("echo"), func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	ds := newTestDatasource(t, models.MCPDataSourceSettings{}, mcpServer)
+
+	require.NoError(t, ds.executeToolCall(context.Background(), models.MCPQuery{QueryType: "tool_call", ToolName: "echo"}).Error)
+	assert.Equal(t, "echo", ds.toolLabel("echo"))
+
+	// Tools the server does not list share one label, whatever the query names
+	require.Error(t, ds.executeToolCall(context.Background(), models.MCPQuery{QueryType: "tool_call", ToolName: "made_up_1"}).Error)
+	series := testutil.CollectAndCount(metrics.ToolCallDuration)
+	require.Error(t, ds.executeToolCall(context.Background(), models.MCPQuery{QueryType: "tool_call", ToolName: "made_up_2"}).Error)
+	assert.Equal(t, series, testutil.CollectAndCount(metrics.ToolCallDuration))
+	assert.Equal(t, metrics.Unknown, ds.toolLabel("made_up_2"))
+}
@@ -0,0 +1,254 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/PaesslerAG/jsonpath"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/jmespath/go-jmespath"
+
+	"grafana-mcpclient-datasource/pkg/models"
+	"grafana-mcpclient-datasource/pkg/structuring"
+)
+
+// evaluator evaluates a compiled expression on a JSON document
+type evaluator func(document interface{}) (interface{}, error)
+
+// compileExpression compiles a JMESPath expression, or a JSONPath expression when
+// it starts with $
+func compileExpression(expression string) (evaluator, error) {
+	expression = strings.TrimSpace(expression)
+	if strings.HasPrefix(expression, "$") {
+		path, err := jsonpath.New(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSONPath %q: %w", expression, err)
+		}
+		return func(document interface{}) (interface{}, error) {
+			return path(context.Background(), document)
+		}, nil
+	}
+	compiled, err := jmespath.Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JMESPath %q: %w", expression, err)
+	}
+	return compiled.Search, nil
+}
+
+// extractionDocument returns the JSON document of a tool result: its structured
+// content, or else the first of its texts that is JSON. It also returns the keys
+// of the objects of the document in the order they appear in its text, if known.
+func extractionDocument(structured interface{}, texts []string) (interface{}, []string, error) {
+	if structured != nil {
+		// Decoded again so the expressions see plain maps, slices and numbers
+		encoded, err := json.Marshal(structured)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid structured content: %w", err)
+		}
+		document, err := decodeDocument(string(encoded))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid structured content: %w", err)
+		}
+		// Decoded structured content has lost the order of its keys, which a text
+		// holding the same document still has
+		for _, text := range texts {
+			if same, err := decodeDocument(text); err == nil && reflect.DeepEqual(same, document) {
+				return document, structuring.KeyOrder(text), nil
+			}
+		}
+		return document, nil, nil
+	}
+	for _, text := range texts {
+		if document, err := decodeDocument(text); err == nil {
+			return document, structuring.KeyOrder(text), nil
+		}
+	}
+	return nil, nil, errors.New("the tool result is not JSON")
+}
+
+// decodeDocument decodes a JSON document for the expressions, with its numbers
+// as float64, except integers a float64 cannot hold exactly, which are kept as
+// json.Number
+func decodeDocument(text string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after the JSON document")
+	}
+	return expressionNumbers(document), nil
+}
+
+// expressionNumbers replaces the json.Number values of v by float64, which the
+// expressions compare and sort, unless they are integers beyond 2^53
+func expressionNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if n, err := value.Int64(); err == nil && (n > 1<<53 || n < -(1<<53)) {
+			return value
+		}
+		if f, err := value.Float64(); err == nil {
+			return f
+		}
+		return value
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = expressionNumbers(item)
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = expressionNumbers(item)
+		}
+		return value
+	default:
+		return v
+	}
+}
+
+// extractTable evaluates an extraction on a JSON document. Each element of the
+// array the rows expression selects is a row; any other value is a single row.
+// Without columns, the properties of the rows are the columns, in the order of
+// keyOrder, and rows that are not objects give a value column.
+func extractTable(document interface{}, keyOrder []string, extraction *models.Extraction) ([]string, []map[string]interface{}, error) {
+	selected := document
+	if strings.TrimSpace(extraction.Rows) != "" {
+		rowsOf, err := compileExpression(extraction.Rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		if selected, err = rowsOf(document); err != nil {
+			return nil, nil, fmt.Errorf("rows expression %q failed: %w", extraction.Rows, err)
+		}
+	}
+	var items []interface{}
+	switch v := selected.(type) {
+	case []interface{}:
+		items = v
+	case nil:
+	default:
+		items = []interface{}{v}
+	}
+
+	if len(extraction.Columns) == 0 {
+		columns, rows := propertyTable(items, keyOrder)
+		return columns, rows, nil
+	}
+
+	columns := make([]string, len(extraction.Columns))
+	evaluators := make([]evaluator, len(extraction.Columns))
+	for i, column := range extraction.Columns {
+		if column.Name == "" {
+			return nil, nil, fmt.Errorf("column %d has no name", i+1)
+		}
+		columns[i] = column.Name
+		if column.Expression == "" {
+			continue
+		}
+		evaluate, err := compileExpression(column.Expression)
+		if err != nil {
+			return nil, nil, fmt.Errorf("column %s: %w", column.Name, err)
+		}
+		evaluators[i] = evaluate
+	}
+
+	rows := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		rows[i] = make(map[string]interface{}, len(columns))
+		for j, column := range columns {
+			if evaluators[j] == nil {
+				if object, ok := item.(map[string]interface{}); ok {
+					rows[i][column] = object[column]
+				}
+				continue
+			}
+			// Rows without what the expression looks for have an empty cell
+			if value, err := evaluators[j](item); err == nil {
+				rows[i][column] = value
+			}
+		}
+	}
+	return columns, rows, nil
+}
+
+// propertyTable returns the rows of items that are all objects, with their
+// properties as columns, or else a row per item with the item as its value. The
+// columns are in the order of keyOrder, the keys of the document as they appear
+// in its text, so they do not change order between refreshes. Keys missing from
+// keyOrder follow in alphabetical order.
+func propertyTable(items []interface{}, keyOrder []string) ([]string, []map[string]interface{}) {
+	rows := make([]map[string]interface{}, len(items))
+	seen := make(map[string]bool)
+	var columns []string
+	for i, item := range items {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			for i, item := range items {
+				rows[i] = map[string]interface{}{"value": item}
+			}
+			return []string{"value"}, rows
+		}
+		rows[i] = object
+		for key := range object {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	position := make(map[string]int, len(keyOrder))
+	for i, key := range keyOrder {
+		position[key] = i
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		pi, iKnown := position[columns[i]]
+		pj, jKnown := position[columns[j]]
+		if iKnown && jKnown {
+			return pi < pj
+		}
+		if iKnown != jKnown {
+			return iKnown
+		}
+		return columns[i] < columns[j]
+	})
+	return columns, rows
+}
+
+// extractionFrame builds the frame of a tool call result with the extraction of
+// the query. Without extraction columns, the columns follow keyOrder. Field
+// types are inferred from the values, then converted to the types of the
+// extraction columns, with the time column first. It returns nil if the
+// extraction fails, and the frame with an error listing the values that could
+// not be converted otherwise.
+func extractionFrame(name string, document interface{}, keyOrder []string, extraction *models.Extraction) (*data.Frame, error) {
+	columns, rows, err := extractTable(document, keyOrder, extraction)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	frame := tableFrame(name, columns, rows, nil)
+	if frame.Meta != nil {
+		for _, notice := range frame.Meta.Notices {
+			errs = append(errs, errors.New(notice.Text))
+		}
+		frame.Meta = nil
+	}
+
+	hint := &models.SchemaHint{TimeColumn: extraction.TimeColumn}
+	for _, column := range extraction.Columns {
+		hint.Columns = append(hint.Columns, column.ColumnHint)
+	}
+	if len(hint.Columns) > 0 || hint.TimeColumn != "" {
+		errs = append(errs, applySchemaHint(frame, hint))
+	}
+	return frame, errors.Join(errs...)
+}
@@ -0,0 +1,117 @@
+package plugin
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+const deployments = `{"data": {"items": [
+	{"metadata": {"name": "api", "created": "2024-05-01T10:00:00Z"}, "status": {"replicas": 3, "ready": "3"}},
+	{"metadata": {"name": "db", "created": "2024-05-02T10:00:00Z"}, "status": {"replicas": 1}}
+]}}`
+
+func TestExtractionFrameJMESPath(t *testing.T) {
+	document, keyOrder, err := extractionDocument(nil, []string{"not JSON", deployments})
+	require.NoError(t, err)
+
+	extraction := &models.Extraction{
+		Rows: "data.items",
+		Columns: []models.ExtractionColumn{
+			{ColumnHint: models.ColumnHint{Name: "name"}, Expression: "metadata.name"},
+			{ColumnHint: models.ColumnHint{Name: "ready", Type: models.ColumnTypeNumber, Unit: "short"}, Expression: "status.ready"},
+			{ColumnHint: models.ColumnHint{Name: "replicas"}, Expression: "status.replicas"},
+			{ColumnHint: models.ColumnHint{Name: "created"}, Expression: "metadata.created"},
+		},
+		TimeColumn: "created",
+	}
+	frame, err := extractionFrame("deployments", document, keyOrder, extraction)
+	require.NoError(t, err)
+	require.NotNil(t, frame)
+	require.Len(t, frame.Fields, 4)
+
+	assert.Equal(t, "created", frame.Fields[0].Name)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), *frame.Fields[0].At(0).(*time.Time))
+	assert.Equal(t, "api", *frame.Fields[1].At(0).(*string))
+	assert.Equal(t, 3.0, *frame.Fields[2].At(0).(*float64))
+	assert.Nil(t, frame.Fields[2].At(1))
+	assert.Equal(t, "short", frame.Fields[2].Config.Unit)
+	assert.Equal(t, data.FieldTypeNullableInt64, frame.Fields[3].Type())
+}
+
+func TestExtractionFrameJSONPath(t *testing.T) {
+	document, keyOrder, err := extractionDocument(map[string]interface{}{"points": []map[string]interface{}{
+		{"t": 1714557600000, "v": 1.5},
+		{"t": 1714557660000, "v": 2},
+	}}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, keyOrder)
+
+	frame, err := extractionFrame("series", document, keyOrder, &models.Extraction{Rows: "$.points[*]", TimeColumn: "t"})
+	require.NoError(t, err)
+	require.Len(t, frame.Fields, 2)
+	assert.Equal(t, time.UnixMilli(1714557660000).UTC(), *frame.Fields[0].At(1).(*time.Time))
+	assert.Equal(t, data.FieldTypeNullableFloat64, frame.Fields[1].Type())
+
+	frame, err = extractionFrame("names", document, keyOrder, &models.Extraction{Rows: "points[].v"})
+	require.NoError(t, err)
+	assert.Equal(t, "value", frame.Fields[0].Name)
+	assert.Equal(t, 2, frame.Rows())
+}
+
+func TestExtractionKeepsLargeIntegers(t *testing.T) {
+	document, keyOrder, err := extractionDocument(nil, []string{`{"traces": [{"id": 9007199254740993, "spans": 3}, {"id": 12, "spans": 1}]}`})
+	require.NoError(t, err)
+
+	frame, err := extractionFrame("traces", document, keyOrder, &models.Extraction{Rows: "traces[?spans > `2`]"})
+	require.NoError(t, err)
+	require.Equal(t, 1, frame.Rows(), "the expressions compare the other numbers as numbers")
+	assert.Equal(t, int64(9007199254740993), *frame.Fields[0].At(0).(*int64))
+}
+
+func TestExtractionColumnsKeepKeyOrder(t *testing.T) {
+	text := `{"services": [{"service": "api", "errors": 3, "latency": 0.5}, {"service": "db", "region": "eu", "errors": 1}]}`
+	document, keyOrder, err := extractionDocument(nil, []string{text})
+	require.NoError(t, err)
+
+	frame, err := extractionFrame("services", document, keyOrder, &models.Extraction{Rows: "services"})
+	require.NoError(t, err)
+	names := make([]string, len(frame.Fields))
+	for i, field := range frame.Fields {
+		names[i] = field.Name
+	}
+	assert.Equal(t, []string{"service", "errors", "latency", "region"}, names)
+
+	// The text of structured content gives the order of its keys as well
+	var structured map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(text), &structured))
+	_, structuredOrder, err := extractionDocument(structured, []string{text})
+	require.NoError(t, err)
+	assert.Equal(t, keyOrder, structuredOrder)
+
+	// Keys missing from the order follow in alphabetical order
+	columns, _ := propertyTable([]interface{}{map[string]interface{}{"b": 1, "c": 2, "a": 3}}, []string{"c"})
+	assert.Equal(t, []string{"c", "a", "b"}, columns)
+}
+
+func TestExtractionErrors(t *testing.T) {
+	_, _, err := extractionDocument(nil, []string{"plain text"})
+	assert.EqualError(t, err, "the tool result is not JSON")
+
+	frame, err := extractionFrame("x", map[string]interface{}{}, nil, &models.Extraction{Rows: "data[?"})
+	assert.Nil(t, frame)
+	assert.ErrorContains(t, err, "invalid JMESPath")
+
+	frame, err = extractionFrame("x", map[string]interface{}{"a": []interface{}{map[string]interface{}{"b": "x"}}}, nil, &models.Extraction{
+		Rows:    "a",
+		Columns: []models.ExtractionColumn{{ColumnHint: models.ColumnHint{Name: "b", Type: models.ColumnTypeNumber}}},
+	})
+	require.NotNil(t, frame)
+	assert.EqualError(t, err, "1 values of b are not a valid number")
+}
@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"grafana-mcpclient-datasource/pkg/conv"
+	"grafana-mcpclient-datasource/pkg/mcpcontent"
+	"grafana-mcpclient-datasource/pkg/structuring"
+)
+
+// resultFrames returns the frames of a structured result: the frame of its rows
+// named name, its frames built without the LLM, whose types and units are kept as
+// is, and a frame per further table. Without rows, the first of the other frames
+// comes first. It returns nil if the result has none of them.
+func resultFrames(name string, columns []string, rows []map[string]interface{}, frames []*data.Frame, tables []structuring.Table) []*data.Frame {
+	var result []*data.Frame
+	if len(rows) > 0 {
+		result = append(result, tableFrame(name, columns, rows, nil))
+	}
+	result = append(result, frames...)
+	for _, table := range tables {
+		result = append(result, tableFrame(table.Name, table.Columns, table.Data, table.Metadata))
+	}
+	return result
+}
+
+// tableFrame returns a frame of the rows of a table, with a field per column of
+// the type most of its values have. Values that cannot be converted are reported
+// as notices of the frame.
+func tableFrame(name string, columns []string, rows []map[string]interface{}, metadata map[string]interface{}) *data.Frame {
+	frame := data.NewFrame(name)
+	var notices []data.Notice
+	for _, column := range columns {
+		values := make([]interface{}, len(rows))
+		for i, row := range rows {
+			values[i] = row[column]
+		}
+		field, fieldNotices := conv.InferField(column, values)
+		frame.Fields = append(frame.Fields, field)
+		notices = append(notices, fieldNotices...)
+	}
+
+	if len(notices) > 0 || len(metadata) > 0 {
+		frame.Meta = &data.FrameMeta{Notices: notices}
+		if len(metadata) > 0 {
+			custom := make(map[string]interface{}, len(metadata))
+			for key, value := range metadata {
+				custom[key] = value
+			}
+			frame.Meta.Custom = custom
+		}
+	}
+	return frame
+}
+
+// itemFrames returns the frames of the content of a tool result other than its
+// text: images and audio, binary resources, and text resources, which are
+// structured like the text of a result and named after the resource. Text
+// resources none of the parsers accepts are kept as text; those whose MIME type
+// declares data, e.g. JSON or CSV, are reported in the returned error.
+func itemFrames(items []mcpcontent.Item) ([]*data.Frame, error) {
+	var frames []*data.Frame
+	var errs []error
+	for _, item := range items {
+		if item.Type == mcpcontent.TypeText {
+			continue
+		}
+		text, ok := item.AsText()
+		if !ok {
+			frame, err := mcpcontent.Frame(item)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if frame != nil {
+				frames = append(frames, frame)
+			}
+			continue
+		}
+
+		name := item.FrameName()
+		if parsed := structuring.Structure([]structuring.Output{{Tool: name, Text: text}}); parsed != nil {
+			if resource := resultFrames(name, parsed.Columns, parsed.Data, parsed.Frames, parsed.Tables); len(resource) > 0 {
+				frames = append(frames, resource...)
+				continue
+			}
+		}
+		if item.IsData() {
+			errs = append(errs, fmt.Errorf("failed to parse %s as %s", name, item.MIMEType))
+		}
+		frames = append(frames, data.NewFrame(name, data.NewField("text", nil, []string{text})))
+	}
+	return frames, errors.Join(errs...)
+}
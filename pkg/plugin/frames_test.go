@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/mcpcontent"
+	"grafana-mcpclient-datasource/pkg/structuring"
+)
+
+func TestTableFrame(t *testing.T) {
+	frame := tableFrame("hosts", []string{"host", "up"}, []map[string]interface{}{
+		{"host": "a", "up": true},
+		{"host": "b"},
+	}, map[string]interface{}{"format": "json"})
+	assert.Equal(t, "hosts", frame.Name)
+	require.Len(t, frame.Fields, 2)
+	assert.Equal(t, data.FieldTypeNullableBool, frame.Fields[1].Type())
+	assert.Nil(t, frame.Fields[1].At(1))
+	require.NotNil(t, frame.Meta)
+	assert.Equal(t, map[string]interface{}{"format": "json"}, frame.Meta.Custom)
+
+	frame = tableFrame("query_results", []string{"n"}, []map[string]interface{}{{"n": 1.0}}, nil)
+	assert.Nil(t, frame.Meta)
+}
+
+func TestResultFrames(t *testing.T) {
+	parsed := structuring.Structure([]structuring.Output{
+		{Tool: "get_hosts", Text: "host,up\na,true"},
+		{Tool: "get_hosts", Text: `{"resultType": "vector", "result": [{"metric": {"job": "api"}, "value": [1700000000, "1"]}]}`},
+	})
+	require.NotNil(t, parsed)
+	frames := resultFrames("tool_call_result", parsed.Columns, parsed.Data, parsed.Frames, parsed.Tables)
+	require.Len(t, frames, 2)
+	assert.Equal(t, "tool_call_result", frames[0].Name)
+	assert.Equal(t, data.FieldTypeNullableBool, frames[0].Fields[1].Type())
+	assert.Equal(t, data.FrameTypeTimeSeriesMulti, frames[1].Meta.Type)
+
+	// Without rows the first of the other frames comes first
+	frames = resultFrames("tool_call_result", nil, nil, parsed.Frames, []structuring.Table{{Name: "hosts", Columns: []string{"host"}, Data: []map[string]interface{}{{"host": "a"}}}})
+	require.Len(t, frames, 2)
+	assert.Equal(t, parsed.Frames[0], frames[0])
+	assert.Equal(t, "hosts", frames[1].Name)
+
+	assert.Nil(t, resultFrames("tool_call_result", []string{}, []map[string]interface{}{}, nil, nil))
+}
+
+func TestItemFrames(t *testing.T) {
+	blob := func(text string) string { return base64.StdEncoding.EncodeToString([]byte(text)) }
+	items := []mcpcontent.Item{
+		{Type: mcpcontent.TypeText, Text: "ignored"},
+		{Type: mcpcontent.TypeImage, Data: "iVBORw0KGgo=", MIMEType: "image/png"},
+		{Type: mcpcontent.TypeResource, Name: "hosts", MIMEType: "application/json", Text: `[{"up":true,"host":"a"},{"up":false,"host":"b","load":0.5}]`},
+		{Type: mcpcontent.TypeResource, Name: "errors", MIMEType: "text/csv; charset=utf-8", Data: blob("service,errors\napi,3\ndb,\nweb,n/a\n")},
+		{Type: mcpcontent.TypeResource, Name: "events", MIMEType: "application/x-ndjson", Text: "{\"msg\":\"start\"}\n\n{\"msg\":\"stop\",\"code\":1}\n"},
+		{Type: mcpcontent.TypeResource, Name: "broken", MIMEType: "application/json", Text: `{"host":`},
+	}
+
+	frames, err := itemFrames(items)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse broken")
+	require.Len(t, frames, 5)
+
+	assert.Equal(t, "image", frames[0].Name)
+
+	hosts := frames[1]
+	assert.Equal(t, "hosts", hosts.Name)
+	require.Len(t, hosts.Fields, 3)
+	assert.Equal(t, []string{"up", "host", "load"}, []string{hosts.Fields[0].Name, hosts.Fields[1].Name, hosts.Fields[2].Name}, "columns keep the order of the document")
+	assert.Equal(t, data.FieldTypeNullableBool, hosts.Fields[0].Type())
+	assert.Nil(t, hosts.Fields[2].At(0))
+
+	errorsFrame := frames[2]
+	assert.Equal(t, "errors", errorsFrame.Name)
+	assert.Equal(t, 3, errorsFrame.Rows())
+	assert.Equal(t, data.FieldTypeNullableString, errorsFrame.Fields[1].Type(), "too few numbers for a number column")
+
+	events := frames[3]
+	assert.Equal(t, 2, events.Rows())
+	assert.Equal(t, "msg", events.Fields[0].Name)
+
+	broken := frames[4]
+	assert.Equal(t, "text", broken.Fields[0].Name, "unparseable resources are kept as text")
+}
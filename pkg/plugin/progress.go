@@ -0,0 +1,264 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"grafana-mcpclient-datasource/pkg/agent"
+	"grafana-mcpclient-datasource/pkg/toolprogress"
+)
+
+// Query progress is published on the live channel ds/<datasource uid>/progress/<progress id>,
+// where the progress id is chosen by the frontend and sent with the query
+const progressPathPrefix = "progress/"
+
+// progressRetention is how long the events of a finished query are kept for a
+// subscriber that has not started streaming yet
+const progressRetention = 30 * time.Second
+
+// progressBufferSize is the number of events buffered per query; further events are
+// dropped until the subscriber catches up
+const progressBufferSize = 1024
+
+// maxToolNotices is the number of tool updates shown as frame notices
+const maxToolNotices = 20
+
+var progressIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// queryGroupIDHeader is the header with the id the frontend gives the queries of
+// one request
+const queryGroupIDHeader = "X-Query-Group-Id"
+
+// queryProgressID returns the progress id of a query: the id of its query group
+// and its refId. It is not part of the query model, so the query stays the same
+// from request to request and can be cached. It returns "" when the request has
+// no query group or the id is not valid.
+func queryProgressID(groupID, refID string) string {
+	id := groupID + "-" + refID
+	if groupID == "" || !progressIDPattern.MatchString(id) {
+		return ""
+	}
+	return id
+}
+
+// progressUser returns the user a progress stream belongs to: the login of the
+// Grafana user of the request, or "" when there is none
+func progressUser(user *backend.User) string {
+	if user == nil {
+		return ""
+	}
+	return user.Login
+}
+
+// progressStream holds the progress events of one query until they are streamed
+type progressStream struct {
+	user     string
+	events   chan agent.ProgressEvent
+	finished chan struct{}
+	queried  bool
+}
+
+func newProgressStream(user string) *progressStream {
+	return &progressStream{
+		user:     user,
+		events:   make(chan agent.ProgressEvent, progressBufferSize),
+		finished: make(chan struct{}),
+	}
+}
+
+func (s *progressStream) isFinished() bool {
+	select {
+	case <-s.finished:
+		return true
+	default:
+		return false
+	}
+}
+
+// progressHub connects running queries with the live channels streaming their progress.
+// The query and the subscription may start in either order.
+type progressHub struct {
+	mu      sync.Mutex
+	streams map[string]*progressStream
+}
+
+func newProgressHub() *progressHub {
+	return &progressHub{streams: make(map[string]*progressStream)}
+}
+
+// start registers a query of user with the given progress id. It returns the
+// function the query reports its progress to, and the function to call once the
+// query is done. A subscription of another user does not receive the progress.
+func (h *progressHub) start(id, user string) (agent.ProgressFunc, func()) {
+	h.mu.Lock()
+	s, ok := h.streams[id]
+	if !ok || s.queried || s.isFinished() || s.user != user {
+		s = newProgressStream(user)
+		h.streams[id] = s
+	}
+	s.queried = true
+	h.mu.Unlock()
+
+	publish := func(event agent.ProgressEvent) {
+		select {
+		case s.events <- event:
+		default:
+		}
+	}
+	finish := func() {
+		publish(agent.ProgressEvent{Stage: agent.StageDone})
+		close(s.finished)
+		time.AfterFunc(progressRetention, func() { h.remove(id, s) })
+	}
+	return publish, finish
+}
+
+// allowed reports whether user may subscribe to the progress of id, which is the
+// case unless a query or subscription of another user registered it
+func (h *progressHub) allowed(id, user string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.streams[id]
+	return !ok || s.user == user
+}
+
+// run sends the progress events of the query of user with the given id until the
+// query is done or ctx is canceled
+func (h *progressHub) run(ctx context.Context, id, user string, send func(event agent.ProgressEvent) error) error {
+	h.mu.Lock()
+	s, ok := h.streams[id]
+	if !ok {
+		s = newProgressStream(user)
+		h.streams[id] = s
+	}
+	h.mu.Unlock()
+	if s.user != user {
+		return nil
+	}
+
+	defer func() {
+		h.mu.Lock()
+		queried := s.queried
+		h.mu.Unlock()
+		if !queried {
+			h.remove(id, s)
+		}
+	}()
+
+	for {
+		select {
+		case event := <-s.events:
+			if err := send(event); err != nil {
+				return err
+			}
+		case <-s.finished:
+			// Send what is left in the buffer
+			for {
+				select {
+				case event := <-s.events:
+					if err := send(event); err != nil {
+						return err
+					}
+				default:
+					h.remove(id, s)
+					return nil
+				}
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// remove forgets the stream of id, unless it has been replaced by another one
+func (h *progressHub) remove(id string, s *progressStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.streams[id] == s {
+		delete(h.streams, id)
+	}
+}
+
+// progressID returns the progress id of a live channel path
+func progressID(path string) (string, bool) {
+	id, ok := strings.CutPrefix(path, progressPathPrefix)
+	return id, ok && progressIDPattern.MatchString(id)
+}
+
+// SubscribeStream allows users to subscribe to the progress channels of their own
+// queries
+func (d *Datasource) SubscribeStream(_ context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	id, ok := progressID(req.Path)
+	if !ok {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	if !d.progress.allowed(id, progressUser(req.PluginContext.User)) {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusPermissionDenied}, nil
+	}
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// PublishStream rejects publishing, progress is only sent by the backend
+func (d *Datasource) PublishStream(_ context.Context, _ *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+}
+
+// RunStream streams the progress events of a query to its live channel
+func (d *Datasource) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	id, ok := progressID(req.Path)
+	if !ok {
+		return nil
+	}
+	return d.progress.run(ctx, id, progressUser(req.PluginContext.User), func(event agent.ProgressEvent) error {
+		message, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return sender.SendJSON(message)
+	})
+}
+
+// toolUpdateNotices returns the frame notices for the updates a tool sent while it
+// was running: its last progress notification and its log messages, oldest first
+func toolUpdateNotices(toolName string, updates []toolprogress.Update) []data.Notice {
+	lastProgress := -1
+	for i, update := range updates {
+		if update.Kind == toolprogress.KindProgress {
+			lastProgress = i
+		}
+	}
+
+	var notices []data.Notice
+	for i, update := range updates {
+		if update.Kind == toolprogress.KindProgress && i != lastProgress || update.Level == "debug" {
+			continue
+		}
+		notices = append(notices, data.Notice{
+			Severity: logNoticeSeverity(update.Level),
+			Text:     toolName + ": " + update.String(),
+		})
+	}
+	if len(notices) > maxToolNotices {
+		notices = notices[len(notices)-maxToolNotices:]
+	}
+	return notices
+}
+
+// logNoticeSeverity maps an MCP log level to a notice severity
+func logNoticeSeverity(level string) data.NoticeSeverity {
+	switch level {
+	case "warning":
+		return data.NoticeSeverityWarning
+	case "error", "critical", "alert", "emergency":
+		return data.NoticeSeverityError
+	default:
+		return data.NoticeSeverityInfo
+	}
+}
@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/agent"
+	"grafana-mcpclient-datasource/pkg/toolprogress"
+)
+
+func TestProgressHubQueryBeforeSubscription(t *testing.T) {
+	hub := newProgressHub()
+
+	publish, finish := hub.start("q1", "alice")
+	publish(agent.ProgressEvent{Stage: agent.StageSelectingTool})
+	publish(agent.ProgressEvent{Stage: agent.StageText, Text: "done"})
+	finish()
+
+	var stages []string
+	err := hub.run(context.Background(), "q1", "alice", func(event agent.ProgressEvent) error {
+		stages = append(stages, event.Stage)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{agent.StageSelectingTool, agent.StageText, agent.StageDone}, stages)
+	assert.Empty(t, hub.streams, "streamed progress is forgotten")
+}
+
+func TestProgressHubSubscriptionBeforeQuery(t *testing.T) {
+	hub := newProgressHub()
+
+	events := make(chan agent.ProgressEvent, 10)
+	runDone := make(chan error)
+	go func() {
+		runDone <- hub.run(context.Background(), "q2", "alice", func(event agent.ProgressEvent) error {
+			events <- event
+			return nil
+		})
+	}()
+
+	// Wait for the subscription to register its stream
+	require.Eventually(t, func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return hub.streams["q2"] != nil
+	}, time.Second, time.Millisecond)
+
+	publish, finish := hub.start("q2", "alice")
+	publish(agent.ProgressEvent{Stage: agent.StageCallingTool, Tool: "loki_query"})
+	finish()
+
+	require.NoError(t, <-runDone)
+	assert.Equal(t, "loki_query", (<-events).Tool)
+	assert.Equal(t, agent.StageDone, (<-events).Stage)
+}
+
+func TestProgressHubCanceledSubscription(t *testing.T) {
+	hub := newProgressHub()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, hub.run(ctx, "q3", "alice", func(agent.ProgressEvent) error { return nil }))
+	assert.Empty(t, hub.streams, "subscriptions without a query are forgotten")
+}
+
+func TestProgressHubOtherUser(t *testing.T) {
+	hub := newProgressHub()
+
+	publish, finish := hub.start("q4", "alice")
+	publish(agent.ProgressEvent{Stage: agent.StageText, Text: "secret summary"})
+	assert.True(t, hub.allowed("q4", "alice"))
+	assert.False(t, hub.allowed("q4", "mallory"))
+
+	var stages []string
+	require.NoError(t, hub.run(context.Background(), "q4", "mallory", func(event agent.ProgressEvent) error {
+		stages = append(stages, event.Stage)
+		return nil
+	}))
+	assert.Empty(t, stages, "the progress of other users is not streamed")
+	finish()
+
+	// A subscription of another user before the query does not receive its progress
+	ctx, cancel := context.WithCancel(context.Background())
+	runDone := make(chan error)
+	go func() {
+		runDone <- hub.run(ctx, "q5", "mallory", func(event agent.ProgressEvent) error {
+			stages = append(stages, event.Stage)
+			return nil
+		})
+	}()
+	require.Eventually(t, func() bool { return !hub.allowed("q5", "alice") }, time.Second, time.Millisecond)
+
+	publish, finish = hub.start("q5", "alice")
+	publish(agent.ProgressEvent{Stage: agent.StageText, Text: "secret summary"})
+	finish()
+	assert.True(t, hub.allowed("q5", "alice"))
+	assert.False(t, hub.allowed("q5", "mallory"))
+
+	cancel()
+	require.NoError(t, <-runDone)
+	assert.Empty(t, stages, "the progress of other users is not streamed")
+}
+
+func TestSubscribeStream(t *testing.T) {
+	d := &Datasource{progress: newProgressHub()}
+	_, finish := d.progress.start("q6", "alice")
+	defer finish()
+
+	subscribe := func(path, login string) backend.SubscribeStreamStatus {
+		res, err := d.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{
+			PluginContext: backend.PluginContext{User: &backend.User{Login: login}},
+			Path:          path,
+		})
+		require.NoError(t, err)
+		return res.Status
+	}
+	assert.Equal(t, backend.SubscribeStreamStatusOK, subscribe("progress/q6", "alice"))
+	assert.Equal(t, backend.SubscribeStreamStatusPermissionDenied, subscribe("progress/q6", "mallory"))
+	assert.Equal(t, backend.SubscribeStreamStatusOK, subscribe("progress/q7", "mallory"))
+	assert.Equal(t, backend.SubscribeStreamStatusNotFound, subscribe("logs/q6", "alice"))
+}
+
+func TestProgressID(t *testing.T) {
+	id, ok := progressID("progress/A_1-b")
+	assert.True(t, ok)
+	assert.Equal(t, "A_1-b", id)
+
+	for _, path := range []string{"progress/", "progress/a/b", "logs/a", "progress/a b"} {
+		_, ok := progressID(path)
+		assert.False(t, ok, path)
+	}
+}
+
+func TestQueryProgressID(t *testing.T) {
+	assert.Equal(t, "lx2k9-4fj2a-A", queryProgressID("lx2k9-4fj2a", "A"))
+	assert.Empty(t, queryProgressID("", "A"), "requests without a query group")
+	assert.Empty(t, queryProgressID("lx2k9-4fj2a", "error rate"), "refIds that are not valid in a channel path")
+}
+
+func TestToolUpdateNotices(t *testing.T) {
+	updates := []toolprogress.Update{
+		{Kind: toolprogress.KindProgress, Progress: 1, Total: 4},
+		{Kind: toolprogress.KindLog, Level: "debug", Message: "querying"},
+		{Kind: toolprogress.KindLog, Level: "warning", Message: "slow query"},
+		{Kind: toolprogress.KindProgress, Progress: 4, Total: 4, Message: "Done"},
+	}
+
+	notices := toolUpdateNotices("scan", updates)
+	assert.Equal(t, []data.Notice{
+		{Severity: data.NoticeSeverityWarning, Text: "scan: [warning] slow query"},
+		{Severity: data.NoticeSeverityInfo, Text: "scan: 100% Done"},
+	}, notices)
+}
@@ -0,0 +1,201 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"grafana-mcpclient-datasource/pkg/conv"
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+// applySchemaHint converts, orders and labels the fields of frame as the schema
+// hint of the query describes them: the time column first, then the columns of
+// the hint in their order, then the remaining fields as they were. Values that
+// cannot be converted are left empty and reported in the returned error.
+func applySchemaHint(frame *data.Frame, hint *models.SchemaHint) error {
+	columns := hint.Columns
+	if hint.TimeColumn != "" {
+		timeColumn := models.ColumnHint{Name: hint.TimeColumn}
+		rest := make([]models.ColumnHint, 0, len(columns))
+		for _, column := range columns {
+			if column.Name == hint.TimeColumn {
+				timeColumn = column
+			} else {
+				rest = append(rest, column)
+			}
+		}
+		timeColumn.Type = models.ColumnTypeTime
+		columns = append([]models.ColumnHint{timeColumn}, rest...)
+	}
+
+	var errs []error
+	ordered := make([]*data.Field, 0, len(frame.Fields))
+	placed := make(map[*data.Field]bool, len(frame.Fields))
+	for _, column := range columns {
+		index := fieldIndex(frame, column.Name)
+		if index < 0 {
+			errs = append(errs, fmt.Errorf("column %s of the schema hint is not in the result", column.Name))
+			continue
+		}
+		field := frame.Fields[index]
+		if placed[field] {
+			continue
+		}
+
+		if column.Type != "" {
+			converted, failed := convertField(field, column.Type)
+			if failed > 0 {
+				errs = append(errs, fmt.Errorf("%d values of %s are not a valid %s", failed, column.Name, column.Type))
+			}
+			frame.Fields[index] = converted
+			field = converted
+		}
+		if column.Unit != "" || column.DisplayName != "" {
+			if field.Config == nil {
+				field.Config = &data.FieldConfig{}
+			}
+			if column.Unit != "" {
+				field.Config.Unit = column.Unit
+			}
+			if column.DisplayName != "" {
+				field.Config.DisplayName = column.DisplayName
+			}
+		}
+		ordered = append(ordered, field)
+		placed[field] = true
+	}
+
+	for _, field := range frame.Fields {
+		if !placed[field] {
+			ordered = append(ordered, field)
+		}
+	}
+	frame.Fields = ordered
+	return errors.Join(errs...)
+}
+
+// fieldIndex returns the index of the field named name, or -1
+func fieldIndex(frame *data.Frame, name string) int {
+	for i, field := range frame.Fields {
+		if field.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// convertField converts the values of a field to a column type of a schema hint,
+// keeping its name, labels and config. It returns the number of values that could
+// not be converted, which are left empty.
+func convertField(field *data.Field, columnType string) (*data.Field, int) {
+	values := make([]interface{}, field.Len())
+	for i := range values {
+		// Empty cells of nullable fields come back as zero values
+		if value, ok := field.ConcreteAt(i); ok {
+			values[i] = value
+		}
+		// Empty cells of text columns are missing values, not invalid ones
+		if text, ok := values[i].(string); ok && columnType != models.ColumnTypeString && strings.TrimSpace(text) == "" {
+			values[i] = nil
+		}
+	}
+
+	var converted *data.Field
+	failed := 0
+	switch columnType {
+	case models.ColumnTypeTime:
+		times := make([]*time.Time, len(values))
+		for i, value := range values {
+			if t, ok := conv.ToTime(value); ok {
+				times[i] = &t
+			} else if value != nil {
+				failed++
+			}
+		}
+		converted = data.NewField(field.Name, field.Labels, times)
+	case models.ColumnTypeNumber:
+		numbers := make([]*float64, len(values))
+		for i, value := range values {
+			if number, ok := conv.ToFloat(value); ok {
+				numbers[i] = &number
+			} else if value != nil {
+				failed++
+			}
+		}
+		converted = data.NewField(field.Name, field.Labels, numbers)
+	case models.ColumnTypeBool:
+		bools := make([]*bool, len(values))
+		for i, value := range values {
+			if b, ok := conv.ToBool(value); ok {
+				bools[i] = &b
+			} else if value != nil {
+				failed++
+			}
+		}
+		converted = data.NewField(field.Name, field.Labels, bools)
+	case models.ColumnTypeEnum:
+		converted = enumField(field.Name, field.Labels, values)
+	default:
+		strs := make([]*string, len(values))
+		for i, value := range values {
+			if value != nil {
+				text := conv.ToString(value)
+				strs[i] = &text
+			}
+		}
+		converted = data.NewField(field.Name, field.Labels, strs)
+	}
+
+	// Only enum fields have a type config, the enum texts
+	if field.Config != nil {
+		config := *field.Config
+		config.TypeConfig = nil
+		if converted.Config != nil {
+			config.TypeConfig = converted.Config.TypeConfig
+		}
+		converted.Config = &config
+	}
+	return converted, failed
+}
+
+// enumField returns an enum field whose values are the distinct texts of values,
+// in the order they first appear
+func enumField(name string, labels data.Labels, values []interface{}) *data.Field {
+	var texts []string
+	indexes := make(map[string]data.EnumItemIndex)
+	items := make([]*data.EnumItemIndex, len(values))
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		text := conv.ToString(value)
+		index, ok := indexes[text]
+		if !ok {
+			index = data.EnumItemIndex(len(texts))
+			indexes[text] = index
+			texts = append(texts, text)
+		}
+		items[i] = &index
+	}
+
+	field := data.NewField(name, labels, items)
+	field.Config = &data.FieldConfig{TypeConfig: &data.FieldTypeConfig{Enum: &data.EnumFieldConfig{Text: texts}}}
+	return field
+}
+
+// applyQuerySchemaHint applies the schema hint of the query, if it has one, to
+// frame and returns the problems it ran into as notices
+func applyQuerySchemaHint(frame *data.Frame, query models.MCPQuery) []data.Notice {
+	hint, err := query.GetSchemaHint()
+	if err == nil && hint != nil {
+		err = applySchemaHint(frame, hint)
+	}
+	if err == nil {
+		return nil
+	}
+	return []data.Notice{{Severity: data.NoticeSeverityWarning, Text: err.Error()}}
+}
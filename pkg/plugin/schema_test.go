@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+func TestApplySchemaHint(t *testing.T) {
+	frame := data.NewFrame("query_results",
+		data.NewField("service", nil, []string{"api", "db", "api"}),
+		data.NewField("latency", nil, []string{"12.5", "", "slow"}),
+		data.NewField("status", nil, []string{"ok", "down", "ok"}),
+		data.NewField("at", nil, []float64{1700000000, 1700000000123, 1.7e18}),
+		data.NewField("healthy", nil, []string{"true", "false", "true"}),
+	)
+	query := models.MCPQuery{CustomOptions: map[string]interface{}{"schema": map[string]interface{}{
+		"timeColumn": "at",
+		"columns": []interface{}{
+			map[string]interface{}{"name": "latency", "type": "number", "unit": "ms", "displayName": "Latency"},
+			map[string]interface{}{"name": "status", "type": "enum"},
+			map[string]interface{}{"name": "healthy", "type": "bool"},
+			map[string]interface{}{"name": "missing"},
+		},
+	}}}
+
+	notices := applyQuerySchemaHint(frame, query)
+	require.Len(t, notices, 1)
+	assert.Contains(t, notices[0].Text, "column missing of the schema hint is not in the result")
+	assert.Contains(t, notices[0].Text, "1 values of latency are not a valid number")
+
+	names := make([]string, len(frame.Fields))
+	for i, field := range frame.Fields {
+		names[i] = field.Name
+	}
+	assert.Equal(t, []string{"at", "latency", "status", "healthy", "service"}, names)
+
+	at := frame.Fields[0]
+	assert.Equal(t, data.FieldTypeNullableTime, at.Type())
+	for i := 0; i < 3; i++ {
+		value, ok := at.ConcreteAt(i)
+		require.True(t, ok)
+		assert.Equal(t, int64(1700000000), value.(time.Time).Unix(), "timestamp %d", i)
+	}
+
+	latency := frame.Fields[1]
+	assert.Equal(t, 12.5, *latency.At(0).(*float64))
+	assert.Nil(t, latency.At(1))
+	assert.Nil(t, latency.At(2))
+	assert.Equal(t, "ms", latency.Config.Unit)
+	assert.Equal(t, "Latency", latency.Config.DisplayName)
+
+	status := frame.Fields[2]
+	assert.Equal(t, data.FieldTypeNullableEnum, status.Type())
+	assert.Equal(t, []string{"ok", "down"}, status.Config.TypeConfig.Enum.Text)
+	assert.Equal(t, data.EnumItemIndex(1), *status.At(1).(*data.EnumItemIndex))
+
+	assert.Equal(t, true, *frame.Fields[3].At(0).(*bool))
+}
+
+func TestSchemaHintValidation(t *testing.T) {
+	query := models.MCPQuery{CustomOptions: map[string]interface{}{"schema": map[string]interface{}{
+		"columns": []interface{}{map[string]interface{}{"name": "a", "type": "decimal"}},
+	}}}
+	_, err := query.GetSchemaHint()
+	assert.ErrorContains(t, err, `unknown type "decimal"`)
+
+	hint, err := (&models.MCPQuery{}).GetSchemaHint()
+	assert.NoError(t, err)
+	assert.Nil(t, hint)
+}
+
+func TestSchemaHintKeepsNullCells(t *testing.T) {
+	at, count := 1700000000.0, 3.0
+	frame := data.NewFrame("query_results",
+		data.NewField("at", nil, []*float64{&at, nil}),
+		data.NewField("count", nil, []*float64{nil, &count}),
+	)
+	query := models.MCPQuery{CustomOptions: map[string]interface{}{"schema": map[string]interface{}{
+		"timeColumn": "at",
+		"columns":    []interface{}{map[string]interface{}{"name": "count", "type": "string"}},
+	}}}
+
+	assert.Empty(t, applyQuerySchemaHint(frame, query))
+	assert.Equal(t, time.Unix(1700000000, 0).UTC(), frame.Fields[0].At(0).(*time.Time).UTC())
+	assert.Nil(t, frame.Fields[0].At(1))
+	assert.Nil(t, frame.Fields[1].At(0))
+	assert.Equal(t, "3", *frame.Fields[1].At(1).(*string))
+}
@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"grafana-mcpclient-datasource/pkg/agent"
+	"grafana-mcpclient-datasource/pkg/models"
+	"grafana-mcpclient-datasource/pkg/transform"
+)
+
+// transformGenerator writes transform pipelines for natural language queries
+type transformGenerator interface {
+	GenerateTransforms(ctx context.Context, query string, table transform.Table) (transform.Pipeline, error)
+}
+
+// transformResult runs the transforms of the query over the rows of the result
+// and over its further tables, after asking generator, the LLM, for them when
+// the query wants generated transforms and has none. Without a generator, as
+// for tool call queries, only the transforms of the query run. A generated
+// pipeline is returned in the generated_transforms metadata, which the frontend
+// saves as the transforms of the query. Problems are returned as notices and
+// leave the rows as they were.
+func transformResult(ctx context.Context, generator transformGenerator, query models.MCPQuery, result *agent.StructuredQueryResult) []data.Notice {
+	pipeline, err := queryPipeline(query)
+	if err != nil {
+		return []data.Notice{{Severity: data.NoticeSeverityWarning, Text: fmt.Sprintf("Transforms not applied: %v", err)}}
+	}
+	if len(pipeline) == 0 && !query.GenerateTransforms {
+		return nil
+	}
+
+	// The rows of the result come first, then the further tables, e.g. one per
+	// array of a JSON object
+	type rows struct {
+		name    string
+		columns *[]string
+		data    *[]map[string]interface{}
+	}
+	targets := []rows{{columns: &result.Columns, data: &result.Data}}
+	for i := range result.Tables {
+		targets = append(targets, rows{name: result.Tables[i].Name, columns: &result.Tables[i].Columns, data: &result.Tables[i].Data})
+	}
+	var first *rows
+	for i := range targets {
+		if len(*targets[i].data) > 0 {
+			first = &targets[i]
+			break
+		}
+	}
+	if first == nil {
+		// Frames built directly, e.g. time series or structured content, have no rows
+		return []data.Notice{{Severity: data.NoticeSeverityWarning, Text: "Transforms not applied: the result has no rows"}}
+	}
+
+	if len(pipeline) == 0 {
+		if generator == nil {
+			return []data.Notice{{Severity: data.NoticeSeverityWarning, Text: "Transforms not generated: only natural language queries can generate transforms"}}
+		}
+		generated, err := generator.GenerateTransforms(ctx, query.Query, transform.Table{Columns: *first.columns, Rows: *first.data})
+		if err != nil {
+			return []data.Notice{{Severity: data.NoticeSeverityWarning, Text: fmt.Sprintf("Failed to generate transforms: %v", err)}}
+		}
+		if result.Metadata == nil {
+			result.Metadata = make(map[string]interface{})
+		}
+		result.Metadata["generated_transforms"] = generated
+		pipeline = generated
+	}
+	if len(pipeline) == 0 {
+		return nil
+	}
+
+	var notices []data.Notice
+	for _, target := range targets {
+		if len(*target.data) == 0 {
+			continue
+		}
+		transformed, err := pipeline.Apply(transform.Table{Columns: *target.columns, Rows: *target.data})
+		if err != nil {
+			text := fmt.Sprintf("Transforms not applied: %v", err)
+			if target.name != "" {
+				text = fmt.Sprintf("Transforms not applied to %s: %v", target.name, err)
+			}
+			notices = append(notices, data.Notice{Severity: data.NoticeSeverityWarning, Text: text})
+			continue
+		}
+		*target.data, *target.columns = transformed.Rows, transformed.Columns
+		if *target.data == nil {
+			*target.data = []map[string]interface{}{}
+		}
+	}
+	return notices
+}
+
+// queryPipeline decodes the transform pipeline of the query, which has none when
+// its transforms are empty
+func queryPipeline(query models.MCPQuery) (transform.Pipeline, error) {
+	if len(query.Transforms) == 0 {
+		return nil, nil
+	}
+	var pipeline transform.Pipeline
+	if err := json.Unmarshal(query.Transforms, &pipeline); err != nil {
+		return nil, fmt.Errorf("invalid transforms: %w", err)
+	}
+	return pipeline, nil
+}
@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/agent"
+	"grafana-mcpclient-datasource/pkg/models"
+	"grafana-mcpclient-datasource/pkg/transform"
+)
+
+// stubGenerator returns pipeline, or err
+type stubGenerator struct {
+	pipeline transform.Pipeline
+	err      error
+}
+
+func (g stubGenerator) GenerateTransforms(context.Context, string, transform.Table) (transform.Pipeline, error) {
+	return g.pipeline, g.err
+}
+
+func serviceResult() *agent.StructuredQueryResult {
+	return &agent.StructuredQueryResult{
+		Columns:  []string{"service", "errors"},
+		Data:     []map[string]interface{}{{"service": "api", "errors": 3.0}, {"service": "db", "errors": 9.0}},
+		Metadata: map[string]interface{}{},
+	}
+}
+
+func TestTransformResult(t *testing.T) {
+	result := serviceResult()
+	query := models.MCPQuery{Transforms: json.RawMessage(`[{"type": "sort", "by": ["errors"], "desc": true}, {"type": "limit", "count": 1}]`)}
+	notices := transformResult(context.Background(), stubGenerator{err: errors.New("not called")}, query, result)
+	assert.Empty(t, notices)
+	assert.Equal(t, []map[string]interface{}{{"service": "db", "errors": 9.0}}, result.Data)
+
+	// Generated transforms are returned to be saved with the query
+	generated := transform.Pipeline{{Type: transform.TypeSelect, Columns: []string{"service"}}}
+	result = serviceResult()
+	notices = transformResult(context.Background(), stubGenerator{pipeline: generated}, models.MCPQuery{GenerateTransforms: true}, result)
+	assert.Empty(t, notices)
+	assert.Equal(t, []string{"service"}, result.Columns)
+	assert.Equal(t, generated, result.Metadata["generated_transforms"])
+
+	// Problems leave the rows as they were
+	result = serviceResult()
+	query = models.MCPQuery{Transforms: json.RawMessage(`[{"type": "select", "columns": ["host"]}]`)}
+	notices = transformResult(context.Background(), stubGenerator{}, query, result)
+	require.Len(t, notices, 1)
+	assert.Equal(t, data.NoticeSeverityWarning, notices[0].Severity)
+	assert.Equal(t, `Transforms not applied: step 1 (select): unknown column "host"`, notices[0].Text)
+	assert.Equal(t, serviceResult().Data, result.Data)
+
+	query = models.MCPQuery{Transforms: json.RawMessage(`{"type": "select"}`)}
+	notices = transformResult(context.Background(), stubGenerator{}, query, result)
+	require.Len(t, notices, 1)
+	assert.Contains(t, notices[0].Text, "Transforms not applied: invalid transforms")
+	assert.Equal(t, serviceResult().Data, result.Data)
+}
+
+func TestTransformResultTables(t *testing.T) {
+	result := &agent.StructuredQueryResult{
+		Data:    []map[string]interface{}{},
+		Columns: []string{},
+		Tables: []agent.ResultTable{
+			{Name: "services", Columns: []string{"service", "errors"}, Data: serviceResult().Data},
+			{Name: "hosts", Columns: []string{"host"}, Data: []map[string]interface{}{{"host": "a"}}},
+		},
+	}
+	query := models.MCPQuery{Transforms: json.RawMessage(`[{"type": "sort", "by": ["errors"], "desc": true}]`)}
+	notices := transformResult(context.Background(), stubGenerator{}, query, result)
+	assert.Equal(t, []map[string]interface{}{{"service": "db", "errors": 9.0}, {"service": "api", "errors": 3.0}}, result.Tables[0].Data)
+	require.Len(t, notices, 1)
+	assert.Equal(t, `Transforms not applied to hosts: step 1 (sort): unknown column "errors"`, notices[0].Text)
+
+	// Frames without rows, e.g. a time series per frame, are not transformed
+	result = &agent.StructuredQueryResult{Frames: []*data.Frame{data.NewFrame("series")}}
+	notices = transformResult(context.Background(), stubGenerator{err: errors.New("not called")}, models.MCPQuery{GenerateTransforms: true}, result)
+	require.Len(t, notices, 1)
+	assert.Equal(t, "Transforms not applied: the result has no rows", notices[0].Text)
+	assert.Empty(t, transformResult(context.Background(), stubGenerator{}, models.MCPQuery{}, result), "no transforms were requested")
+}
+
+func TestToolCallTransforms(t *testing.T) {
+	mcpServer := server.NewMCPServer("test", "1.0.0")
+	mcpServer.AddTool(mcp.NewTool("errors"), func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("service,errors\napi,3\ndb,9\nauth,1"), nil
+	})
+	ds := newTestDatasource(t, models.MCPDataSourceSettings{}, mcpServer)
+
+	query := models.MCPQuery{
+		QueryType:  "tool_call",
+		ToolName:   "errors",
+		Transforms: json.RawMessage(`[{"type": "sort", "by": ["errors"], "desc": true}, {"type": "limit", "count": 2}]`),
+	}
+	res := ds.executeToolCall(context.Background(), query)
+	require.NoError(t, res.Error)
+	frame := res.Frames[0]
+	require.Equal(t, 2, frame.Rows())
+	assert.Equal(t, "db", *frame.Fields[0].At(0).(*string))
+	assert.Equal(t, "api", *frame.Fields[0].At(1).(*string))
+	assert.Empty(t, frame.Meta.Notices)
+
+	// Tool call queries have no query text to generate transforms from
+	query.Transforms = nil
+	query.GenerateTransforms = true
+	res = ds.executeToolCall(context.Background(), query)
+	require.NoError(t, res.Error)
+	assert.Equal(t, 3, res.Frames[0].Rows())
+	require.Len(t, res.Frames[0].Meta.Notices, 1)
+	assert.Equal(t, "Transforms not generated: only natural language queries can generate transforms", res.Frames[0].Meta.Notices[0].Text)
+}
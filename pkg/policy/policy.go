@@ -0,0 +1,141 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+// BlockedError is returned when a tool call is rejected by the tool policy
+type BlockedError struct {
+	Tool   string
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("tool '%s' is blocked by the datasource tool policy: %s", e.Tool, e.Reason)
+}
+
+// ToolPolicy decides which MCP tools may be offered to the LLM and called.
+//
+// Name rules are glob patterns (path.Match syntax) on tool names: a tool matching
+// any deny pattern is blocked, and when allow patterns are configured a tool must
+// match at least one of them. Annotation rules use the MCP tool annotations: in
+// read-only mode only tools with readOnlyHint=true are allowed, and destructive
+// tools (without readOnlyHint=true, and with destructiveHint=true or unset) can
+// be blocked.
+// A nil *ToolPolicy allows every tool.
+type ToolPolicy struct {
+	allow            []string
+	deny             []string
+	readOnly         bool
+	blockDestructive bool
+}
+
+// NewToolPolicy creates a tool policy from the datasource settings, validating the
+// configured glob patterns
+func NewToolPolicy(settings models.MCPDataSourceSettings) (*ToolPolicy, error) {
+	for _, pattern := range append(append([]string{}, settings.ToolAllowlist...), settings.ToolDenylist...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid tool pattern '%s': %w", pattern, err)
+		}
+	}
+
+	return &ToolPolicy{
+		allow:            settings.ToolAllowlist,
+		deny:             settings.ToolDenylist,
+		readOnly:         settings.ReadOnlyTools,
+		blockDestructive: settings.BlockDestructiveTools,
+	}, nil
+}
+
+// NeedsAnnotations reports whether the policy needs tool annotations to decide
+func (p *ToolPolicy) NeedsAnnotations() bool {
+	return p != nil && (p.readOnly || p.blockDestructive)
+}
+
+// CheckName applies the allow and deny patterns to a tool name
+func (p *ToolPolicy) CheckName(name string) error {
+	if p == nil {
+		return nil
+	}
+
+	for _, pattern := range p.deny {
+		if matched, _ := path.Match(pattern, name); matched {
+			return &BlockedError{Tool: name, Reason: fmt.Sprintf("matches deny pattern '%s'", pattern)}
+		}
+	}
+
+	if len(p.allow) == 0 {
+		return nil
+	}
+	for _, pattern := range p.allow {
+		if matched, _ := path.Match(pattern, name); matched {
+			return nil
+		}
+	}
+	return &BlockedError{Tool: name, Reason: "does not match any allow pattern"}
+}
+
+// Check applies name and annotation rules to a tool definition
+func (p *ToolPolicy) Check(tool mcp.Tool) error {
+	if p == nil {
+		return nil
+	}
+
+	if err := p.CheckName(tool.Name); err != nil {
+		return err
+	}
+
+	readOnly := tool.Annotations.ReadOnlyHint != nil && *tool.Annotations.ReadOnlyHint
+	if p.readOnly && !readOnly {
+		return &BlockedError{Tool: tool.Name, Reason: "read-only mode requires the readOnlyHint annotation"}
+	}
+
+	// As in the MCP spec, a tool that is not read-only is destructive unless it
+	// says otherwise
+	destructive := tool.Annotations.DestructiveHint == nil || *tool.Annotations.DestructiveHint
+	if p.blockDestructive && destructive && !readOnly {
+		return &BlockedError{Tool: tool.Name, Reason: "tool is annotated as destructive"}
+	}
+
+	return nil
+}
+
+// CheckCall checks a call to the named tool, looking up its definition in tools
+// when annotation rules are enabled. Unknown tools are blocked in that case since
+// their annotations cannot be verified.
+func (p *ToolPolicy) CheckCall(name string, tools []mcp.Tool) error {
+	if p == nil {
+		return nil
+	}
+
+	if !p.NeedsAnnotations() {
+		return p.CheckName(name)
+	}
+
+	for _, tool := range tools {
+		if tool.Name == name {
+			return p.Check(tool)
+		}
+	}
+	return &BlockedError{Tool: name, Reason: "tool annotations are unavailable, so the call cannot be verified"}
+}
+
+// Filter returns the tools allowed by the policy
+func (p *ToolPolicy) Filter(tools []mcp.Tool) []mcp.Tool {
+	if p == nil {
+		return tools
+	}
+
+	allowed := make([]mcp.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if p.Check(tool) == nil {
+			allowed = append(allowed, tool)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,88 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+func annotatedTool(name string, readOnly, destructive *bool) mcp.Tool {
+	return mcp.Tool{
+		Name: name,
+		Annotations: mcp.ToolAnnotation{
+			ReadOnlyHint:    readOnly,
+			DestructiveHint: destructive,
+		},
+	}
+}
+
+func TestNewToolPolicyInvalidPattern(t *testing.T) {
+	_, err := NewToolPolicy(models.MCPDataSourceSettings{ToolDenylist: []string{"delete_["}})
+	assert.Error(t, err)
+}
+
+func TestCheckName(t *testing.T) {
+	p, err := NewToolPolicy(models.MCPDataSourceSettings{
+		ToolAllowlist: []string{"loki_*", "prometheus_*"},
+		ToolDenylist:  []string{"*_delete*"},
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, p.CheckName("loki_query"))
+	assert.NoError(t, p.CheckName("prometheus_range_query"))
+
+	var blocked *BlockedError
+	err = p.CheckName("loki_delete_stream")
+	require.True(t, errors.As(err, &blocked))
+	assert.Equal(t, "loki_delete_stream", blocked.Tool)
+	assert.Contains(t, blocked.Reason, "deny pattern")
+
+	err = p.CheckName("create_ticket")
+	require.True(t, errors.As(err, &blocked))
+	assert.Contains(t, blocked.Reason, "allow pattern")
+}
+
+func TestAnnotationRules(t *testing.T) {
+	readOnlyTool := annotatedTool("list_pods", mcp.ToBoolPtr(true), nil)
+	destructiveTool := annotatedTool("restart_pod", mcp.ToBoolPtr(false), mcp.ToBoolPtr(true))
+	unannotatedTool := annotatedTool("describe_pod", nil, nil)
+	additiveTool := annotatedTool("create_ticket", mcp.ToBoolPtr(false), mcp.ToBoolPtr(false))
+
+	readOnly, err := NewToolPolicy(models.MCPDataSourceSettings{ReadOnlyTools: true})
+	require.NoError(t, err)
+	assert.True(t, readOnly.NeedsAnnotations())
+	assert.NoError(t, readOnly.Check(readOnlyTool))
+	assert.Error(t, readOnly.Check(destructiveTool))
+	assert.Error(t, readOnly.Check(unannotatedTool))
+
+	noDestructive, err := NewToolPolicy(models.MCPDataSourceSettings{BlockDestructiveTools: true})
+	require.NoError(t, err)
+	assert.NoError(t, noDestructive.Check(readOnlyTool))
+	assert.Error(t, noDestructive.Check(destructiveTool))
+	assert.Error(t, noDestructive.Check(unannotatedTool), "tools are destructive unless annotated otherwise")
+	assert.NoError(t, noDestructive.Check(additiveTool))
+
+	tools := []mcp.Tool{readOnlyTool, destructiveTool, unannotatedTool, additiveTool}
+	filtered := noDestructive.Filter(tools)
+	require.Len(t, filtered, 2)
+	assert.Equal(t, "list_pods", filtered[0].Name)
+	assert.Equal(t, "create_ticket", filtered[1].Name)
+
+	assert.NoError(t, noDestructive.CheckCall("list_pods", tools))
+	assert.Error(t, noDestructive.CheckCall("restart_pod", tools))
+	assert.Error(t, noDestructive.CheckCall("unknown_tool", tools), "unknown tools cannot be verified")
+}
+
+func TestNilPolicyAllowsEverything(t *testing.T) {
+	var p *ToolPolicy
+	tools := []mcp.Tool{annotatedTool("anything", nil, mcp.ToBoolPtr(true))}
+
+	assert.False(t, p.NeedsAnnotations())
+	assert.NoError(t, p.CheckCall("anything", nil))
+	assert.Len(t, p.Filter(tools), 1)
+}
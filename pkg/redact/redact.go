@@ -0,0 +1,216 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"grafana-mcpclient-datasource/pkg/models"
+)
+
+// SecretPlaceholder replaces the values of secure arguments
+const SecretPlaceholder = "[REDACTED]"
+
+// rule is a single redaction rule. replacement may reference capture groups.
+type rule struct {
+	name        string
+	re          *regexp.Regexp
+	replacement string
+}
+
+// detectors are the built-in redaction rules, grouped by detector name
+var detectors = map[string][]rule{
+	"secrets": {
+		{name: "private_key", re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), replacement: "[REDACTED:private_key]"},
+		{name: "jwt", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{5,}`), replacement: "[REDACTED:jwt]"},
+		{name: "bearer", re: regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]{8,}=*`), replacement: "$1 [REDACTED:token]"},
+		{name: "aws_access_key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), replacement: "[REDACTED:aws_access_key]"},
+		{name: "api_token", re: regexp.MustCompile(`\b(?:sk-(?:ant-)?[A-Za-z0-9_-]{16,}|gh[pousr]_[A-Za-z0-9]{20,}|glsa_[A-Za-z0-9_]{20,}|glc_[A-Za-z0-9+/=_]{20,}|xox[abposr]-[A-Za-z0-9-]{10,})`), replacement: "[REDACTED:token]"},
+		{name: "secret_assignment", re: regexp.MustCompile(`(?i)\b(password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|client[_-]?secret)(\s*[:=]\s*)("[^"]*"|'[^']*'|[^\s,;&"']+)`), replacement: "$1$2[REDACTED:secret]"},
+	},
+	"email": {
+		{name: "email", re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`), replacement: "[REDACTED:email]"},
+	},
+	"ip": {
+		{name: "ipv4", re: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`), replacement: "[REDACTED:ip]"},
+	},
+}
+
+// DefaultDetectors are used when no detectors are configured. Admins opt out of
+// a detector by listing only the ones they want.
+var DefaultDetectors = []string{"secrets", "email", "ip"}
+
+// Redactor removes secrets and PII from text before it is sent to an LLM or logged.
+//
+// Values of the datasource's secure arguments are always masked, even when
+// redaction is disabled. A nil *Redactor returns its input unchanged.
+type Redactor struct {
+	secureArgs   map[string]bool
+	secureValues []string
+	rules        []rule
+}
+
+// NewRedactor creates a redactor from the datasource settings
+func NewRedactor(settings models.MCPDataSourceSettings) (*Redactor, error) {
+	r := &Redactor{
+		secureArgs: make(map[string]bool, len(settings.SecureArguments)),
+	}
+
+	for _, name := range settings.SecureArguments {
+		r.secureArgs[strings.ToLower(name)] = true
+		if value := settings.Arguments[name]; value != "" {
+			r.secureValues = append(r.secureValues, value)
+		}
+	}
+	// Replace longer values first so overlapping secrets are fully masked
+	sort.Slice(r.secureValues, func(i, j int) bool { return len(r.secureValues[i]) > len(r.secureValues[j]) })
+
+	if settings.DisableRedaction {
+		return r, nil
+	}
+
+	names := settings.RedactionDetectors
+	if len(names) == 0 {
+		names = DefaultDetectors
+	}
+	for _, name := range names {
+		rules, ok := detectors[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction detector: %s (supported: secrets, email, ip)", name)
+		}
+		r.rules = append(r.rules, rules...)
+	}
+
+	for i, pattern := range settings.RedactionPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern '%s': %w", pattern, err)
+		}
+		r.rules = append(r.rules, rule{name: fmt.Sprintf("pattern_%d", i), re: re, replacement: SecretPlaceholder})
+	}
+
+	return r, nil
+}
+
+// String applies secure value masking and all redaction rules to s
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	s = r.MaskSecrets(s)
+	for _, rule := range r.rules {
+		s = rule.re.ReplaceAllString(s, rule.replacement)
+	}
+	return s
+}
+
+// MaskSecrets replaces only the values of secure arguments in s
+func (r *Redactor) MaskSecrets(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, value := range r.secureValues {
+		s = strings.ReplaceAll(s, value, SecretPlaceholder)
+	}
+	return s
+}
+
+// Value returns a copy of v with String applied to every string it contains.
+// Map entries whose key is a secure argument name are masked entirely.
+func (r *Redactor) Value(v interface{}) interface{} {
+	if r == nil {
+		return v
+	}
+	return r.walk(v, r.String)
+}
+
+// MaskSecretsValue returns a copy of v with MaskSecrets applied to every string
+// it contains. Map entries whose key is a secure argument name are masked entirely.
+func (r *Redactor) MaskSecretsValue(v interface{}) interface{} {
+	if r == nil {
+		return v
+	}
+	return r.walk(v, r.MaskSecrets)
+}
+
+// Arguments applies Value to a tool arguments map
+func (r *Redactor) Arguments(arguments map[string]interface{}) map[string]interface{} {
+	if r == nil || arguments == nil {
+		return arguments
+	}
+	redacted, _ := r.Value(arguments).(map[string]interface{})
+	return redacted
+}
+
+// JSON encodes v as JSON with String applied to every string value it contains.
+// Object keys are kept, so the encoding still matches the type of v.
+func (r *Redactor) JSON(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || r == nil {
+		return data, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(r.redactStrings(value))
+}
+
+// redactStrings returns a copy of a decoded JSON value with String applied to
+// its string values
+func (r *Redactor) redactStrings(v interface{}) interface{} {
+	switch value := v.(type) {
+	case string:
+		return r.String(value)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			redacted[key] = r.redactStrings(item)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(value))
+		for i, item := range value {
+			redacted[i] = r.redactStrings(item)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
+
+func (r *Redactor) walk(v interface{}, redactString func(string) string) interface{} {
+	switch value := v.(type) {
+	case string:
+		return redactString(value)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			if r.secureArgs[strings.ToLower(key)] {
+				redacted[key] = SecretPlaceholder
+				continue
+			}
+			redacted[key] = r.walk(item, redactString)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(value))
+		for i, item := range value {
+			redacted[i] = r.walk(item, redactString)
+		}
+		return redacted
+	case []map[string]interface{}:
+		redacted := make([]map[string]interface{}, len(value))
+		for i, item := range value {
+			redacted[i], _ = r.walk(item, redactString).(map[string]interface{})
+		}
+		return redacted
+	default:
+		return v
+	}
+}
@@ -0,0 +1,151 @@
+package structuring
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// formatLokiAPI is the format of Loki query API results with log streams
+const formatLokiAPI = "loki_api"
+
+// Label types of the labelTypes field, as the Loki datasource marks them
+const (
+	labelTypeIndexed    = "I"
+	labelTypeStructured = "S"
+	labelTypeParsed     = "P"
+)
+
+// lokiStream is a stream of a Loki streams result
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values []lokiEntry       `json:"values"`
+}
+
+// lokiEntry is a ["<unix nanoseconds>", "<line>", {<metadata>}] log entry. The
+// metadata is either the structured metadata itself or, with categorized labels,
+// {"structuredMetadata": {...}, "parsed": {...}}.
+type lokiEntry struct {
+	Time               time.Time
+	Line               string
+	StructuredMetadata map[string]string
+	Parsed             map[string]string
+}
+
+func (e *lokiEntry) UnmarshalJSON(raw []byte) error {
+	var entry []json.RawMessage
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return err
+	}
+	if len(entry) < 2 || len(entry) > 3 {
+		return fmt.Errorf("log entry has %d elements, not 2 or 3", len(entry))
+	}
+
+	var timestamp string
+	if err := json.Unmarshal(entry[0], &timestamp); err != nil {
+		return fmt.Errorf("invalid log entry timestamp: %w", err)
+	}
+	ns, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid log entry timestamp %q", timestamp)
+	}
+	e.Time = time.Unix(0, ns).UTC()
+	if err := json.Unmarshal(entry[1], &e.Line); err != nil {
+		return fmt.Errorf("invalid log line: %w", err)
+	}
+	if len(entry) == 2 {
+		return nil
+	}
+
+	var categorized struct {
+		StructuredMetadata map[string]string `json:"structuredMetadata"`
+		Parsed             map[string]string `json:"parsed"`
+	}
+	if err := json.Unmarshal(entry[2], &categorized); err == nil && (categorized.StructuredMetadata != nil || categorized.Parsed != nil) {
+		e.StructuredMetadata, e.Parsed = categorized.StructuredMetadata, categorized.Parsed
+		return nil
+	}
+	if err := json.Unmarshal(entry[2], &e.StructuredMetadata); err != nil {
+		return fmt.Errorf("invalid log entry metadata: %w", err)
+	}
+	return nil
+}
+
+// queryResponseFrames converts a query API response into frames: log streams of
+// Loki into a logs frame, the other result types as prometheusFrames does. Loki
+// metric queries return the same matrix and vector results as Prometheus.
+func queryResponseFrames(response *queryResponse) ([]*data.Frame, error) {
+	if response.ResultType != "streams" {
+		return prometheusFrames(response)
+	}
+	var streams []lokiStream
+	if err := json.Unmarshal(response.Result, &streams); err != nil {
+		return nil, fmt.Errorf("invalid streams result: %w", err)
+	}
+	return []*data.Frame{logsFrame(streams)}, nil
+}
+
+// logsFrame merges log streams into a single logs frame with the newest line
+// first. The labels of each line are its stream labels, structured metadata and
+// parsed labels, and the labelTypes field tells them apart.
+func logsFrame(streams []lokiStream) *data.Frame {
+	type line struct {
+		entry  lokiEntry
+		stream map[string]string
+	}
+	var lines []line
+	for _, stream := range streams {
+		for _, entry := range stream.Values {
+			lines = append(lines, line{entry: entry, stream: stream.Stream})
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].entry.Time.After(lines[j].entry.Time)
+	})
+
+	labels := make([]json.RawMessage, len(lines))
+	labelTypes := make([]json.RawMessage, len(lines))
+	timestamps := make([]time.Time, len(lines))
+	bodies := make([]string, len(lines))
+	nanoseconds := make([]string, len(lines))
+	for i, l := range lines {
+		merged := make(map[string]string, len(l.stream)+len(l.entry.StructuredMetadata)+len(l.entry.Parsed))
+		types := make(map[string]string, len(merged))
+		for _, set := range []struct {
+			labels map[string]string
+			kind   string
+		}{
+			{l.stream, labelTypeIndexed},
+			{l.entry.StructuredMetadata, labelTypeStructured},
+			{l.entry.Parsed, labelTypeParsed},
+		} {
+			for key, value := range set.labels {
+				merged[key] = value
+				types[key] = set.kind
+			}
+		}
+		labels[i], _ = json.Marshal(merged)
+		labelTypes[i], _ = json.Marshal(types)
+		timestamps[i] = l.entry.Time
+		bodies[i] = l.entry.Line
+		nanoseconds[i] = strconv.FormatInt(l.entry.Time.UnixNano(), 10)
+	}
+
+	frame := data.NewFrame("logs",
+		data.NewField("labels", nil, labels),
+		data.NewField("timestamp", nil, timestamps),
+		data.NewField("body", nil, bodies),
+		data.NewField("tsNs", nil, nanoseconds),
+		data.NewField("labelTypes", nil, labelTypes),
+	)
+	frame.Meta = &data.FrameMeta{
+		Type:                   data.FrameTypeLogLines,
+		TypeVersion:            data.FrameTypeVersion{0, 0},
+		PreferredVisualization: data.VisTypeLogs,
+	}
+	return frame
+}
@@ -0,0 +1,71 @@
+package structuring
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLokiStreams(t *testing.T) {
+	text := `{"status": "success", "data": {"resultType": "streams", "result": [
+		{"stream": {"job": "api", "level": "error"}, "values": [
+			["1700000000000000001", "connection refused", {"structuredMetadata": {"trace_id": "abc"}, "parsed": {"status": "503"}}],
+			["1700000000000000000", "retrying"]
+		]},
+		{"stream": {"job": "db"}, "values": [["1700000000500000000", "slow query", {"trace_id": "def"}]]}
+	], "stats": {}}}`
+
+	result := Structure([]Output{{Tool: "loki_query", Text: text}})
+	require.NotNil(t, result)
+	assert.Equal(t, formatLokiAPI, result.Metadata["format"])
+	assert.Equal(t, "3 log lines from loki_query", result.Summary)
+	require.Len(t, result.Frames, 1)
+
+	frame := result.Frames[0]
+	assert.Equal(t, data.FrameTypeLogLines, frame.Meta.Type)
+	require.Equal(t, 3, frame.Rows())
+	timestamp, _ := frame.FieldByName("timestamp")
+	body, _ := frame.FieldByName("body")
+	nanoseconds, _ := frame.FieldByName("tsNs")
+	labels, _ := frame.FieldByName("labels")
+	labelTypes, _ := frame.FieldByName("labelTypes")
+
+	// Newest first, with nanosecond precision
+	assert.Equal(t, time.Unix(0, 1700000000500000000).UTC(), timestamp.At(0))
+	assert.Equal(t, []interface{}{"slow query", "connection refused", "retrying"}, []interface{}{body.At(0), body.At(1), body.At(2)})
+	assert.Equal(t, "1700000000000000001", nanoseconds.At(1))
+
+	assert.JSONEq(t, `{"job": "db", "trace_id": "def"}`, string(labels.At(0).(json.RawMessage)))
+	assert.JSONEq(t, `{"job": "I", "trace_id": "S"}`, string(labelTypes.At(0).(json.RawMessage)))
+	assert.JSONEq(t, `{"job": "api", "level": "error", "trace_id": "abc", "status": "503"}`, string(labels.At(1).(json.RawMessage)))
+	assert.JSONEq(t, `{"job": "I", "level": "I", "trace_id": "S", "status": "P"}`, string(labelTypes.At(1).(json.RawMessage)))
+	assert.JSONEq(t, `{"job": "api", "level": "error"}`, string(labels.At(2).(json.RawMessage)))
+}
+
+func TestLokiMatrix(t *testing.T) {
+	result := queryResponseResult("loki_query",
+		`{"resultType": "matrix", "result": [{"metric": {"job": "api"}, "values": [[1700000000, "0.5"]]}]}`)
+	require.NotNil(t, result)
+	assert.Equal(t, formatPrometheusAPI, result.Metadata["format"])
+	require.Len(t, result.Frames, 1)
+	assert.Equal(t, data.Labels{"job": "api"}, result.Frames[0].Fields[1].Labels)
+	assert.Equal(t, 0.5, result.Frames[0].Fields[1].At(0))
+}
+
+func TestStructureRawLogLines(t *testing.T) {
+	result := Structure([]Output{{Tool: "loki_query", Text: "timestamp level message\n" +
+		"2023-12-07T10:30:45Z {job=myapp, level=info} Started\n" +
+		"2023-12-07T10:30:46Z\n" +
+		"2023-12-07T10:30:47Z Stopped without labels"}})
+	require.NotNil(t, result)
+	assert.Equal(t, formatLogs, result.Metadata["format"])
+	assert.Equal(t, rawLogColumns, result.Columns)
+	require.Len(t, result.Data, 4)
+	assert.Equal(t, map[string]interface{}{"timestamp": "2023-12-07T10:30:45Z", "labels": "{job=myapp, level=info}", "message": "Started"}, result.Data[1])
+	assert.Equal(t, map[string]interface{}{"timestamp": "2023-12-07T10:30:46Z", "labels": "", "message": ""}, result.Data[2])
+	assert.Equal(t, map[string]interface{}{"timestamp": "2023-12-07T10:30:47Z", "labels": "", "message": "Stopped without labels"}, result.Data[3])
+}
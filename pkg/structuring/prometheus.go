@@ -0,0 +1,195 @@
+package structuring
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// formatPrometheusAPI is the format of Prometheus query API results
+const formatPrometheusAPI = "prometheus_api"
+
+// queryResponse is the data of a Prometheus, Mimir or Loki query API response
+type queryResponse struct {
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// decodeQueryResponse finds query API data in text: a whole API response, as in
+// {"status": "success", "data": {"resultType": ...}}, or its data alone
+func decodeQueryResponse(text string) (*queryResponse, bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "{") || !strings.Contains(text, `"resultType"`) {
+		return nil, false
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &fields); err != nil {
+		return nil, false
+	}
+	if _, ok := fields["resultType"]; !ok {
+		if inner, ok := fields["data"]; ok {
+			return decodeQueryResponse(string(inner))
+		}
+		return nil, false
+	}
+
+	var response queryResponse
+	if err := json.Unmarshal([]byte(text), &response); err != nil || response.ResultType == "" {
+		return nil, false
+	}
+	return &response, true
+}
+
+// promSeries is a series of a vector or matrix result
+type promSeries struct {
+	Metric map[string]string `json:"metric"`
+	Value  *promSample       `json:"value"`
+	Values []promSample      `json:"values"`
+}
+
+// promSample is a [<unix seconds>, "<value>"] pair
+type promSample struct {
+	Time  time.Time
+	Value string
+}
+
+func (s *promSample) UnmarshalJSON(raw []byte) error {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(raw, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 {
+		return fmt.Errorf("sample has %d elements, not 2", len(pair))
+	}
+	var seconds float64
+	if err := json.Unmarshal(pair[0], &seconds); err != nil {
+		return fmt.Errorf("invalid sample timestamp: %w", err)
+	}
+	s.Time = time.UnixMilli(int64(math.Round(seconds * 1000))).UTC()
+	return json.Unmarshal(pair[1], &s.Value)
+}
+
+// prometheusFrames converts a vector, matrix, scalar or string result into
+// frames. Vectors and matrices give a time series frame per series, with the
+// series labels on the value field, as the Prometheus datasource returns them.
+func prometheusFrames(response *queryResponse) ([]*data.Frame, error) {
+	switch response.ResultType {
+	case "vector", "matrix":
+		var series []promSeries
+		if err := json.Unmarshal(response.Result, &series); err != nil {
+			return nil, fmt.Errorf("invalid %s result: %w", response.ResultType, err)
+		}
+		frames := make([]*data.Frame, 0, len(series))
+		for _, s := range series {
+			samples := s.Values
+			if s.Value != nil {
+				samples = append(samples, *s.Value)
+			}
+			frame, err := seriesFrame(s.Metric, samples)
+			if err != nil {
+				return nil, err
+			}
+			frames = append(frames, frame)
+		}
+		return frames, nil
+	case "scalar":
+		var sample promSample
+		if err := json.Unmarshal(response.Result, &sample); err != nil {
+			return nil, fmt.Errorf("invalid scalar result: %w", err)
+		}
+		frame, err := seriesFrame(nil, []promSample{sample})
+		if err != nil {
+			return nil, err
+		}
+		frame.Name = "scalar"
+		return []*data.Frame{frame}, nil
+	case "string":
+		var sample promSample
+		if err := json.Unmarshal(response.Result, &sample); err != nil {
+			return nil, fmt.Errorf("invalid string result: %w", err)
+		}
+		return []*data.Frame{data.NewFrame("string",
+			data.NewField(data.TimeSeriesTimeFieldName, nil, []time.Time{sample.Time}),
+			data.NewField(data.TimeSeriesValueFieldName, nil, []string{sample.Value}),
+		)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported result type %q", response.ResultType)
+	}
+}
+
+// seriesFrame returns the time series frame of the samples of a series
+func seriesFrame(labels map[string]string, samples []promSample) (*data.Frame, error) {
+	times := make([]time.Time, len(samples))
+	values := make([]float64, len(samples))
+	for i, sample := range samples {
+		value, err := strconv.ParseFloat(sample.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sample value %q of %s", sample.Value, seriesName(labels))
+		}
+		times[i], values[i] = sample.Time, value
+	}
+
+	frame := data.NewFrame(seriesName(labels),
+		data.NewField(data.TimeSeriesTimeFieldName, nil, times),
+		data.NewField(data.TimeSeriesValueFieldName, data.Labels(labels), values),
+	)
+	frame.Meta = &data.FrameMeta{Type: data.FrameTypeTimeSeriesMulti, TypeVersion: data.FrameTypeVersion{0, 1}}
+	return frame, nil
+}
+
+// seriesName names a series in PromQL notation, e.g. up{instance="a:9090",job="api"}
+func seriesName(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		if key != "__name__" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s=%q", key, labels[key])
+	}
+	name := labels["__name__"]
+	if len(pairs) > 0 || name == "" {
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	return name
+}
+
+// queryResponseResult structures the result of a Prometheus or Loki query API
+// response, or returns nil if text is no such response
+func queryResponseResult(tool, text string) *Result {
+	response, ok := decodeQueryResponse(text)
+	if !ok {
+		return nil
+	}
+	frames, err := queryResponseFrames(response)
+	if err != nil {
+		return nil
+	}
+
+	format := formatPrometheusAPI
+	summary := fmt.Sprintf("%d series of the %s result from %s", len(frames), response.ResultType, tool)
+	if response.ResultType == "streams" {
+		format = formatLokiAPI
+		summary = fmt.Sprintf("%d log lines from %s", frames[0].Rows(), tool)
+	}
+	return &Result{
+		Data:    []map[string]interface{}{},
+		Columns: []string{},
+		Frames:  frames,
+		Summary: summary,
+		Metadata: map[string]interface{}{
+			"format":      format,
+			"result_type": response.ResultType,
+		},
+	}
+}
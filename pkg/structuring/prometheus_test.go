@@ -0,0 +1,63 @@
+package structuring
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusMatrix(t *testing.T) {
+	text := `{"status": "success", "data": {"resultType": "matrix", "result": [
+		{"metric": {"__name__": "up", "job": "api", "instance": "a:9090"}, "values": [[1700000000, "1"], [1700000015.5, "0"]]},
+		{"metric": {"job": "db"}, "values": [[1700000000, "NaN"]]}
+	]}}`
+
+	result := Structure([]Output{{Tool: "query_range", Text: text}})
+	require.NotNil(t, result)
+	assert.Equal(t, "matrix", result.Metadata["result_type"])
+	assert.Equal(t, formatPrometheusAPI, result.Metadata["format"])
+	require.Len(t, result.Frames, 2)
+
+	frame := result.Frames[0]
+	assert.Equal(t, `up{instance="a:9090",job="api"}`, frame.Name)
+	assert.Equal(t, data.FrameTypeTimeSeriesMulti, frame.Meta.Type)
+	require.Len(t, frame.Fields, 2)
+	assert.Equal(t, time.UnixMilli(1700000015500).UTC(), frame.Fields[0].At(1))
+	assert.Equal(t, data.Labels{"__name__": "up", "job": "api", "instance": "a:9090"}, frame.Fields[1].Labels)
+	assert.Equal(t, 1.0, frame.Fields[1].At(0))
+	assert.Equal(t, 0.0, frame.Fields[1].At(1))
+
+	assert.Equal(t, `{job="db"}`, result.Frames[1].Name)
+	value, _ := result.Frames[1].Fields[1].At(0).(float64)
+	assert.True(t, math.IsNaN(value), "NaN is kept")
+}
+
+func TestPrometheusVectorAndScalar(t *testing.T) {
+	response, ok := decodeQueryResponse(`{"resultType": "vector", "result": [{"metric": {"code": "500"}, "value": [1700000000, "3"]}]}`)
+	require.True(t, ok)
+	frames, err := prometheusFrames(response)
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	assert.Equal(t, 1, frames[0].Rows())
+	assert.Equal(t, data.Labels{"code": "500"}, frames[0].Fields[1].Labels)
+	assert.Equal(t, 3.0, frames[0].Fields[1].At(0))
+
+	response, ok = decodeQueryResponse(`{"data": {"resultType": "scalar", "result": [1700000000, "0.25"]}}`)
+	require.True(t, ok)
+	frames, err = prometheusFrames(response)
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	assert.Equal(t, "scalar", frames[0].Name)
+	assert.Equal(t, 0.25, frames[0].Fields[1].At(0))
+
+	_, ok = decodeQueryResponse(`{"data": [{"resultType": "a"}]}`)
+	assert.False(t, ok)
+	response, ok = decodeQueryResponse(`{"resultType": "vector", "result": [{"metric": {}, "value": [1700000000, "high"]}]}`)
+	require.True(t, ok)
+	_, err = prometheusFrames(response)
+	assert.Error(t, err)
+}
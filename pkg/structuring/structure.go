@@ -0,0 +1,335 @@
+package structuring
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Output is the text a tool returned
+type Output struct {
+	Tool string
+	Text string
+}
+
+// Result is tool output structured without the LLM
+type Result struct {
+	// Data and Columns are the rows of the first output, if it has rows
+	Data    []map[string]interface{}
+	Columns []string
+	// Frames are built directly for output that has a better shape than a flat
+	// table, e.g. a time series per series of a Prometheus result
+	Frames []*data.Frame
+	// Tables are further tables, e.g. one per output after the first
+	Tables   []Table
+	Summary  string
+	Metadata map[string]interface{}
+}
+
+// Table is a named table of rows
+type Table struct {
+	Name     string                   `json:"name"`
+	Data     []map[string]interface{} `json:"data"`
+	Columns  []string                 `json:"columns"`
+	Metadata map[string]interface{}   `json:"metadata,omitempty"`
+}
+
+// Structure structures the output of tools without the LLM. The first output
+// gives the rows of the result, the others follow as tables and frames of their
+// own, named after their tool. It returns nil if there is no output or any of it
+// is in a format none of the parsers accepts.
+func Structure(outputs []Output) *Result {
+	var combined *Result
+	var summaries []string
+	names := newColumnSet()
+	for _, output := range outputs {
+		structured := structureText(output.Tool, output.Text)
+		if structured == nil {
+			return nil
+		}
+		name := names.addUnique(output.Tool)
+		summaries = append(summaries, structured.Summary)
+		if combined == nil {
+			combined = structured
+			continue
+		}
+
+		if len(structured.Data) > 0 {
+			combined.Tables = append(combined.Tables, Table{
+				Name:     name,
+				Data:     structured.Data,
+				Columns:  structured.Columns,
+				Metadata: structured.Metadata,
+			})
+		}
+		combined.Frames = append(combined.Frames, structured.Frames...)
+		combined.Tables = append(combined.Tables, structured.Tables...)
+	}
+	if combined == nil {
+		return nil
+	}
+
+	combined.Summary = strings.Join(summaries, "; ")
+	return combined
+}
+
+// structureText structures the output of a tool, or returns nil if none of the
+// parsers accepts it
+func structureText(tool, text string) *Result {
+	// Query API results become a time series per series, or a logs frame for Loki
+	// streams, rather than a flat table
+	if structured := queryResponseResult(tool, text); structured != nil {
+		return structured
+	}
+
+	trimmed := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		if structured := jsonResult(tool, text); structured != nil {
+			return structured
+		}
+	}
+
+	// Try the formats the structuring engine recognises
+	if parsed := parseText(text); parsed != nil {
+		return &Result{
+			Data:     parsed.rows,
+			Columns:  parsed.columns,
+			Summary:  fmt.Sprintf("Parsed %d rows of %s from %s", len(parsed.rows), parsed.format, tool),
+			Metadata: map[string]interface{}{"format": parsed.format},
+		}
+	}
+
+	// Try to detect structured log data (common patterns)
+	if looksLikeLogData(text) {
+		return logResult(tool, text)
+	}
+	return nil
+}
+
+// jsonResult structures a JSON array of objects or a JSON object, or returns nil
+// for other JSON documents
+func jsonResult(tool, text string) *Result {
+	var document interface{}
+	if err := json.Unmarshal([]byte(text), &document); err != nil {
+		return nil
+	}
+
+	switch v := document.(type) {
+	case []interface{}:
+		if len(v) == 0 {
+			return &Result{
+				Data:     []map[string]interface{}{},
+				Columns:  []string{},
+				Summary:  "No data returned",
+				Metadata: map[string]interface{}{"format": formatJSON},
+			}
+		}
+		rows := make([]map[string]interface{}, len(v))
+		for i, item := range v {
+			object, ok := item.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			rows[i] = object
+		}
+		return &Result{
+			Data:     rows,
+			Columns:  jsonColumns(rows, text),
+			Summary:  fmt.Sprintf("Parsed %d JSON records from %s", len(rows), tool),
+			Metadata: map[string]interface{}{"format": formatJSON},
+		}
+
+	case map[string]interface{}:
+		// Several arrays of objects, e.g. {"services": [...], "hosts": [...]}, are
+		// returned as a table each
+		if tables := objectTables(v, text); len(tables) > 1 {
+			return &Result{
+				Data:     []map[string]interface{}{},
+				Columns:  []string{},
+				Tables:   tables,
+				Summary:  fmt.Sprintf("Parsed %d JSON tables from %s", len(tables), tool),
+				Metadata: map[string]interface{}{"format": formatJSON},
+			}
+		}
+
+		rows := []map[string]interface{}{v}
+		return &Result{
+			Data:     rows,
+			Columns:  jsonColumns(rows, text),
+			Summary:  fmt.Sprintf("Parsed JSON object from %s", tool),
+			Metadata: map[string]interface{}{"format": formatJSON},
+		}
+	}
+	return nil
+}
+
+// objectTables returns a table for each property of a JSON object that holds an
+// array of objects, in the order of the properties in the document
+func objectTables(object map[string]interface{}, document string) []Table {
+	var properties map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(document), &properties); err != nil {
+		return nil
+	}
+
+	var tables []Table
+	for _, key := range ObjectKeys(document) {
+		items, ok := object[key].([]interface{})
+		if !ok || len(items) == 0 {
+			continue
+		}
+		rows := make([]map[string]interface{}, 0, len(items))
+		for _, item := range items {
+			if row, ok := item.(map[string]interface{}); ok {
+				rows = append(rows, row)
+			}
+		}
+		if len(rows) < len(items) {
+			continue
+		}
+		tables = append(tables, Table{
+			Name:    key,
+			Data:    rows,
+			Columns: jsonColumns(rows, string(properties[key])),
+		})
+	}
+	return tables
+}
+
+// looksLikeLogData checks if text appears to be in a structured log format
+func looksLikeLogData(text string) bool {
+	lines := strings.Split(text, "\n")
+	if len(lines) < 2 {
+		return false
+	}
+
+	// Look for common log patterns
+	logPatterns := []string{
+		"timestamp", "time", "level", "message", "msg",
+		"service", "logger", "@timestamp", "ts",
+	}
+
+	firstLine := strings.ToLower(lines[0])
+	matchCount := 0
+	for _, pattern := range logPatterns {
+		if strings.Contains(firstLine, pattern) {
+			matchCount++
+		}
+	}
+
+	return matchCount >= 2 // At least 2 log-like fields
+}
+
+// maxLogEntries limits the log lines logResult parses
+const maxLogEntries = 1000
+
+// logResult parses lines of JSON logs or raw log lines into log entries, or
+// returns nil if there are fewer than two lines
+func logResult(tool, text string) *Result {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) < 2 {
+		return nil
+	}
+
+	rows := make([]map[string]interface{}, 0, len(lines))
+	columns := newColumnSet()
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// Raw log lines are not JSON, they are split below
+		var entry map[string]interface{}
+		_ = json.Unmarshal([]byte(line), &entry)
+
+		// Columns keep the order of the keys in the lines
+		if entry == nil {
+			entry = parseRawLogLine(line)
+			for _, key := range rawLogColumns {
+				columns.add(key)
+			}
+		} else {
+			for _, key := range jsonColumns([]map[string]interface{}{entry}, line) {
+				columns.add(key)
+			}
+		}
+
+		rows = append(rows, entry)
+		if len(rows) >= maxLogEntries {
+			break
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return &Result{
+		Data:    rows,
+		Columns: columns.names,
+		Summary: fmt.Sprintf("Parsed %d log entries from %s", len(rows), tool),
+		Metadata: map[string]interface{}{
+			"format":      formatLogs,
+			"total_lines": len(lines),
+		},
+	}
+}
+
+// rawLogColumns are the columns of the entries returned by parseRawLogLine
+var rawLogColumns = []string{"timestamp", "labels", "message"}
+
+// parseRawLogLine splits a raw log line into timestamp, labels and message, e.g.
+// 2023-12-07T10:30:45Z {job=myapp, level=info} This is a log message
+// The labels and the message are optional.
+func parseRawLogLine(line string) map[string]interface{} {
+	timestamp, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+	rest = strings.TrimSpace(rest)
+
+	var labels string
+	if strings.HasPrefix(rest, "{") {
+		if end := strings.Index(rest, "}"); end >= 0 {
+			labels, rest = rest[:end+1], strings.TrimSpace(rest[end+1:])
+		}
+	}
+
+	return map[string]interface{}{
+		"timestamp": timestamp,
+		"labels":    labels,
+		"message":   rest,
+	}
+}
+
+// ApplySpec extracts the rows of output with the spec the LLM returned. Output
+// the spec does not fit is returned a line per row, so the table always shows the
+// tool output rather than nothing.
+func ApplySpec(spec *Spec, output Output) *Result {
+	result := &Result{
+		Summary: spec.Summary,
+		Metadata: map[string]interface{}{
+			"format":           formatMapping,
+			"structuring_spec": spec,
+		},
+	}
+
+	t, err := spec.apply(output.Text)
+	if err != nil {
+		result.Metadata["structuring_error"] = err.Error()
+		t = lineTable(output.Text)
+	}
+	result.Data, result.Columns = t.rows, t.columns
+	return result
+}
+
+// Lines returns output none of the parsers accepts a line per row, so the
+// complete text is shown without asking the LLM how to extract rows from it
+func Lines(output Output) *Result {
+	t := lineTable(output.Text)
+	return &Result{
+		Data:    t.rows,
+		Columns: t.columns,
+		Summary: fmt.Sprintf("%d lines from %s", len(t.rows), output.Tool),
+		Metadata: map[string]interface{}{
+			"format": t.format,
+		},
+	}
+}
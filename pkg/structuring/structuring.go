@@ -0,0 +1,654 @@
+package structuring
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Formats recognised by the structuring engine
+const (
+	formatJSON       = "json"
+	formatNDJSON     = "ndjson"
+	formatCSV        = "csv"
+	formatTSV        = "tsv"
+	formatMarkdown   = "markdown_table"
+	formatASCIITable = "ascii_table" // psql, MySQL and box-drawing tables
+	formatFixedWidth = "fixed_width" // column-aligned output such as kubectl get
+	formatLogfmt     = "logfmt"
+	formatPrometheus = "prometheus"
+	formatKeyValue   = "key_value"
+	formatLogs       = "logs"        // JSON or raw log lines
+	formatMapping    = "llm_mapping" // rows extracted with a Spec from the LLM
+	formatLines      = "lines"       // free text, a line per row
+)
+
+// table is tool output parsed into rows by the structuring engine
+type table struct {
+	format  string
+	columns []string
+	rows    []map[string]interface{}
+}
+
+// textParsers are tried in order by parseText. Each parser only accepts input it
+// fully understands, so the order only matters for input several formats accept.
+var textParsers = []struct {
+	format string
+	parse  func(text string) (*table, bool)
+}{
+	{formatJSON, parseJSONTable},
+	{formatNDJSON, parseNDJSON},
+	{formatPrometheus, parsePrometheus},
+	{formatMarkdown, parsePipeTable}, // also returns formatASCIITable
+	{formatLogfmt, parseLogfmt},
+	{formatKeyValue, parseKeyValue},
+	{formatTSV, func(text string) (*table, bool) { return parseDelimited(text, '\t') }},
+	{formatCSV, func(text string) (*table, bool) { return parseDelimited(text, ',') }},
+	{formatFixedWidth, parseFixedWidth},
+}
+
+// parseText parses tool output with the first parser that accepts it, or returns
+// nil if none does
+func parseText(text string) *table {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	for _, parser := range textParsers {
+		if t, ok := parser.parse(text); ok {
+			if t.format == "" {
+				t.format = parser.format
+			}
+			return t
+		}
+	}
+	return nil
+}
+
+// parseJSONTable parses a JSON document: an array of objects gives a row per
+// object, an object a single row and other values a single "value" column
+func parseJSONTable(text string) (*table, bool) {
+	if !strings.HasPrefix(text, "{") && !strings.HasPrefix(text, "[") {
+		return nil, false
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, false
+	}
+
+	var rows []map[string]interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		rows = make([]map[string]interface{}, len(v))
+		for i, element := range v {
+			if object, ok := element.(map[string]interface{}); ok {
+				rows[i] = object
+			} else {
+				rows[i] = map[string]interface{}{"value": element}
+			}
+		}
+	case map[string]interface{}:
+		rows = []map[string]interface{}{v}
+	}
+	return &table{columns: jsonColumns(rows, text), rows: rows}, true
+}
+
+// parseNDJSON parses newline delimited JSON objects
+func parseNDJSON(text string) (*table, bool) {
+	lines := nonEmptyLines(text)
+	if len(lines) < 2 {
+		return nil, false
+	}
+	rows := make([]map[string]interface{}, 0, len(lines))
+	for _, line := range lines {
+		var row map[string]interface{}
+		if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &row) != nil {
+			return nil, false
+		}
+		rows = append(rows, row)
+	}
+	return &table{columns: jsonColumns(rows, lines...), rows: rows}, true
+}
+
+// prometheusSample matches a sample of the Prometheus exposition format:
+// name, optional labels, value and optional timestamp in milliseconds
+var prometheusSample = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{.*\})?\s+(\S+)(?:\s+(-?\d+))?$`)
+
+// parsePrometheus parses the Prometheus text exposition format into a row per
+// sample, with a column per label
+func parsePrometheus(text string) (*table, bool) {
+	columns := newColumnSet("metric")
+	var rows []map[string]interface{}
+	var described, labelled, timestamped bool
+	for _, line := range nonEmptyLines(text) {
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 3 && (fields[1] == "HELP" || fields[1] == "TYPE") {
+				described = true
+			}
+			continue
+		}
+		match := prometheusSample.FindStringSubmatch(line)
+		if match == nil {
+			return nil, false
+		}
+		value, err := strconv.ParseFloat(match[3], 64)
+		if err != nil {
+			return nil, false
+		}
+		labels, ok := parseLabels(match[2])
+		if !ok {
+			return nil, false
+		}
+
+		row := map[string]interface{}{"metric": match[1]}
+		for _, label := range labels {
+			if label[0] == "metric" || label[0] == "value" || label[0] == "timestamp" {
+				// Keep labels from overwriting the sample columns
+				label[0] = "label_" + label[0]
+			}
+			columns.add(label[0])
+			row[label[0]] = label[1]
+			labelled = true
+		}
+		row["value"] = value
+		if match[4] != "" {
+			ms, err := strconv.ParseInt(match[4], 10, 64)
+			if err != nil {
+				return nil, false
+			}
+			row["timestamp"] = time.UnixMilli(ms).UTC()
+			timestamped = true
+		}
+		rows = append(rows, row)
+	}
+	// "name value" lines alone are too common to be taken for metrics
+	if len(rows) == 0 || !described && !labelled {
+		return nil, false
+	}
+
+	columns.add("value")
+	if timestamped {
+		columns.add("timestamp")
+	}
+	return &table{columns: columns.names, rows: rows}, true
+}
+
+// parseLabels parses the label set of a Prometheus sample, e.g. {job="api",code="500"}
+func parseLabels(text string) ([][2]string, bool) {
+	if text == "" {
+		return nil, true
+	}
+	text = strings.TrimSpace(text[1 : len(text)-1])
+	var labels [][2]string
+	for text != "" {
+		name, rest, ok := strings.Cut(text, "=")
+		name = strings.TrimSpace(name)
+		rest = strings.TrimSpace(rest)
+		if !ok || name == "" || !strings.HasPrefix(rest, `"`) {
+			return nil, false
+		}
+		value, rest, ok := unquote(rest)
+		if !ok {
+			return nil, false
+		}
+		labels = append(labels, [2]string{name, value})
+		rest = strings.TrimSpace(rest)
+		if rest != "" && !strings.HasPrefix(rest, ",") {
+			return nil, false
+		}
+		text = strings.TrimSpace(strings.TrimPrefix(rest, ","))
+	}
+	return labels, true
+}
+
+// unquote reads a double quoted string with backslash escapes from the start of
+// text, returning its value and the text after it
+func unquote(text string) (string, string, bool) {
+	var value strings.Builder
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if i+1 == len(text) {
+				return "", "", false
+			}
+			i++
+			switch text[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			default:
+				value.WriteByte(text[i])
+			}
+		case '"':
+			return value.String(), text[i+1:], true
+		default:
+			value.WriteByte(text[i])
+		}
+	}
+	return "", "", false
+}
+
+// parseLogfmt parses lines of key=value pairs, with a column per key
+func parseLogfmt(text string) (*table, bool) {
+	lines := nonEmptyLines(text)
+	columns := newColumnSet()
+	rows := make([]map[string]interface{}, 0, len(lines))
+	pairs := 0
+	for _, line := range lines {
+		row := make(map[string]interface{})
+		for line != "" {
+			key, rest, ok := strings.Cut(line, "=")
+			if !ok || key == "" || strings.ContainsAny(key, " \t\"") {
+				return nil, false
+			}
+			var value string
+			if strings.HasPrefix(rest, `"`) {
+				if value, rest, ok = unquote(rest); !ok {
+					return nil, false
+				}
+				if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+					return nil, false
+				}
+			} else if end := strings.IndexAny(rest, " \t"); end >= 0 {
+				value, rest = rest[:end], rest[end:]
+			} else {
+				value, rest = rest, ""
+			}
+			row[columns.add(key)] = value
+			pairs++
+			line = strings.TrimSpace(rest)
+		}
+		rows = append(rows, row)
+	}
+	if pairs < 2 {
+		return nil, false
+	}
+	typeColumns(rows, columns.names)
+	return &table{columns: columns.names, rows: rows}, true
+}
+
+// keyPattern matches the keys of key: value blocks
+var keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_ .()/-]{0,63}$`)
+
+// parseKeyValue parses "key: value" lines. Blocks separated by blank lines give a
+// row each, e.g. the description of several resources.
+func parseKeyValue(text string) (*table, bool) {
+	columns := newColumnSet()
+	var rows []map[string]interface{}
+	var row map[string]interface{}
+	lines := 0
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			row = nil
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !ok || !keyPattern.MatchString(key) || value != "" && value[0] != ' ' && value[0] != '\t' {
+			return nil, false
+		}
+		if row == nil {
+			row = make(map[string]interface{})
+			rows = append(rows, row)
+		}
+		row[columns.add(key)] = strings.TrimSpace(value)
+		lines++
+	}
+	if lines < 2 {
+		return nil, false
+	}
+	typeColumns(rows, columns.names)
+	return &table{columns: columns.names, rows: rows}, true
+}
+
+// parseDelimited parses comma or tab separated values with a header row. Every
+// row must have as many cells as the header.
+func parseDelimited(text string, comma rune) (*table, bool) {
+	lines := nonEmptyLines(text)
+	if len(lines) < 2 || !strings.ContainsRune(lines[0], comma) {
+		return nil, false
+	}
+	reader := csv.NewReader(strings.NewReader(strings.Join(lines, "\n")))
+	reader.Comma = comma
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil || len(records) < 2 {
+		return nil, false
+	}
+
+	columns := newColumnSet()
+	header := records[0]
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if !isColumnName(name) || columns.has(name) {
+			return nil, false
+		}
+		header[i] = columns.add(name)
+	}
+	rows := make([]map[string]interface{}, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(header))
+		for i, cell := range record {
+			row[header[i]] = strings.TrimSpace(cell)
+		}
+		rows = append(rows, row)
+	}
+	typeColumns(rows, columns.names)
+	return &table{columns: columns.names, rows: rows}, true
+}
+
+// isColumnName reports whether a header cell looks like a column name rather than
+// data, to keep prose and log lines that happen to contain commas from parsing
+func isColumnName(name string) bool {
+	if name == "" || utf8.RuneCountInString(name) > 64 || strings.ContainsAny(name, "{}[]=") {
+		return false
+	}
+	_, err := strconv.ParseFloat(name, 64)
+	return err != nil
+}
+
+// Spec is what the LLM returns for output none of the parsers accepts:
+// how to extract rows from the text, never the rows themselves. It is applied to
+// the complete output, of which the LLM only saw a sample.
+type Spec struct {
+	Pattern   string   `json:"pattern,omitempty"`   // regular expression with named groups, matched against each line
+	Delimiter string   `json:"delimiter,omitempty"` // cell delimiter of each line, "whitespace" for runs of spaces
+	Columns   []string `json:"columns,omitempty"`   // column names of delimited lines without a header
+	SkipLines int      `json:"skip_lines,omitempty"`
+	Summary   string   `json:"summary,omitempty"`
+}
+
+// apply extracts rows from text as described by the spec
+func (s *Spec) apply(text string) (*table, error) {
+	lines := nonEmptyLines(text)
+	if s.SkipLines > 0 {
+		lines = lines[min(s.SkipLines, len(lines)):]
+	}
+
+	var t *table
+	var err error
+	switch {
+	case s.Pattern != "":
+		t, err = s.applyPattern(lines)
+	case s.Delimiter != "":
+		t, err = s.applyDelimiter(lines)
+	default:
+		err = errors.New("the structuring spec has neither a pattern nor a delimiter")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(t.rows) == 0 {
+		return nil, errors.New("the structuring spec matched no rows")
+	}
+	t.format = formatMapping
+	typeColumns(t.rows, t.columns)
+	return t, nil
+}
+
+func (s *Spec) applyPattern(lines []string) (*table, error) {
+	pattern, err := regexp.Compile(s.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern in the structuring spec: %w", err)
+	}
+	columns := newColumnSet()
+	for _, name := range pattern.SubexpNames() {
+		if name != "" {
+			columns.add(name)
+		}
+	}
+	if len(columns.names) == 0 {
+		return nil, errors.New("the pattern of the structuring spec has no named groups")
+	}
+
+	t := &table{columns: columns.names}
+	for _, line := range lines {
+		match := pattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		row := make(map[string]interface{}, len(columns.names))
+		for i, name := range pattern.SubexpNames() {
+			if name != "" {
+				row[name] = strings.TrimSpace(match[i])
+			}
+		}
+		t.rows = append(t.rows, row)
+	}
+	return t, nil
+}
+
+func (s *Spec) applyDelimiter(lines []string) (*table, error) {
+	split := func(line string) []string {
+		if s.Delimiter == "whitespace" {
+			return strings.Fields(line)
+		}
+		return strings.Split(line, s.Delimiter)
+	}
+
+	header := s.Columns
+	if len(header) == 0 {
+		if len(lines) == 0 {
+			return nil, errors.New("no header line to take the column names from")
+		}
+		header, lines = split(lines[0]), lines[1:]
+	}
+	columns := newColumnSet()
+	names := make([]string, len(header))
+	for i, name := range header {
+		if name = strings.TrimSpace(name); name == "" {
+			name = fmt.Sprintf("column%d", i+1)
+		}
+		names[i] = columns.add(name)
+	}
+
+	t := &table{columns: columns.names}
+	for _, line := range lines {
+		row := make(map[string]interface{}, len(names))
+		cells := split(line)
+		for i, cell := range cells {
+			if i == len(names)-1 && len(cells) > len(names) && s.Delimiter == "whitespace" {
+				// The last column keeps the rest of the line, e.g. a message
+				row[names[i]] = strings.Join(cells[i:], " ")
+				break
+			}
+			if i < len(names) {
+				row[names[i]] = strings.TrimSpace(cell)
+			}
+		}
+		t.rows = append(t.rows, row)
+	}
+	return t, nil
+}
+
+// typeColumns converts the text cells of a column into numbers or booleans when
+// every non-empty cell of the column is one. Empty cells become nil.
+func typeColumns(rows []map[string]interface{}, columns []string) {
+	for _, column := range columns {
+		numbers, bools := true, true
+		for _, row := range rows {
+			cell, ok := row[column].(string)
+			if !ok || cell == "" {
+				continue
+			}
+			if _, err := strconv.ParseFloat(cell, 64); err != nil {
+				numbers = false
+			}
+			if !strings.EqualFold(cell, "true") && !strings.EqualFold(cell, "false") {
+				bools = false
+			}
+		}
+
+		for _, row := range rows {
+			cell, ok := row[column].(string)
+			switch {
+			case !ok:
+			case cell == "":
+				row[column] = nil
+			case numbers:
+				row[column], _ = strconv.ParseFloat(cell, 64)
+			case bools:
+				row[column] = strings.EqualFold(cell, "true")
+			}
+		}
+	}
+}
+
+// columnSet collects column names in the order they are first seen
+type columnSet struct {
+	names []string
+	seen  map[string]bool
+}
+
+func newColumnSet(names ...string) *columnSet {
+	set := &columnSet{seen: make(map[string]bool)}
+	for _, name := range names {
+		set.add(name)
+	}
+	return set
+}
+
+// add adds a column if it is new and returns its name
+func (c *columnSet) add(name string) string {
+	if !c.seen[name] {
+		c.seen[name] = true
+		c.names = append(c.names, name)
+	}
+	return name
+}
+
+// addUnique adds a column, suffixing its name with a number if it is taken, and
+// returns the name it was added with
+func (c *columnSet) addUnique(name string) string {
+	unique := name
+	for i := 2; c.seen[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	return c.add(unique)
+}
+
+func (c *columnSet) has(name string) bool {
+	return c.seen[name]
+}
+
+// jsonColumns returns the keys of the rows parsed from JSON documents in the
+// order they first appear in the documents, so columns do not change order
+// between refreshes. Keys missing from the documents follow in alphabetical order.
+func jsonColumns(rows []map[string]interface{}, documents ...string) []string {
+	columns := newColumnSet()
+	for _, document := range documents {
+		for _, key := range ObjectKeys(document) {
+			columns.add(key)
+		}
+	}
+
+	var missing []string
+	for _, row := range rows {
+		for key := range row {
+			if !columns.has(key) {
+				missing = append(missing, columns.add(key))
+			}
+		}
+	}
+	sort.Strings(missing)
+	return append(columns.names[:len(columns.names)-len(missing)], missing...)
+}
+
+// ObjectKeys returns the keys of a JSON object, or of the objects in a JSON
+// array, in the order they first appear. Nested objects are not looked into.
+func ObjectKeys(document string) []string {
+	return documentKeys(document, false)
+}
+
+// KeyOrder returns the keys of the objects of a JSON document at any depth, in
+// the order they first appear, e.g. to order the columns of rows selected from
+// the document
+func KeyOrder(document string) []string {
+	return documentKeys(document, true)
+}
+
+// documentKeys returns the keys of the row objects of a JSON document, or of all
+// its objects, in the order they first appear
+func documentKeys(document string, allDepths bool) []string {
+	type container struct {
+		object    bool
+		expectKey bool
+	}
+	var stack []container
+	rowDepth := 0 // depth of the objects whose keys are collected
+	columns := newColumnSet()
+
+	// valueDone moves the innermost object on to its next key
+	valueDone := func() {
+		if len(stack) > 0 && stack[len(stack)-1].object {
+			stack[len(stack)-1].expectKey = true
+		}
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(document))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return columns.names
+		}
+		if len(stack) > 0 && stack[len(stack)-1].expectKey {
+			if key, ok := token.(string); ok {
+				if allDepths || len(stack) == rowDepth {
+					columns.add(key)
+				}
+				stack[len(stack)-1].expectKey = false
+				continue
+			}
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			object := token == json.Delim('{')
+			if rowDepth == 0 {
+				rowDepth = 1
+				if !object {
+					rowDepth = 2
+				}
+			}
+			stack = append(stack, container{object: object, expectKey: object})
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return columns.names
+			}
+			valueDone()
+		default:
+			valueDone()
+		}
+	}
+}
+
+// lineTable returns a table with a row per non-empty line of text
+func lineTable(text string) *table {
+	t := &table{columns: []string{"line"}, format: formatLines}
+	for _, line := range nonEmptyLines(text) {
+		t.rows = append(t.rows, map[string]interface{}{"line": line})
+	}
+	return t
+}
+
+// nonEmptyLines returns the trimmed lines of text, without the blank ones
+func nonEmptyLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,194 @@
+package structuring
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseText(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		format  string
+		columns []string
+		rows    []map[string]interface{}
+	}{
+		{
+			name:    "json array of values",
+			text:    `[1, 2]`,
+			format:  formatJSON,
+			columns: []string{"value"},
+			rows:    []map[string]interface{}{{"value": 1.0}, {"value": 2.0}},
+		},
+		{
+			name:    "ndjson",
+			text:    "{\"level\": \"error\", \"msg\": \"boom\"}\n{\"level\": \"info\", \"msg\": \"ok\"}",
+			format:  formatNDJSON,
+			columns: []string{"level", "msg"},
+			rows:    []map[string]interface{}{{"level": "error", "msg": "boom"}, {"level": "info", "msg": "ok"}},
+		},
+		{
+			name:    "csv",
+			text:    "service,errors,healthy\napi,3,false\n\"db, primary\",,true",
+			format:  formatCSV,
+			columns: []string{"service", "errors", "healthy"},
+			rows: []map[string]interface{}{
+				{"service": "api", "errors": 3.0, "healthy": false},
+				{"service": "db, primary", "errors": nil, "healthy": true},
+			},
+		},
+		{
+			name:    "tsv",
+			text:    "pod\trestarts\nweb-1\t0\nweb-2\t4",
+			format:  formatTSV,
+			columns: []string{"pod", "restarts"},
+			rows:    []map[string]interface{}{{"pod": "web-1", "restarts": 0.0}, {"pod": "web-2", "restarts": 4.0}},
+		},
+		{
+			name:    "markdown table",
+			text:    "| Service | P99 (ms) |\n|:--|--:|\n| api | 120.5 |\n| a \\| b | 80 |",
+			format:  formatMarkdown,
+			columns: []string{"Service", "P99 (ms)"},
+			rows:    []map[string]interface{}{{"Service": "api", "P99 (ms)": 120.5}, {"Service": "a | b", "P99 (ms)": 80.0}},
+		},
+		{
+			name:    "logfmt",
+			text:    "ts=2024-01-02T10:00:00Z level=error msg=\"connection \\\"refused\\\"\" status=503\nts=2024-01-02T10:00:01Z level=info msg=ok",
+			format:  formatLogfmt,
+			columns: []string{"ts", "level", "msg", "status"},
+			rows: []map[string]interface{}{
+				{"ts": "2024-01-02T10:00:00Z", "level": "error", "msg": `connection "refused"`, "status": 503.0},
+				{"ts": "2024-01-02T10:00:01Z", "level": "info", "msg": "ok"},
+			},
+		},
+		{
+			name:    "prometheus exposition",
+			text:    "# HELP http_requests_total Requests\n# TYPE http_requests_total counter\nhttp_requests_total{code=\"200\",path=\"/a,b\"} 1027 1700000000000\nhttp_requests_total{code=\"500\"} +Inf",
+			format:  formatPrometheus,
+			columns: []string{"metric", "code", "path", "value", "timestamp"},
+			rows: []map[string]interface{}{
+				{"metric": "http_requests_total", "code": "200", "path": "/a,b", "value": 1027.0, "timestamp": time.UnixMilli(1700000000000).UTC()},
+				{"metric": "http_requests_total", "code": "500", "value": math.Inf(1)},
+			},
+		},
+		{
+			name:    "key value blocks",
+			text:    "Name: web-1\nStatus: Running\nRestarts: 2\n\nName: web-2\nStatus: Pending\nRestarts: 0",
+			format:  formatKeyValue,
+			columns: []string{"Name", "Status", "Restarts"},
+			rows: []map[string]interface{}{
+				{"Name": "web-1", "Status": "Running", "Restarts": 2.0},
+				{"Name": "web-2", "Status": "Pending", "Restarts": 0.0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := parseText(tt.text)
+			require.NotNil(t, parsed)
+			assert.Equal(t, tt.format, parsed.format)
+			assert.Equal(t, tt.columns, parsed.columns)
+			assert.Equal(t, tt.rows, parsed.rows)
+		})
+	}
+}
+
+func TestParseTextRejectsUnstructuredText(t *testing.T) {
+	for _, text := range []string{
+		"The api service had 3 errors, mostly timeouts.",
+		"Found the following:\nerrors, mostly timeouts\nwarnings, mostly retries",
+		"2023-12-07T10:30:45Z {job=myapp,level=info} Started\n2023-12-07T10:30:46Z {job=myapp,level=error} Failed",
+		"cpu 5\nmemory 3",
+		"Note: see https://example.com",
+	} {
+		assert.Nil(t, parseText(text), text)
+	}
+}
+
+func TestLines(t *testing.T) {
+	result := Lines(Output{Tool: "status", Text: "api is up\n\n  db is down  \n"})
+	assert.Equal(t, []string{"line"}, result.Columns)
+	assert.Equal(t, []map[string]interface{}{{"line": "api is up"}, {"line": "db is down"}}, result.Data)
+	assert.Equal(t, "2 lines from status", result.Summary)
+	assert.Equal(t, formatLines, result.Metadata["format"])
+}
+
+func TestStructuringSpec(t *testing.T) {
+	text := "Top pods\nweb-1   Running   3   restarted after OOM\nweb-2   Pending   0   waiting for node"
+
+	spec := &Spec{Delimiter: "whitespace", Columns: []string{"pod", "status", "restarts", "reason"}, SkipLines: 1}
+	parsed, err := spec.apply(text)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pod", "status", "restarts", "reason"}, parsed.columns)
+	assert.Equal(t, []map[string]interface{}{
+		{"pod": "web-1", "status": "Running", "restarts": 3.0, "reason": "restarted after OOM"},
+		{"pod": "web-2", "status": "Pending", "restarts": 0.0, "reason": "waiting for node"},
+	}, parsed.rows)
+
+	spec = &Spec{Pattern: `^(?P<pod>\S+)\s+(?P<status>Running)`}
+	parsed, err = spec.apply(text)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"pod": "web-1", "status": "Running"}}, parsed.rows)
+
+	_, err = (&Spec{Pattern: `^(?P<pod>nothing)$`}).apply(text)
+	assert.ErrorContains(t, err, "matched no rows")
+	_, err = (&Spec{Pattern: `(`}).apply(text)
+	assert.ErrorContains(t, err, "invalid pattern")
+	_, err = (&Spec{}).apply(text)
+	assert.Error(t, err)
+}
+
+func TestColumnsKeepSourceOrder(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		result := jsonResult("tool", `[{"zeta": 1, "alpha": {"nested": [{"b": 1}]}, "mid": 2}, {"extra": 3, "alpha": 2}]`)
+		require.NotNil(t, result)
+		assert.Equal(t, []string{"zeta", "alpha", "mid", "extra"}, result.Columns)
+
+		result = jsonResult("tool", `{"b": 1, "a": [1, 2], "c": null}`)
+		require.NotNil(t, result)
+		assert.Equal(t, []string{"b", "a", "c"}, result.Columns)
+
+		result = logResult("tool", "{\"ts\": 1, \"level\": \"info\", \"msg\": \"a\"}\n{\"ts\": 2, \"msg\": \"b\", \"trace\": \"x\"}")
+		require.NotNil(t, result)
+		assert.Equal(t, []string{"ts", "level", "msg", "trace"}, result.Columns)
+
+		parsed := parseText("{\"z\": 1, \"y\": 2}\n{\"x\": 3}")
+		require.NotNil(t, parsed)
+		assert.Equal(t, []string{"z", "y", "x"}, parsed.columns)
+	}
+}
+
+func TestStructureTablePerTool(t *testing.T) {
+	result := Structure([]Output{
+		{Tool: "errors", Text: "service,count\napi,3"},
+		{Tool: "hosts", Text: `[{"host": "a", "up": true}]`},
+		{Tool: "hosts", Text: `{"resultType": "scalar", "result": [1700000000, "1"]}`},
+	})
+	require.NotNil(t, result)
+	assert.Equal(t, []map[string]interface{}{{"service": "api", "count": 3.0}}, result.Data)
+	assert.Equal(t, formatCSV, result.Metadata["format"])
+	require.Len(t, result.Tables, 1)
+	assert.Equal(t, "hosts", result.Tables[0].Name)
+	assert.Equal(t, []string{"host", "up"}, result.Tables[0].Columns)
+	require.Len(t, result.Frames, 1)
+	assert.Equal(t, "scalar", result.Frames[0].Name)
+
+	assert.Nil(t, Structure([]Output{{Tool: "errors", Text: "service,count\napi,3"}, {Tool: "status", Text: "api is up"}}))
+	assert.Nil(t, Structure(nil))
+}
+
+func TestJSONObjectWithSeveralArraysGivesTables(t *testing.T) {
+	result := jsonResult("tool", `{"total": 2, "services": [{"name": "api", "p99": 1.5}], "hosts": [{"host": "a"}, {"host": "b"}], "tags": ["x"]}`)
+	require.NotNil(t, result)
+	assert.Empty(t, result.Data)
+	require.Len(t, result.Tables, 2)
+	assert.Equal(t, "services", result.Tables[0].Name)
+	assert.Equal(t, []string{"name", "p99"}, result.Tables[0].Columns)
+	assert.Equal(t, "hosts", result.Tables[1].Name)
+	assert.Len(t, result.Tables[1].Data, 2)
+}
@@ -0,0 +1,211 @@
+package structuring
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// boxVerticals are the box-drawing characters separating the cells of a row
+var boxVerticals = strings.NewReplacer("│", "|", "┃", "|", "║", "|")
+
+// ruleRunes are the characters a border or header separator line may consist of,
+// besides its dashes
+const ruleRunes = "|+: ┌┐└┘├┤┬┴┼╭╮╰╯╔╗╚╝╠╣╦╩╬┏┓┗┛┣┫┳┻╋╞╡╪"
+
+// parsePipeTable finds the first table with cells separated by pipes in text,
+// which may be surrounded by prose: markdown tables, psql and MySQL output and
+// box-drawing tables. A table starts with a header row followed by a separator
+// line, and ends at the first line that is neither a row nor a separator, such
+// as a blank line or the "(3 rows)" footer of psql.
+func parsePipeTable(text string) (*table, bool) {
+	lines := strings.Split(text, "\n")
+	for i := 0; i+1 < len(lines); i++ {
+		header := boxVerticals.Replace(strings.TrimSpace(lines[i]))
+		if !isTableRow(header) || !isRuleLine(strings.TrimSpace(lines[i+1])) {
+			continue
+		}
+		cells := markdownCells(header)
+		if len(cells) < 2 && !strings.HasPrefix(header, "|") {
+			continue
+		}
+
+		columns := newColumnSet()
+		names := make([]string, len(cells))
+		for j, name := range cells {
+			if name == "" {
+				name = fmt.Sprintf("column%d", j+1)
+			}
+			names[j] = columns.addUnique(name)
+		}
+
+		format := formatMarkdown
+		if i > 0 && isRuleLine(strings.TrimSpace(lines[i-1])) || lines[i] != boxVerticals.Replace(lines[i]) {
+			// Bordered tables are not markdown
+			format = formatASCIITable
+		}
+		var rows []map[string]interface{}
+		for _, line := range lines[i+1:] {
+			line = strings.TrimSpace(line)
+			if isRuleLine(line) {
+				if strings.ContainsAny(line, "+┼├┤┌└┬┴╪╬") {
+					format = formatASCIITable
+				}
+				continue
+			}
+			line = boxVerticals.Replace(line)
+			if !isTableRow(line) {
+				break
+			}
+			row := make(map[string]interface{}, len(names))
+			for j, cell := range markdownCells(line) {
+				if j < len(names) {
+					row[names[j]] = cell
+				}
+			}
+			rows = append(rows, row)
+		}
+
+		typeColumns(rows, columns.names)
+		return &table{format: format, columns: columns.names, rows: rows}, true
+	}
+	return nil, false
+}
+
+// isTableRow reports whether a line, with box verticals replaced, is a row of a
+// pipe table
+func isTableRow(line string) bool {
+	return strings.Contains(line, "|") && !isRuleLine(line)
+}
+
+// isRuleLine reports whether a line is a border or the separator below a header,
+// e.g. "|---|:--:|", "+----+-----+", "------+-----" or "├──────┼─────┤"
+func isRuleLine(line string) bool {
+	dashes := 0
+	for _, r := range line {
+		switch {
+		case r == '-' || r == '=' || r == '─' || r == '━' || r == '═':
+			dashes++
+		case !strings.ContainsRune(ruleRunes, r):
+			return false
+		}
+	}
+	return dashes >= 3
+}
+
+// markdownCells splits a table row into its trimmed cells, with the outer pipes
+// optional and "\|" as an escaped pipe
+func markdownCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// fixedWidthHeading matches a column heading of fixed-width output: upper case
+// words, e.g. "NAME", "RESTARTS" or "CONTAINER ID"
+var fixedWidthHeading = regexp.MustCompile(`^[A-Z0-9_()%/.:#-]*[A-Z][A-Z0-9_()%/.:#-]*( [A-Z0-9_()%/.:#-]+)*$`)
+
+// parseFixedWidth finds the first column-aligned table in text, such as the
+// output of kubectl get or docker ps: a header of upper case headings separated by
+// at least two spaces, with each column starting where its heading starts. The
+// table ends at a blank line or a line whose cells do not line up.
+func parseFixedWidth(text string) (*table, bool) {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		starts, headings := fixedWidthColumns(line)
+		if len(starts) < 2 {
+			continue
+		}
+
+		var rows []map[string]interface{}
+		for _, line := range lines[i+1:] {
+			cells, ok := fixedWidthCells(line, starts)
+			if !ok {
+				break
+			}
+			row := make(map[string]interface{}, len(cells))
+			for j, cell := range cells {
+				if cell == "<none>" {
+					// kubectl shows empty values as <none>
+					cell = ""
+				}
+				row[headings[j]] = cell
+			}
+			rows = append(rows, row)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		typeColumns(rows, headings)
+		return &table{columns: headings, rows: rows}, true
+	}
+	return nil, false
+}
+
+// headingSpans matches the headings of a fixed-width header, which are separated
+// by at least two spaces
+var headingSpans = regexp.MustCompile(`\S+( \S+)*`)
+
+// fixedWidthColumns returns the start offsets and the names of the columns of a
+// fixed-width header line, or nil if the line is no such header
+func fixedWidthColumns(line string) ([]int, []string) {
+	line = strings.TrimRight(line, " \t\r")
+	if strings.Contains(line, "\t") {
+		return nil, nil
+	}
+	columns := newColumnSet()
+	var starts []int
+	for _, span := range headingSpans.FindAllStringIndex(line, -1) {
+		// Headings are ASCII, so their byte offsets are rune offsets
+		heading := line[span[0]:span[1]]
+		if !fixedWidthHeading.MatchString(heading) || columns.has(heading) {
+			return nil, nil
+		}
+		starts = append(starts, span[0])
+		columns.add(heading)
+	}
+	return starts, columns.names
+}
+
+// fixedWidthCells cuts a line into the cells of the columns starting at starts.
+// Every cell has to start at its column: the rune before a column start must be
+// a space, and nothing may precede the first column.
+func fixedWidthCells(line string, starts []int) ([]string, bool) {
+	runes := []rune(strings.TrimRight(line, " \t\r"))
+	if len(runes) <= starts[0] || strings.TrimSpace(string(runes[:starts[0]])) != "" || runes[starts[0]] == ' ' {
+		return nil, false
+	}
+	cells := make([]string, len(starts))
+	for j, start := range starts {
+		if start >= len(runes) {
+			break
+		}
+		if j > 0 && runes[start-1] != ' ' {
+			return nil, false
+		}
+		end := len(runes)
+		if j+1 < len(starts) && starts[j+1] < end {
+			end = starts[j+1]
+		}
+		cells[j] = strings.TrimSpace(string(runes[start:end]))
+	}
+	return cells, true
+}
@@ -0,0 +1,128 @@
+package structuring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTextTables(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		format  string
+		columns []string
+		rows    []map[string]interface{}
+	}{
+		{
+			name: "markdown between prose",
+			text: "Here are the slowest endpoints:\n\n" +
+				"| Endpoint | P99 | Errors |\n" +
+				"|---|---:|---|\n" +
+				"| /api | 1.5 | 3 |\n" +
+				"| /login | 0.2 | |\n\n" +
+				"The /api endpoint is the slowest, see | for details.",
+			format:  formatMarkdown,
+			columns: []string{"Endpoint", "P99", "Errors"},
+			rows: []map[string]interface{}{
+				{"Endpoint": "/api", "P99": 1.5, "Errors": 3.0},
+				{"Endpoint": "/login", "P99": 0.2, "Errors": nil},
+			},
+		},
+		{
+			name:    "markdown without outer pipes and repeated headings",
+			text:    "host | value | value\n--- | --- | ---\na | 1 | 2",
+			format:  formatMarkdown,
+			columns: []string{"host", "value", "value_2"},
+			rows:    []map[string]interface{}{{"host": "a", "value": 1.0, "value_2": 2.0}},
+		},
+		{
+			name: "psql",
+			text: " id | name  | active\n" +
+				"----+-------+--------\n" +
+				"  1 | alice | true\n" +
+				"  2 | bob   | false\n" +
+				"(2 rows)",
+			format:  formatASCIITable,
+			columns: []string{"id", "name", "active"},
+			rows: []map[string]interface{}{
+				{"id": 1.0, "name": "alice", "active": true},
+				{"id": 2.0, "name": "bob", "active": false},
+			},
+		},
+		{
+			name: "mysql grid",
+			text: "mysql> select id, name from users;\n" +
+				"+----+-------+\n" +
+				"| id | name  |\n" +
+				"+----+-------+\n" +
+				"|  1 | alice |\n" +
+				"|  2 | bob   |\n" +
+				"+----+-------+\n" +
+				"2 rows in set (0.00 sec)",
+			format:  formatASCIITable,
+			columns: []string{"id", "name"},
+			rows:    []map[string]interface{}{{"id": 1.0, "name": "alice"}, {"id": 2.0, "name": "bob"}},
+		},
+		{
+			name: "box drawing",
+			text: "┌──────┬───────┐\n" +
+				"│ name │ usage │\n" +
+				"├──────┼───────┤\n" +
+				"│ api  │ 93.5  │\n" +
+				"│ café │ 1     │\n" +
+				"└──────┴───────┘",
+			format:  formatASCIITable,
+			columns: []string{"name", "usage"},
+			rows:    []map[string]interface{}{{"name": "api", "usage": 93.5}, {"name": "café", "usage": 1.0}},
+		},
+		{
+			name: "kubectl",
+			text: "NAME                   READY   STATUS    RESTARTS   AGE\n" +
+				"web-7d4b9c8f5d-abcde   1/1     Running   0          5d\n" +
+				"web-7d4b9c8f5d-fghij   0/1     Pending   <none>     1m\n",
+			format:  formatFixedWidth,
+			columns: []string{"NAME", "READY", "STATUS", "RESTARTS", "AGE"},
+			rows: []map[string]interface{}{
+				{"NAME": "web-7d4b9c8f5d-abcde", "READY": "1/1", "STATUS": "Running", "RESTARTS": 0.0, "AGE": "5d"},
+				{"NAME": "web-7d4b9c8f5d-fghij", "READY": "0/1", "STATUS": "Pending", "RESTARTS": nil, "AGE": "1m"},
+			},
+		},
+		{
+			name: "docker ps after prose",
+			text: "Running containers:\n" +
+				"CONTAINER ID   IMAGE        STATUS\n" +
+				"4f2a9c1b0e3d   nginx:1.25   Up 2 hours\n" +
+				"9b8c7d6e5f4a   redis:7      Up 5 minutes\n" +
+				"\n" +
+				"Two containers are running.",
+			format:  formatFixedWidth,
+			columns: []string{"CONTAINER ID", "IMAGE", "STATUS"},
+			rows: []map[string]interface{}{
+				{"CONTAINER ID": "4f2a9c1b0e3d", "IMAGE": "nginx:1.25", "STATUS": "Up 2 hours"},
+				{"CONTAINER ID": "9b8c7d6e5f4a", "IMAGE": "redis:7", "STATUS": "Up 5 minutes"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := parseText(tt.text)
+			require.NotNil(t, parsed)
+			assert.Equal(t, tt.format, parsed.format)
+			assert.Equal(t, tt.columns, parsed.columns)
+			assert.Equal(t, tt.rows, parsed.rows)
+		})
+	}
+}
+
+func TestParseTextRejectsTableLookalikes(t *testing.T) {
+	for _, text := range []string{
+		"Title\n-----\nSome text below a heading",
+		"IMPORTANT  NOTE\nThis is some text that does not line up",
+		"Use a | b to pipe\n\nand more text",
+	} {
+		assert.Nil(t, parseText(text), text)
+	}
+}
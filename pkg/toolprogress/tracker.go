@@ -0,0 +1,216 @@
+package toolprogress
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Kinds of updates received during a tool call
+const (
+	KindProgress = "progress"
+	KindLog      = "log"
+)
+
+// Notification methods of the MCP protocol handled by the tracker
+const (
+	methodProgress   = "notifications/progress"
+	methodLogMessage = "notifications/message"
+)
+
+// maxUpdates is the number of updates kept per call; older ones are dropped, but
+// still passed to the update function
+const maxUpdates = 100
+
+// Update is a progress notification or a log message an MCP server sent while a
+// tool call was running
+type Update struct {
+	Kind     string    `json:"kind"`
+	Time     time.Time `json:"time"`
+	Progress float64   `json:"progress,omitempty"`
+	Total    float64   `json:"total,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	Level    string    `json:"level,omitempty"`
+	Logger   string    `json:"logger,omitempty"`
+}
+
+// Tracker routes the notifications of an MCP client to the tool calls in flight.
+// Progress notifications are matched by their progress token. Log messages are
+// not tied to a request, and the client is shared by the queries of every user,
+// so they are only passed to a call when it is the only one running.
+type Tracker struct {
+	prefix string
+	next   atomic.Int64
+
+	mu    sync.Mutex
+	calls map[string]*Call
+}
+
+// NewTracker returns a tracker whose progress tokens start with prefix
+func NewTracker(prefix string) *Tracker {
+	return &Tracker{prefix: prefix, calls: make(map[string]*Call)}
+}
+
+// Handle processes a notification of the MCP client. It is registered with
+// client.OnNotification.
+func (t *Tracker) Handle(notification mcp.JSONRPCNotification) {
+	fields := notification.Params.AdditionalFields
+	switch notification.Method {
+	case methodProgress:
+		token := tokenString(fields["progressToken"])
+		t.mu.Lock()
+		call := t.calls[token]
+		t.mu.Unlock()
+		if call == nil {
+			return
+		}
+		update := Update{Kind: KindProgress, Time: time.Now()}
+		update.Progress, _ = fields["progress"].(float64)
+		update.Total, _ = fields["total"].(float64)
+		update.Message, _ = fields["message"].(string)
+		call.add(update)
+	case methodLogMessage:
+		update := Update{Kind: KindLog, Time: time.Now(), Message: logText(fields["data"])}
+		update.Level, _ = fields["level"].(string)
+		update.Logger, _ = fields["logger"].(string)
+		var call *Call
+		t.mu.Lock()
+		if len(t.calls) == 1 {
+			for _, running := range t.calls {
+				call = running
+			}
+		}
+		t.mu.Unlock()
+		if call == nil {
+			// The message could belong to any of the running calls
+			return
+		}
+		call.add(update)
+	}
+}
+
+// Start registers a tool call. onUpdate, which may be nil, is called with every
+// update as it arrives. Call Done once the tool call returned.
+// Start is safe to call on a nil tracker; the returned call then receives nothing.
+func (t *Tracker) Start(onUpdate func(Update)) *Call {
+	if t == nil {
+		return nil
+	}
+	call := &Call{
+		tracker:  t,
+		token:    t.prefix + strconv.FormatInt(t.next.Add(1), 10),
+		onUpdate: onUpdate,
+	}
+	t.mu.Lock()
+	t.calls[call.token] = call
+	t.mu.Unlock()
+	return call
+}
+
+// Call collects the updates of one tool call
+type Call struct {
+	tracker  *Tracker
+	token    string
+	onUpdate func(Update)
+
+	mu      sync.Mutex
+	updates []Update
+}
+
+// Meta returns the request metadata carrying the progress token of the call
+func (c *Call) Meta() *mcp.Meta {
+	if c == nil {
+		return nil
+	}
+	return &mcp.Meta{ProgressToken: c.token}
+}
+
+// Done stops routing notifications to the call
+func (c *Call) Done() {
+	if c == nil {
+		return
+	}
+	c.tracker.mu.Lock()
+	delete(c.tracker.calls, c.token)
+	c.tracker.mu.Unlock()
+}
+
+// Updates returns the updates received so far
+func (c *Call) Updates() []Update {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Update(nil), c.updates...)
+}
+
+func (c *Call) add(update Update) {
+	c.mu.Lock()
+	if len(c.updates) == maxUpdates {
+		c.updates = c.updates[1:]
+	}
+	c.updates = append(c.updates, update)
+	c.mu.Unlock()
+
+	if c.onUpdate != nil {
+		c.onUpdate(update)
+	}
+}
+
+// String describes the update for display, e.g. "42% Scanning chunks" or "[warning] slow query"
+func (u Update) String() string {
+	switch u.Kind {
+	case KindProgress:
+		var amount string
+		switch {
+		case u.Total > 0:
+			amount = fmt.Sprintf("%.0f%%", 100*u.Progress/u.Total)
+		case u.Progress > 0:
+			amount = strconv.FormatFloat(u.Progress, 'f', -1, 64)
+		}
+		if amount != "" && u.Message != "" {
+			return amount + " " + u.Message
+		}
+		return amount + u.Message
+	default:
+		text := u.Message
+		if u.Logger != "" {
+			text = u.Logger + ": " + text
+		}
+		if u.Level != "" {
+			text = "[" + u.Level + "] " + text
+		}
+		return text
+	}
+}
+
+// tokenString returns the progress token as the string it was sent as. Servers
+// echo the token back, but numbers may come back as float64 after decoding.
+func tokenString(token any) string {
+	switch v := token.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// logText returns the data of a log message as text; structured data is encoded as JSON
+func logText(data any) string {
+	if text, ok := data.(string); ok {
+		return text
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Sprint(data)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,65 @@
+package toolprogress
+
+import (
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func notification(method string, fields map[string]any) mcp.JSONRPCNotification {
+	return mcp.JSONRPCNotification{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		Notification: mcp.Notification{
+			Method: method,
+			Params: mcp.NotificationParams{AdditionalFields: fields},
+		},
+	}
+}
+
+func TestTrackerRoutesNotifications(t *testing.T) {
+	tracker := NewTracker("call-")
+	var received []Update
+	first := tracker.Start(func(update Update) { received = append(received, update) })
+
+	tracker.Handle(notification(methodProgress, map[string]any{"progressToken": first.Meta().ProgressToken, "progress": 2.0, "total": 8.0, "message": "Scanning"}))
+	tracker.Handle(notification(methodProgress, map[string]any{"progressToken": "unknown", "progress": 1.0}))
+	tracker.Handle(notification(methodLogMessage, map[string]any{"level": "error", "logger": "loki", "data": map[string]any{"status": 503}}))
+
+	require.Len(t, received, 2)
+	assert.Equal(t, "25% Scanning", received[0].String())
+	assert.Equal(t, `[error] loki: {"status":503}`, received[1].String())
+	assert.Equal(t, received, first.Updates())
+
+	second := tracker.Start(nil)
+	require.NotEqual(t, first.Meta().ProgressToken, second.Meta().ProgressToken)
+	tracker.Handle(notification(methodLogMessage, map[string]any{"level": "info", "data": "whose call?"}))
+	assert.Len(t, first.Updates(), 2, "log messages are dropped while several calls run")
+	assert.Empty(t, second.Updates())
+
+	first.Done()
+	tracker.Handle(notification(methodLogMessage, map[string]any{"level": "info", "data": "finished"}))
+	assert.Len(t, first.Updates(), 2, "no updates after the call is done")
+	require.Len(t, second.Updates(), 1, "log messages go to the only running call")
+	assert.Equal(t, "finished", second.Updates()[0].Message)
+}
+
+func TestTrackerKeepsRecentUpdates(t *testing.T) {
+	tracker := NewTracker("")
+	call := tracker.Start(nil)
+	for i := 0; i < maxUpdates+10; i++ {
+		tracker.Handle(notification(methodProgress, map[string]any{"progressToken": 1.0, "progress": float64(i)}))
+	}
+	updates := call.Updates()
+	require.Len(t, updates, maxUpdates)
+	assert.Equal(t, float64(10), updates[0].Progress)
+}
+
+func TestNilTracker(t *testing.T) {
+	var tracker *Tracker
+	call := tracker.Start(nil)
+	assert.Nil(t, call.Meta())
+	assert.Nil(t, call.Updates())
+	call.Done()
+}
@@ -0,0 +1,197 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"grafana-mcpclient-datasource/pkg/conv"
+)
+
+// expression is a parsed arithmetic expression of a derive step
+type expression interface {
+	// eval computes the expression for a row; it returns false if a column is
+	// not a number or a division is by zero
+	eval(row map[string]interface{}) (float64, bool)
+	// columns returns the columns the expression reads
+	columns() []string
+}
+
+type number float64
+
+func (n number) eval(map[string]interface{}) (float64, bool) { return float64(n), true }
+func (n number) columns() []string                           { return nil }
+
+type column string
+
+func (c column) eval(row map[string]interface{}) (float64, bool) { return conv.ToFloat(row[string(c)]) }
+func (c column) columns() []string                               { return []string{string(c)} }
+
+type negation struct{ operand expression }
+
+func (n negation) eval(row map[string]interface{}) (float64, bool) {
+	value, ok := n.operand.eval(row)
+	return -value, ok
+}
+func (n negation) columns() []string { return n.operand.columns() }
+
+type binary struct {
+	op          rune
+	left, right expression
+}
+
+func (b binary) eval(row map[string]interface{}) (float64, bool) {
+	left, ok := b.left.eval(row)
+	if !ok {
+		return 0, false
+	}
+	right, ok := b.right.eval(row)
+	if !ok {
+		return 0, false
+	}
+	switch b.op {
+	case '+':
+		return left + right, true
+	case '-':
+		return left - right, true
+	case '*':
+		return left * right, true
+	case '/':
+		return left / right, right != 0
+	default:
+		return math.Mod(left, right), right != 0
+	}
+}
+func (b binary) columns() []string { return append(b.left.columns(), b.right.columns()...) }
+
+// parseExpression parses an arithmetic expression: numbers, columns, + - * / %,
+// unary minus and parentheses. Columns are identifiers such as latency_ms or
+// http.status, or any name in backquotes.
+func parseExpression(source string) (expression, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("expression is required")
+	}
+	p := &expressionParser{source: []rune(source)}
+	expr, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.source) {
+		return nil, fmt.Errorf("unexpected %q at %d in expression", p.source[p.pos], p.pos+1)
+	}
+	return expr, nil
+}
+
+// expressionParser is a recursive descent parser of expressions
+type expressionParser struct {
+	source []rune
+	pos    int
+}
+
+func (p *expressionParser) skipSpace() {
+	for p.pos < len(p.source) && unicode.IsSpace(p.source[p.pos]) {
+		p.pos++
+	}
+}
+
+// next returns the next character that is not a space, or 0 at the end
+func (p *expressionParser) next() rune {
+	p.skipSpace()
+	if p.pos >= len(p.source) {
+		return 0
+	}
+	return p.source[p.pos]
+}
+
+// sum parses terms joined by + and -
+func (p *expressionParser) sum() (expression, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.next(); op == '+' || op == '-'; op = p.next() {
+		p.pos++
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// product parses factors joined by *, / and %
+func (p *expressionParser) product() (expression, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.next(); op == '*' || op == '/' || op == '%'; op = p.next() {
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// factor parses a number, a column, a negation or an expression in parentheses
+func (p *expressionParser) factor() (expression, error) {
+	switch c := p.next(); {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case c == '-':
+		p.pos++
+		operand, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return negation{operand: operand}, nil
+	case c == '(':
+		p.pos++
+		expr, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ')' {
+			return nil, fmt.Errorf("missing ) in expression")
+		}
+		p.pos++
+		return expr, nil
+	case c == '`':
+		start := p.pos + 1
+		end := start
+		for end < len(p.source) && p.source[end] != '`' {
+			end++
+		}
+		if end >= len(p.source) {
+			return nil, fmt.Errorf("missing ` in expression")
+		}
+		p.pos = end + 1
+		return column(p.source[start:end]), nil
+	case unicode.IsDigit(c) || c == '.':
+		start := p.pos
+		for p.pos < len(p.source) && (unicode.IsDigit(p.source[p.pos]) || strings.ContainsRune(".eE", p.source[p.pos]) ||
+			(strings.ContainsRune("+-", p.source[p.pos]) && strings.ContainsRune("eE", p.source[p.pos-1]))) {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(string(p.source[start:p.pos]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in expression", string(p.source[start:p.pos]))
+		}
+		return number(value), nil
+	case c == '_' || unicode.IsLetter(c):
+		start := p.pos
+		for p.pos < len(p.source) && (p.source[p.pos] == '_' || p.source[p.pos] == '.' ||
+			unicode.IsLetter(p.source[p.pos]) || unicode.IsDigit(p.source[p.pos])) {
+			p.pos++
+		}
+		return column(p.source[start:p.pos]), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q at %d in expression", c, p.pos+1)
+	}
+}
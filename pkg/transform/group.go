@@ -0,0 +1,147 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"grafana-mcpclient-datasource/pkg/conv"
+)
+
+// compileGroupBy compiles a group_by step
+func (s Step) compileGroupBy(columns []string) (operation, []string, error) {
+	if len(s.By) == 0 {
+		return nil, nil, fmt.Errorf("by is required")
+	}
+	if err := requireColumns(columns, s.By...); err != nil {
+		return nil, nil, err
+	}
+
+	output := append([]string(nil), s.By...)
+	names := make(map[string]bool, len(output)+len(s.Aggregates))
+	for _, column := range output {
+		names[column] = true
+	}
+	aggregates := make([]Aggregate, len(s.Aggregates))
+	for i, aggregate := range s.Aggregates {
+		switch aggregate.Op {
+		case AggregateCount:
+			if aggregate.Column != "" {
+				if err := requireColumns(columns, aggregate.Column); err != nil {
+					return nil, nil, err
+				}
+			}
+		case AggregateSum, AggregateAvg, AggregateMin, AggregateMax, AggregateFirst, AggregateLast:
+			if err := requireColumns(columns, aggregate.Column); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", aggregate.Op, err)
+			}
+		default:
+			return nil, nil, fmt.Errorf("unknown aggregate %q", aggregate.Op)
+		}
+
+		if aggregate.As == "" {
+			aggregate.As = aggregate.Op
+			if aggregate.Column != "" {
+				aggregate.As += "_" + aggregate.Column
+			}
+		}
+		if names[aggregate.As] {
+			return nil, nil, fmt.Errorf("column %s would appear twice", aggregate.As)
+		}
+		names[aggregate.As] = true
+		aggregates[i] = aggregate
+		output = append(output, aggregate.As)
+	}
+
+	return func(t Table) Table {
+		// Groups keep the order in which their first row appears
+		var keys []string
+		groups := make(map[string][]map[string]interface{})
+		for _, row := range t.Rows {
+			parts := make([]string, len(s.By))
+			for i, column := range s.By {
+				parts[i] = fmt.Sprint(row[column])
+			}
+			key := strings.Join(parts, "\x1f")
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], row)
+		}
+
+		rows := make([]map[string]interface{}, len(keys))
+		for i, key := range keys {
+			group := groups[key]
+			row := make(map[string]interface{}, len(output))
+			for _, column := range s.By {
+				row[column] = group[0][column]
+			}
+			for _, aggregate := range aggregates {
+				row[aggregate.As] = aggregate.apply(group)
+			}
+			rows[i] = row
+		}
+		return Table{Columns: output, Rows: rows}
+	}, output, nil
+}
+
+// apply computes the aggregate of the rows of a group. Sums, averages, minimums
+// and maximums are of the values that are numbers; without any they are empty.
+func (a Aggregate) apply(rows []map[string]interface{}) interface{} {
+	switch a.Op {
+	case AggregateCount:
+		if a.Column == "" {
+			return float64(len(rows))
+		}
+		count := 0
+		for _, row := range rows {
+			if row[a.Column] != nil {
+				count++
+			}
+		}
+		return float64(count)
+	case AggregateFirst:
+		for _, row := range rows {
+			if row[a.Column] != nil {
+				return row[a.Column]
+			}
+		}
+		return nil
+	case AggregateLast:
+		for i := len(rows) - 1; i >= 0; i-- {
+			if rows[i][a.Column] != nil {
+				return rows[i][a.Column]
+			}
+		}
+		return nil
+	}
+
+	var numbers []float64
+	for _, row := range rows {
+		if number, ok := conv.ToFloat(row[a.Column]); ok {
+			numbers = append(numbers, number)
+		}
+	}
+	if len(numbers) == 0 {
+		return nil
+	}
+	result := numbers[0]
+	switch a.Op {
+	case AggregateSum, AggregateAvg:
+		for _, number := range numbers[1:] {
+			result += number
+		}
+		if a.Op == AggregateAvg {
+			result /= float64(len(numbers))
+		}
+	case AggregateMin:
+		for _, number := range numbers[1:] {
+			result = math.Min(result, number)
+		}
+	case AggregateMax:
+		for _, number := range numbers[1:] {
+			result = math.Max(result, number)
+		}
+	}
+	return result
+}
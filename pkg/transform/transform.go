@@ -0,0 +1,414 @@
+// Package transform runs pipelines of table transformations over the rows of
+// structured tool results: filter, select, rename, group by, sort, limit, time
+// buckets and derived fields. Pipelines are plain data, so a query can store one
+// and an LLM can write one; either way the pipeline is validated against the
+// columns of the table and run locally.
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"grafana-mcpclient-datasource/pkg/conv"
+)
+
+// Step types
+const (
+	TypeFilter     = "filter"
+	TypeSelect     = "select"
+	TypeRename     = "rename"
+	TypeGroupBy    = "group_by"
+	TypeSort       = "sort"
+	TypeLimit      = "limit"
+	TypeTimeBucket = "time_bucket"
+	TypeDerive     = "derive"
+)
+
+// Aggregate operations of group_by steps
+const (
+	AggregateCount = "count"
+	AggregateSum   = "sum"
+	AggregateAvg   = "avg"
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+	AggregateFirst = "first"
+	AggregateLast  = "last"
+)
+
+// Table is the rows of a result and the order of their columns
+type Table struct {
+	Columns []string
+	Rows    []map[string]interface{}
+}
+
+// Pipeline is a list of steps run one after the other
+type Pipeline []Step
+
+// Step is a step of a pipeline. Type selects the operation and the other fields
+// are its parameters:
+//
+//   - filter keeps the rows whose Column compares to Value with Op: =, !=, >,
+//     >=, <, <=, contains, =~ or !~ (regular expressions)
+//   - select keeps Columns, in their order
+//   - rename renames the columns of Names, old name to new name
+//   - group_by gives a row per distinct value of the By columns, with the
+//     Aggregates of the rows of each
+//   - sort sorts the rows by the By columns, in descending order with Desc
+//   - limit keeps the first Count rows
+//   - time_bucket rounds the times of Column down to a multiple of Interval,
+//     e.g. 5m or 1d, into As or Column itself
+//   - derive computes As from an arithmetic Expression of columns and numbers,
+//     e.g. "bytes / 1024"; names that are not identifiers go in backquotes
+type Step struct {
+	Type       string            `json:"type"`
+	Column     string            `json:"column,omitempty"`
+	Op         string            `json:"op,omitempty"`
+	Value      interface{}       `json:"value,omitempty"`
+	Columns    []string          `json:"columns,omitempty"`
+	Names      map[string]string `json:"names,omitempty"`
+	By         []string          `json:"by,omitempty"`
+	Aggregates []Aggregate       `json:"aggregates,omitempty"`
+	Desc       bool              `json:"desc,omitempty"`
+	Count      int               `json:"count,omitempty"`
+	Interval   string            `json:"interval,omitempty"`
+	Expression string            `json:"expression,omitempty"`
+	As         string            `json:"as,omitempty"`
+}
+
+// Aggregate is a column of a group_by step computed from the rows of a group.
+// Count counts the rows, or the values of Column if it is set; the other
+// operations need a Column. As names the column, by default e.g. avg_latency.
+type Aggregate struct {
+	Op     string `json:"op"`
+	Column string `json:"column,omitempty"`
+	As     string `json:"as,omitempty"`
+}
+
+// operation runs a validated step
+type operation func(Table) Table
+
+// Validate checks that the pipeline can run on a table with columns, following
+// the columns each step adds, removes and renames
+func (p Pipeline) Validate(columns []string) error {
+	_, err := p.compile(columns)
+	return err
+}
+
+// Apply runs the pipeline over table. The table is left as it is; the rows of
+// the result are new maps.
+func (p Pipeline) Apply(table Table) (Table, error) {
+	operations, err := p.compile(table.Columns)
+	if err != nil {
+		return table, err
+	}
+	for _, op := range operations {
+		table = op(table)
+	}
+	return table, nil
+}
+
+// compile validates the steps and returns the operations that run them
+func (p Pipeline) compile(columns []string) ([]operation, error) {
+	operations := make([]operation, 0, len(p))
+	for i, step := range p {
+		op, next, err := step.compile(columns)
+		if err != nil {
+			return nil, fmt.Errorf("step %d (%s): %w", i+1, step.Type, err)
+		}
+		operations = append(operations, op)
+		columns = next
+	}
+	return operations, nil
+}
+
+// compile validates a step against the columns of its input and returns its
+// operation and the columns of its output
+func (s Step) compile(columns []string) (operation, []string, error) {
+	switch s.Type {
+	case TypeFilter:
+		return s.compileFilter(columns)
+	case TypeSelect:
+		if len(s.Columns) == 0 {
+			return nil, nil, fmt.Errorf("columns is required")
+		}
+		if err := requireColumns(columns, s.Columns...); err != nil {
+			return nil, nil, err
+		}
+		selected := append([]string(nil), s.Columns...)
+		return func(t Table) Table {
+			rows := make([]map[string]interface{}, len(t.Rows))
+			for i, row := range t.Rows {
+				rows[i] = make(map[string]interface{}, len(selected))
+				for _, column := range selected {
+					rows[i][column] = row[column]
+				}
+			}
+			return Table{Columns: selected, Rows: rows}
+		}, selected, nil
+	case TypeRename:
+		return s.compileRename(columns)
+	case TypeGroupBy:
+		return s.compileGroupBy(columns)
+	case TypeSort:
+		if len(s.By) == 0 {
+			return nil, nil, fmt.Errorf("by is required")
+		}
+		if err := requireColumns(columns, s.By...); err != nil {
+			return nil, nil, err
+		}
+		return func(t Table) Table {
+			rows := append([]map[string]interface{}(nil), t.Rows...)
+			sort.SliceStable(rows, func(i, j int) bool {
+				for _, column := range s.By {
+					if c := compareForSort(rows[i][column], rows[j][column], s.Desc); c != 0 {
+						return c < 0
+					}
+				}
+				return false
+			})
+			return Table{Columns: t.Columns, Rows: rows}
+		}, columns, nil
+	case TypeLimit:
+		if s.Count <= 0 {
+			return nil, nil, fmt.Errorf("count must be positive")
+		}
+		return func(t Table) Table {
+			if len(t.Rows) > s.Count {
+				t.Rows = t.Rows[:s.Count]
+			}
+			return t
+		}, columns, nil
+	case TypeTimeBucket:
+		return s.compileTimeBucket(columns)
+	case TypeDerive:
+		return s.compileDerive(columns)
+	case "":
+		return nil, nil, fmt.Errorf("type is required")
+	default:
+		return nil, nil, fmt.Errorf("unknown step type")
+	}
+}
+
+// compileFilter compiles a filter step
+func (s Step) compileFilter(columns []string) (operation, []string, error) {
+	if err := requireColumns(columns, s.Column); err != nil {
+		return nil, nil, err
+	}
+
+	var match func(value interface{}) bool
+	switch s.Op {
+	case "=", "==":
+		match = func(value interface{}) bool { return equal(value, s.Value) }
+	case "!=":
+		match = func(value interface{}) bool { return !equal(value, s.Value) }
+	case ">", ">=", "<", "<=":
+		match = func(value interface{}) bool {
+			c, ok := compare(value, s.Value)
+			if !ok {
+				return false
+			}
+			switch s.Op {
+			case ">":
+				return c > 0
+			case ">=":
+				return c >= 0
+			case "<":
+				return c < 0
+			default:
+				return c <= 0
+			}
+		}
+	case "contains":
+		match = func(value interface{}) bool {
+			return value != nil && strings.Contains(text(value), text(s.Value))
+		}
+	case "=~", "!~":
+		pattern, err := regexp.Compile(text(s.Value))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		negate := s.Op == "!~"
+		match = func(value interface{}) bool {
+			return (value != nil && pattern.MatchString(text(value))) != negate
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown operator %q", s.Op)
+	}
+
+	return func(t Table) Table {
+		var rows []map[string]interface{}
+		for _, row := range t.Rows {
+			if match(row[s.Column]) {
+				rows = append(rows, row)
+			}
+		}
+		return Table{Columns: t.Columns, Rows: rows}
+	}, columns, nil
+}
+
+// compileRename compiles a rename step
+func (s Step) compileRename(columns []string) (operation, []string, error) {
+	if len(s.Names) == 0 {
+		return nil, nil, fmt.Errorf("names is required")
+	}
+	renamed := make([]string, len(columns))
+	seen := make(map[string]bool, len(columns))
+	for i, column := range columns {
+		renamed[i] = column
+		if name, ok := s.Names[column]; ok {
+			if name == "" {
+				return nil, nil, fmt.Errorf("new name of %s is empty", column)
+			}
+			renamed[i] = name
+		}
+		if seen[renamed[i]] {
+			return nil, nil, fmt.Errorf("column %s would appear twice", renamed[i])
+		}
+		seen[renamed[i]] = true
+	}
+	for old := range s.Names {
+		if err := requireColumns(columns, old); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return func(t Table) Table {
+		rows := make([]map[string]interface{}, len(t.Rows))
+		for i, row := range t.Rows {
+			rows[i] = make(map[string]interface{}, len(row))
+			for key, value := range row {
+				if name, ok := s.Names[key]; ok {
+					key = name
+				}
+				rows[i][key] = value
+			}
+		}
+		return Table{Columns: renamed, Rows: rows}
+	}, renamed, nil
+}
+
+// compileTimeBucket compiles a time_bucket step
+func (s Step) compileTimeBucket(columns []string) (operation, []string, error) {
+	if err := requireColumns(columns, s.Column); err != nil {
+		return nil, nil, err
+	}
+	interval, err := parseInterval(s.Interval)
+	if err != nil {
+		return nil, nil, err
+	}
+	target := s.As
+	if target == "" {
+		target = s.Column
+	}
+	output := withColumn(columns, target)
+
+	return func(t Table) Table {
+		rows := make([]map[string]interface{}, len(t.Rows))
+		for i, row := range t.Rows {
+			rows[i] = copyRow(row)
+			if at, ok := conv.ToTime(row[s.Column]); ok {
+				rows[i][target] = at.UTC().Truncate(interval)
+			} else {
+				rows[i][target] = nil
+			}
+		}
+		return Table{Columns: output, Rows: rows}
+	}, output, nil
+}
+
+// compileDerive compiles a derive step
+func (s Step) compileDerive(columns []string) (operation, []string, error) {
+	if s.As == "" {
+		return nil, nil, fmt.Errorf("as is required")
+	}
+	expr, err := parseExpression(s.Expression)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := requireColumns(columns, expr.columns()...); err != nil {
+		return nil, nil, err
+	}
+	output := withColumn(columns, s.As)
+
+	return func(t Table) Table {
+		rows := make([]map[string]interface{}, len(t.Rows))
+		for i, row := range t.Rows {
+			rows[i] = copyRow(row)
+			if value, ok := expr.eval(row); ok {
+				rows[i][s.As] = value
+			} else {
+				rows[i][s.As] = nil
+			}
+		}
+		return Table{Columns: output, Rows: rows}
+	}, output, nil
+}
+
+// requireColumns returns an error naming the first of names that is not one of
+// columns
+func requireColumns(columns []string, names ...string) error {
+	for _, name := range names {
+		if name == "" {
+			return fmt.Errorf("column is required")
+		}
+		found := false
+		for _, column := range columns {
+			if column == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown column %q", name)
+		}
+	}
+	return nil
+}
+
+// withColumn returns columns with name appended if it is not one of them yet
+func withColumn(columns []string, name string) []string {
+	for _, column := range columns {
+		if column == name {
+			return columns
+		}
+	}
+	return append(append([]string(nil), columns...), name)
+}
+
+// copyRow returns a copy of row that can be changed without changing row
+func copyRow(row map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(row)+1)
+	for key, value := range row {
+		copied[key] = value
+	}
+	return copied
+}
+
+// parseInterval parses the interval of a time bucket: a Go duration such as 30s,
+// 5m or 1h30m, or a number of days or weeks such as 1d or 2w
+func parseInterval(interval string) (time.Duration, error) {
+	if interval == "" {
+		return 0, fmt.Errorf("interval is required")
+	}
+	var d time.Duration
+	var err error
+	switch unit := interval[len(interval)-1]; unit {
+	case 'd', 'w':
+		var n int
+		n, err = strconv.Atoi(interval[:len(interval)-1])
+		d = time.Duration(n) * 24 * time.Hour
+		if unit == 'w' {
+			d *= 7
+		}
+	default:
+		d, err = time.ParseDuration(interval)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid interval %q", interval)
+	}
+	return d, nil
+}
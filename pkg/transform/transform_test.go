@@ -0,0 +1,100 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requests() Table {
+	return Table{
+		Columns: []string{"time", "service", "status", "latency_ms"},
+		Rows: []map[string]interface{}{
+			{"time": "2024-05-01T10:01:00Z", "service": "api", "status": "200", "latency_ms": 120.0},
+			{"time": "2024-05-01T10:03:00Z", "service": "db", "status": "500", "latency_ms": 900.0},
+			{"time": "2024-05-01T10:06:00Z", "service": "api", "status": "503", "latency_ms": 300.0},
+			{"time": "2024-05-01T10:07:00Z", "service": "auth", "status": "200", "latency_ms": nil},
+		},
+	}
+}
+
+func parse(t *testing.T, steps string) Pipeline {
+	t.Helper()
+	var pipeline Pipeline
+	require.NoError(t, json.Unmarshal([]byte(steps), &pipeline))
+	return pipeline
+}
+
+func TestGroupSortLimit(t *testing.T) {
+	pipeline := parse(t, `[
+		{"type": "group_by", "by": ["service"], "aggregates": [{"op": "count", "as": "requests"}, {"op": "avg", "column": "latency_ms"}]},
+		{"type": "sort", "by": ["avg_latency_ms"], "desc": true},
+		{"type": "limit", "count": 2}
+	]`)
+	result, err := pipeline.Apply(requests())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"service", "requests", "avg_latency_ms"}, result.Columns)
+	assert.Equal(t, []map[string]interface{}{
+		{"service": "db", "requests": 1.0, "avg_latency_ms": 900.0},
+		{"service": "api", "requests": 2.0, "avg_latency_ms": 210.0},
+	}, result.Rows)
+}
+
+func TestFilterSelectRenameDerive(t *testing.T) {
+	pipeline := parse(t, `[
+		{"type": "filter", "column": "status", "op": ">=", "value": 500},
+		{"type": "derive", "as": "latency s", "expression": "latency_ms / 1000"},
+		{"type": "rename", "names": {"latency s": "seconds"}},
+		{"type": "filter", "column": "service", "op": "=~", "value": "^a"},
+		{"type": "select", "columns": ["service", "seconds"]}
+	]`)
+	result, err := pipeline.Apply(requests())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"service", "seconds"}, result.Columns)
+	assert.Equal(t, []map[string]interface{}{{"service": "api", "seconds": 0.3}}, result.Rows)
+}
+
+func TestTimeBucket(t *testing.T) {
+	pipeline := parse(t, `[
+		{"type": "time_bucket", "column": "time", "interval": "5m", "as": "bucket"},
+		{"type": "group_by", "by": ["bucket"], "aggregates": [{"op": "max", "column": "latency_ms", "as": "max"}]}
+	]`)
+	result, err := pipeline.Apply(requests())
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"bucket": time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), "max": 900.0},
+		{"bucket": time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC), "max": 300.0},
+	}, result.Rows)
+}
+
+func TestValidate(t *testing.T) {
+	columns := requests().Columns
+	for steps, message := range map[string]string{
+		`[{"type": "select", "columns": ["nope"]}]`:                                                           `step 1 (select): unknown column "nope"`,
+		`[{"type": "rename", "names": {"service": "svc"}}, {"type": "sort", "by": ["service"]}]`:              `step 2 (sort): unknown column "service"`,
+		`[{"type": "filter", "column": "status", "op": "like", "value": "5"}]`:                                `step 1 (filter): unknown operator "like"`,
+		`[{"type": "derive", "as": "x", "expression": "latency_ms * (2"}]`:                                    "step 1 (derive): missing ) in expression",
+		`[{"type": "time_bucket", "column": "time", "interval": "5 minutes"}]`:                                `step 1 (time_bucket): invalid interval "5 minutes"`,
+		`[{"type": "group_by", "by": ["service"], "aggregates": [{"op": "median", "column": "latency_ms"}]}]`: `step 1 (group_by): unknown aggregate "median"`,
+		`[{"type": "limit"}]`: "step 1 (limit): count must be positive",
+		`[{"type": "pivot"}]`: "step 1 (pivot): unknown step type",
+	} {
+		err := parse(t, steps).Validate(columns)
+		require.Error(t, err, steps)
+		assert.Equal(t, message, err.Error())
+	}
+
+	assert.NoError(t, parse(t, `[{"type": "derive", "as": "x", "expression": "-(latency_ms + 1) % 7 * 2.5e-1"}]`).Validate(columns))
+}
+
+func TestDeriveSkipsValuesThatAreNotNumbers(t *testing.T) {
+	result, err := parse(t, `[{"type": "derive", "as": "ratio", "expression": "latency_ms / (status - 200)"}]`).Apply(requests())
+	require.NoError(t, err)
+	assert.Nil(t, result.Rows[0]["ratio"], "division by zero")
+	assert.Equal(t, 3.0, result.Rows[1]["ratio"])
+	assert.Nil(t, result.Rows[3]["ratio"], "empty latency")
+	assert.NotContains(t, requests().Rows[0], "ratio")
+}
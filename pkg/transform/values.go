@@ -0,0 +1,95 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"grafana-mcpclient-datasource/pkg/conv"
+)
+
+// text returns a value as text
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// equal reports whether two values are the same number, or else the same text.
+// An empty value only equals an empty value.
+func equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	return text(a) == text(b)
+}
+
+// compare orders two values as numbers when both are numbers, as times when
+// both are times, and otherwise as text. It returns false if either is empty.
+func compare(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if x, ok := conv.ToFloat(a); ok {
+		if y, ok := conv.ToFloat(b); ok {
+			return compareFloats(x, y), true
+		}
+	}
+	if x, ok := timeValue(a); ok {
+		if y, ok := timeValue(b); ok {
+			return x.Compare(y), true
+		}
+	}
+	return strings.Compare(text(a), text(b)), true
+}
+
+// timeValue returns a time, or a time in text, as a time
+func timeValue(value interface{}) (time.Time, bool) {
+	if t, ok := value.(time.Time); ok {
+		return t, true
+	}
+	if s, ok := value.(string); ok {
+		return conv.ParseTime(s)
+	}
+	return time.Time{}, false
+}
+
+// compareFloats orders two numbers
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareForSort orders two values for a sort step: empty values come last in
+// either direction
+func compareForSort(a, b interface{}, desc bool) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	c, _ := compare(a, b)
+	if desc {
+		return -c
+	}
+	return c
+}
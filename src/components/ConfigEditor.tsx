@@ -4,6 +4,7 @@ import {
   Input,
   SecretInput,
   Select,
+  MultiSelect,
   FieldSet,
   InlineFieldRow,
   Button,
@@ -12,7 +13,7 @@ import {
   TextArea
 } from '@grafana/ui';
 import { DataSourcePluginOptionsEditorProps, SelectableValue } from '@grafana/data';
-import { MCPDataSourceOptions, MCPSecureJsonData, MCPArgument } from '../types';
+import { MCPDataSourceOptions, MCPSecureJsonData, MCPArgument, LLMProviderName } from '../types';
 
 interface Props extends DataSourcePluginOptionsEditorProps<MCPDataSourceOptions, MCPSecureJsonData> { }
 
@@ -25,6 +26,21 @@ const LLM_PROVIDER_OPTIONS: SelectableValue[] = [
   { label: 'Mock Provider', value: 'mock', description: 'Mock LLM for testing (no API key required)' },
   { label: 'Anthropic Claude', value: 'anthropic', description: 'Anthropic Claude API for intelligent queries' },
   { label: 'OpenAI GPT', value: 'openai', description: 'OpenAI GPT API for intelligent queries' },
+  { label: 'OpenAI-compatible', value: 'openai_compatible', description: 'Self-hosted or gateway endpoint (vLLM, LM Studio, LiteLLM)' },
+  { label: 'Ollama', value: 'ollama', description: 'Local Ollama server (no external LLM)' },
+  { label: 'Azure OpenAI', value: 'azure', description: 'Azure OpenAI deployment (API key or Entra ID)' },
+  { label: 'Google Gemini', value: 'gemini', description: 'Gemini API with function calling' },
+];
+
+const AUDIT_SINK_OPTIONS: Array<SelectableValue<'log' | 'file' | 'webhook'>> = [
+  { label: 'Log', value: 'log', description: 'Write tool invocations to the plugin log' },
+  { label: 'File', value: 'file', description: 'Append tool invocations to a JSON-lines file' },
+  { label: 'Webhook', value: 'webhook', description: 'Post tool invocations as JSON to an HTTP endpoint' },
+];
+
+const AZURE_AUTH_OPTIONS: SelectableValue[] = [
+  { label: 'API Key', value: 'api_key' },
+  { label: 'Entra ID (client credentials)', value: 'client_credentials' },
 ];
 
 export function ConfigEditor(props: Props) {
@@ -251,7 +267,7 @@ export function ConfigEditor(props: Props) {
       ...options,
       jsonData: {
         ...jsonData,
-        llmProvider: option.value as 'anthropic' | 'openai' | 'mock',
+        llmProvider: option.value as LLMProviderName,
       },
     });
   };
@@ -266,6 +282,92 @@ export function ConfigEditor(props: Props) {
     });
   };
 
+  const onLLMBaseURLChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...jsonData,
+        llmBaseUrl: event.target.value,
+      },
+    });
+  };
+
+  const onOllamaHostChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...jsonData,
+        ollamaHost: event.target.value,
+      },
+    });
+  };
+
+  const onOllamaKeepAliveChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...jsonData,
+        ollamaKeepAlive: event.target.value,
+      },
+    });
+  };
+
+  const onOllamaLoadTimeoutChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...jsonData,
+        ollamaLoadTimeout: parseInt(event.target.value, 10) || undefined,
+      },
+    });
+  };
+
+  const onAzureSettingChange =
+    (key: 'azureEndpoint' | 'azureDeployment' | 'azureApiVersion' | 'azureTenantId' | 'azureClientId') =>
+    (event: ChangeEvent<HTMLInputElement>) => {
+      onOptionsChange({
+        ...options,
+        jsonData: {
+          ...jsonData,
+          [key]: event.target.value,
+        },
+      });
+    };
+
+  const onAzureAuthTypeChange = (option: SelectableValue<string>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...jsonData,
+        azureAuthType: option.value as 'api_key' | 'client_credentials',
+      },
+    });
+  };
+
+  const onAzureClientSecretChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      secureJsonData: {
+        ...secureJsonData,
+        azureClientSecret: event.target.value,
+      },
+    });
+  };
+
+  const onResetAzureClientSecret = () => {
+    onOptionsChange({
+      ...options,
+      secureJsonFields: {
+        ...secureJsonFields,
+        azureClientSecret: false,
+      },
+      secureJsonData: {
+        ...secureJsonData,
+        azureClientSecret: '',
+      },
+    });
+  };
+
   const onLLMAPIKeyChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({
       ...options,
@@ -322,6 +424,52 @@ export function ConfigEditor(props: Props) {
     });
   };
 
+  const onAuditSinksChange = (selected: Array<SelectableValue<'log' | 'file' | 'webhook'>>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...jsonData,
+        auditSinks: selected.map((option) => option.value!),
+      },
+    });
+  };
+
+  const onAuditSettingChange = (key: 'auditFilePath' | 'auditWebhookUrl') => (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...jsonData,
+        [key]: event.target.value,
+      },
+    });
+  };
+
+  const onAuditWebhookTokenChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      secureJsonData: {
+        ...secureJsonData,
+        auditWebhookToken: event.target.value,
+      },
+    });
+  };
+
+  const onResetAuditWebhookToken = () => {
+    onOptionsChange({
+      ...options,
+      secureJsonFields: {
+        ...secureJsonFields,
+        auditWebhookToken: false,
+      },
+      secureJsonData: {
+        ...secureJsonData,
+        auditWebhookToken: '',
+      },
+    });
+  };
+
+  const auditSinks = jsonData.auditSinks || [];
+
   return (
     <div className="gf-form-group">
       <FieldSet label="Server Connection">
@@ -526,16 +674,162 @@ export function ConfigEditor(props: Props) {
             onChange={onLLMModelChange}
             value={jsonData.llmModel || ''}
             placeholder={(jsonData.llmProvider === 'anthropic') ? 'claude-3-5-sonnet-20241022' : 
-                         (jsonData.llmProvider === 'openai') ? 'gpt-4' : 'mock-model'}
+                         (jsonData.llmProvider === 'openai') ? 'gpt-4' :
+                         (jsonData.llmProvider === 'openai_compatible') ? 'llama-3.1-8b-instruct' :
+                         (jsonData.llmProvider === 'ollama') ? 'llama3.1' :
+                         (jsonData.llmProvider === 'gemini') ? 'gemini-2.0-flash' : 'mock-model'}
             width={40}
           />
         </InlineField>
 
-        {(jsonData.llmProvider === 'anthropic' || jsonData.llmProvider === 'openai') && (
+        {(jsonData.llmProvider === 'openai' || jsonData.llmProvider === 'openai_compatible') && (
+          <InlineField
+            label="LLM Base URL"
+            labelWidth={20}
+            tooltip="Base URL of the chat completions API; required for OpenAI-compatible endpoints"
+          >
+            <Input
+              id="config-editor-llm-base-url"
+              onChange={onLLMBaseURLChange}
+              value={jsonData.llmBaseUrl || ''}
+              placeholder={jsonData.llmProvider === 'openai' ? 'https://api.openai.com/v1' : 'http://localhost:8000/v1'}
+              width={40}
+            />
+          </InlineField>
+        )}
+
+        {jsonData.llmProvider === 'ollama' && (
+          <>
+            <InlineField
+              label="Ollama Host"
+              labelWidth={20}
+              tooltip="URL of the Ollama server"
+            >
+              <Input
+                id="config-editor-ollama-host"
+                onChange={onOllamaHostChange}
+                value={jsonData.ollamaHost || ''}
+                placeholder="http://localhost:11434"
+                width={40}
+              />
+            </InlineField>
+
+            <InlineField
+              label="Keep Alive"
+              labelWidth={20}
+              tooltip="How long Ollama keeps the model loaded after a request (e.g., 10m, or -1 to keep it loaded)"
+            >
+              <Input
+                id="config-editor-ollama-keep-alive"
+                onChange={onOllamaKeepAliveChange}
+                value={jsonData.ollamaKeepAlive || ''}
+                placeholder="5m"
+                width={15}
+              />
+            </InlineField>
+
+            <InlineField
+              label="Load Timeout"
+              labelWidth={20}
+              tooltip="Seconds to wait for the first token, including the time to load the model"
+            >
+              <Input
+                id="config-editor-ollama-load-timeout"
+                type="number"
+                onChange={onOllamaLoadTimeoutChange}
+                value={jsonData.ollamaLoadTimeout || 300}
+                placeholder="300"
+                width={15}
+                min={1}
+              />
+            </InlineField>
+          </>
+        )}
+
+        {jsonData.llmProvider === 'azure' && (
+          <>
+            <InlineField label="Azure Endpoint" labelWidth={20} tooltip="Azure OpenAI resource endpoint">
+              <Input
+                id="config-editor-azure-endpoint"
+                onChange={onAzureSettingChange('azureEndpoint')}
+                value={jsonData.azureEndpoint || ''}
+                placeholder="https://my-resource.openai.azure.com"
+                width={40}
+              />
+            </InlineField>
+
+            <InlineField label="Deployment" labelWidth={20} tooltip="Deployment name that requests are routed to">
+              <Input
+                id="config-editor-azure-deployment"
+                onChange={onAzureSettingChange('azureDeployment')}
+                value={jsonData.azureDeployment || ''}
+                placeholder="gpt-4o"
+                width={40}
+              />
+            </InlineField>
+
+            <InlineField label="API Version" labelWidth={20} tooltip="Azure OpenAI API version">
+              <Input
+                id="config-editor-azure-api-version"
+                onChange={onAzureSettingChange('azureApiVersion')}
+                value={jsonData.azureApiVersion || ''}
+                placeholder="2024-10-21"
+                width={40}
+              />
+            </InlineField>
+
+            <InlineField label="Authentication" labelWidth={20} tooltip="Authenticate with an API key or an Entra ID application">
+              <Select
+                options={AZURE_AUTH_OPTIONS}
+                value={jsonData.azureAuthType || 'api_key'}
+                onChange={onAzureAuthTypeChange}
+                width={40}
+              />
+            </InlineField>
+
+            {jsonData.azureAuthType === 'client_credentials' && (
+              <>
+                <InlineField label="Tenant ID" labelWidth={20} tooltip="Entra ID tenant">
+                  <Input
+                    id="config-editor-azure-tenant-id"
+                    onChange={onAzureSettingChange('azureTenantId')}
+                    value={jsonData.azureTenantId || ''}
+                    width={40}
+                  />
+                </InlineField>
+
+                <InlineField label="Client ID" labelWidth={20} tooltip="Entra ID application (client) ID">
+                  <Input
+                    id="config-editor-azure-client-id"
+                    onChange={onAzureSettingChange('azureClientId')}
+                    value={jsonData.azureClientId || ''}
+                    width={40}
+                  />
+                </InlineField>
+
+                <InlineField label="Client Secret" labelWidth={20} tooltip="Entra ID client secret, stored securely">
+                  <SecretInput
+                    id="config-editor-azure-client-secret"
+                    isConfigured={secureJsonFields?.azureClientSecret}
+                    value={secureJsonData?.azureClientSecret || ''}
+                    width={40}
+                    onReset={onResetAzureClientSecret}
+                    onChange={onAzureClientSecretChange}
+                  />
+                </InlineField>
+              </>
+            )}
+          </>
+        )}
+
+        {(jsonData.llmProvider === 'anthropic' || jsonData.llmProvider === 'openai' || jsonData.llmProvider === 'openai_compatible' ||
+          jsonData.llmProvider === 'gemini' || (jsonData.llmProvider === 'azure' && jsonData.azureAuthType !== 'client_credentials')) && (
           <InlineField
             label="LLM API Key"
             labelWidth={20}
-            tooltip={`API key for ${jsonData.llmProvider === 'anthropic' ? 'Anthropic Claude' : 'OpenAI GPT'} service`}
+            tooltip={jsonData.llmProvider === 'openai_compatible'
+              ? 'Optional API key, sent as a bearer token to the OpenAI-compatible endpoint'
+              : `API key for ${jsonData.llmProvider === 'anthropic' ? 'Anthropic Claude' : jsonData.llmProvider === 'azure' ? 'Azure OpenAI' : jsonData.llmProvider === 'gemini' ? 'Google Gemini' : 'OpenAI GPT'} service`}
           >
             <SecretInput
               id="config-editor-llm-api-key"
@@ -604,6 +898,56 @@ export function ConfigEditor(props: Props) {
           </div>
         )}
       </FieldSet>
+
+      <FieldSet label="Audit">
+        <InlineField label="Sinks" labelWidth={20} tooltip="Where tool invocations are recorded; leave empty to disable auditing">
+          <MultiSelect
+            inputId="config-editor-audit-sinks"
+            options={AUDIT_SINK_OPTIONS}
+            value={auditSinks}
+            onChange={onAuditSinksChange}
+            placeholder="Disabled"
+            width={40}
+          />
+        </InlineField>
+
+        {auditSinks.includes('file') && (
+          <InlineField label="File Path" labelWidth={20} tooltip="JSON-lines file the tool invocations are appended to">
+            <Input
+              id="config-editor-audit-file-path"
+              onChange={onAuditSettingChange('auditFilePath')}
+              value={jsonData.auditFilePath || ''}
+              placeholder="/var/lib/grafana/mcp-audit.jsonl"
+              width={40}
+            />
+          </InlineField>
+        )}
+
+        {auditSinks.includes('webhook') && (
+          <>
+            <InlineField label="Webhook URL" labelWidth={20} tooltip="Endpoint each tool invocation is posted to as JSON">
+              <Input
+                id="config-editor-audit-webhook-url"
+                onChange={onAuditSettingChange('auditWebhookUrl')}
+                value={jsonData.auditWebhookUrl || ''}
+                placeholder="https://audit.example.com/events"
+                width={40}
+              />
+            </InlineField>
+
+            <InlineField label="Webhook Token" labelWidth={20} tooltip="Optional bearer token for the webhook, stored securely">
+              <SecretInput
+                id="config-editor-audit-webhook-token"
+                isConfigured={secureJsonFields?.auditWebhookToken}
+                value={secureJsonData?.auditWebhookToken || ''}
+                width={40}
+                onReset={onResetAuditWebhookToken}
+                onChange={onAuditWebhookTokenChange}
+              />
+            </InlineField>
+          </>
+        )}
+      </FieldSet>
     </div>
   );
 }
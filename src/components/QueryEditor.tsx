@@ -55,6 +55,7 @@ export function QueryEditor({ query, onChange, onRunQuery, datasource }: Props)
           ...currentQuery,
           generatedToolCall: updateEvent.generatedToolCall,
           toolName: updateEvent.generatedToolCall.toolName, // Auto-select the tool that was used
+          transforms: updateEvent.generatedTransforms ?? currentQuery.transforms,
         };
         
         onChange(updatedQuery);
@@ -65,6 +66,9 @@ export function QueryEditor({ query, onChange, onRunQuery, datasource }: Props)
         
         return () => clearTimeout(timer);
       }
+      if (updateEvent.refId === query.refId && updateEvent.generatedTransforms) {
+        onChange({ ...currentQuery, transforms: updateEvent.generatedTransforms });
+      }
     });
 
     // Cleanup subscription on unmount
@@ -111,6 +115,10 @@ export function QueryEditor({ query, onChange, onRunQuery, datasource }: Props)
     if (currentQuery.generatedToolCall && currentQuery.generatedToolCall.originalQuery !== newQuery) {
       updatedQuery.generatedToolCall = undefined;
     }
+    // Generated transforms were written for the previous text
+    if (currentQuery.generateTransforms) {
+      updatedQuery.transforms = undefined;
+    }
     
     onChange(updatedQuery);
   };
@@ -5,18 +5,24 @@ import {
   DataQueryRequest,
   DataQueryResponse,
   TestDataSourceResponse,
-  LoadingState
+  LoadingState,
+  LiveChannelScope,
+  FieldType,
+  createDataFrame,
+  isLiveChannelMessageEvent,
 } from '@grafana/data';
-import { DataSourceWithBackend, getTemplateSrv, getBackendSrv } from '@grafana/runtime';
-import { map } from 'rxjs/operators';
-import { Subject, Observable } from 'rxjs';
+import { DataSourceWithBackend, getTemplateSrv, getBackendSrv, getGrafanaLiveSrv } from '@grafana/runtime';
+import { map, filter, scan, share, takeUntil } from 'rxjs/operators';
+import { Subject, Observable, merge, concat, from } from 'rxjs';
 
 import { 
   MCPQuery, 
   MCPDataSourceOptions, 
   DEFAULT_QUERY, 
   MCPTool, 
-  MCPConnectionStatus
+  MCPConnectionStatus,
+  MCPProgressEvent,
+  MCPTransformStep
 } from './types';
 
 export interface QueryUpdateEvent {
@@ -27,6 +33,42 @@ export interface QueryUpdateEvent {
     arguments: Record<string, any>;
     originalQuery: string;
   };
+  generatedTransforms?: MCPTransformStep[];
+}
+
+function reportsProgress(query: MCPQuery): boolean {
+  return query.queryType !== 'list_tools';
+}
+
+// Number of tool log messages shown while a query is running
+const MAX_TOOL_LOG_LINES = 20;
+
+function logSeverity(level?: string): 'info' | 'warning' | 'error' {
+  switch (level) {
+    case 'warning':
+      return 'warning';
+    case 'error':
+    case 'critical':
+    case 'alert':
+    case 'emergency':
+      return 'error';
+    default:
+      return 'info';
+  }
+}
+
+// Query group ids name the progress channels, so they must not be guessable
+function newQueryGroupId(): string {
+  const bytes = crypto.getRandomValues(new Uint8Array(16));
+  return Array.from(bytes, (byte) => byte.toString(16).padStart(2, '0')).join('');
+}
+
+// The backend publishes the progress of a query on progress/<query group id>-<refId>
+const PROGRESS_ID_PATTERN = /^[A-Za-z0-9_-]{1,64}$/;
+
+function progressId(queryGroupId: string, target: MCPQuery): string | undefined {
+  const id = `${queryGroupId}-${target.refId}`;
+  return reportsProgress(target) && PROGRESS_ID_PATTERN.test(id) ? id : undefined;
 }
 
 export class DataSource extends DataSourceWithBackend<MCPQuery, MCPDataSourceOptions> {
@@ -66,9 +108,12 @@ export class DataSource extends DataSourceWithBackend<MCPQuery, MCPDataSourceOpt
    * Override query method to add custom MCP-specific logic
    */
   query(request: DataQueryRequest<MCPQuery>) {
-    // Pre-process queries to ensure they have required fields
+    // Pre-process queries to ensure they have required fields. Queries running tools
+    // report their progress on a live channel named after the query group, which is
+    // sent as a header so the queries themselves stay the same for caching.
     const processedRequest = {
       ...request,
+      queryGroupId: newQueryGroupId(),
       targets: request.targets.map(target => ({
         ...target,
         query: target.query || '',
@@ -78,42 +123,113 @@ export class DataSource extends DataSourceWithBackend<MCPQuery, MCPDataSourceOpt
     };
 
     // Call the backend through the parent class and process the response
-    return super.query(processedRequest).pipe(
+    const response$ = super.query(processedRequest).pipe(
       map((response: DataQueryResponse) => {
-        // Process each data frame to extract generated tool calls from metadata
+        // Process each data frame to extract generated tool calls and transforms from
+        // metadata
         if (response.data) {
-          response.data.forEach((frame, index) => {
+          response.data.forEach((frame) => {
             const customMeta = frame.meta?.custom;
-            if (customMeta && customMeta.generated_tool_call) {
-              // Extract the generated tool call from the response metadata
-              const generatedToolCall = customMeta.generated_tool_call;
-              
-              // Update the corresponding target with the generated tool call
-              // This allows Grafana to persist it as part of the query configuration
-              if (processedRequest.targets[index]) {
-                const originalQuery = processedRequest.targets[index];
-                const updatedGeneratedToolCall = {
-                  toolName: generatedToolCall.toolName,
-                  arguments: generatedToolCall.arguments,
-                  originalQuery: generatedToolCall.originalQuery,
-                };
-                
-                processedRequest.targets[index].generatedToolCall = updatedGeneratedToolCall;
-                
+            if (customMeta && (customMeta.generated_tool_call || customMeta.generated_transforms)) {
+              // Update the target of the frame with what was generated. A query can
+              // return several frames, so the target is found by refId, not position.
+              // This allows Grafana to persist it as part of the query configuration,
+              // so refreshes neither call the LLM again nor get a different result
+              const originalQuery = processedRequest.targets.find((target) => target.refId === frame.refId);
+              if (originalQuery) {
+                const updateEvent: QueryUpdateEvent = { refId: originalQuery.refId, originalQuery: originalQuery };
+
+                // Extract the generated tool call from the response metadata
+                const generatedToolCall = customMeta.generated_tool_call;
+                if (generatedToolCall) {
+                  updateEvent.generatedToolCall = {
+                    toolName: generatedToolCall.toolName,
+                    arguments: generatedToolCall.arguments,
+                    originalQuery: generatedToolCall.originalQuery,
+                  };
+                  originalQuery.generatedToolCall = updateEvent.generatedToolCall;
+                }
+
+                // The generated transform pipeline becomes the transforms of the query
+                if (customMeta.generated_transforms) {
+                  updateEvent.generatedTransforms = customMeta.generated_transforms;
+                  originalQuery.transforms = updateEvent.generatedTransforms;
+                }
+
                 // Emit query update event for subscribers (like QueryEditor)
-                this.queryUpdatesSubject.next({
-                  refId: originalQuery.refId,
-                  originalQuery: originalQuery,
-                  generatedToolCall: updatedGeneratedToolCall,
-                });
+                this.queryUpdatesSubject.next(updateEvent);
               }
             }
           });
         }
         
         return response;
-      })
+      }),
+      share()
+    );
+
+    // Show progress until the backend returns the result, then remove the progress frames
+    const progressTargets = processedRequest.targets.filter((target) => progressId(processedRequest.queryGroupId, target));
+    const progress$ = this.queryProgress(processedRequest.queryGroupId, progressTargets).pipe(takeUntil(response$));
+    const progressDone$ = from(
+      progressTargets.map(
+        (target): DataQueryResponse => ({ key: `progress-${target.refId}`, state: LoadingState.Done, data: [] })
+      )
+    );
+    return merge(progress$, concat(response$, progressDone$));
+  }
+
+  /**
+   * Streams the progress of queries as loading responses with a "progress" frame per
+   * query: the current step and the log messages of the running tool as notices, and
+   * the summary so far
+   */
+  private queryProgress(queryGroupId: string, targets: MCPQuery[]): Observable<DataQueryResponse> {
+    const streams = targets.map((target) =>
+      getGrafanaLiveSrv()
+        .getStream<MCPProgressEvent>({
+          scope: LiveChannelScope.DataSource,
+          namespace: this.uid,
+          path: `progress/${progressId(queryGroupId, target)}`,
+        })
+        .pipe(
+          filter(isLiveChannelMessageEvent),
+          scan(
+            (progress, event) => {
+              const message = event.message;
+              if (message.stage === 'text') {
+                return { ...progress, summary: progress.summary + (message.text || '') };
+              }
+              if (message.stage === 'tool_log') {
+                if (!message.message || message.level === 'debug') {
+                  return progress;
+                }
+                const log = [...progress.log, { severity: logSeverity(message.level), text: message.message }];
+                return { ...progress, log: log.slice(-MAX_TOOL_LOG_LINES) };
+              }
+              return message.message ? { ...progress, step: message.message } : progress;
+            },
+            { step: '', summary: '', log: [] as Array<{ severity: 'info' | 'warning' | 'error'; text: string }> }
+          ),
+          map(
+            (progress): DataQueryResponse => ({
+              key: `progress-${target.refId}`,
+              state: LoadingState.Loading,
+              data: [
+                createDataFrame({
+                  refId: target.refId,
+                  name: 'progress',
+                  fields: [{ name: 'summary', type: FieldType.string, values: [progress.summary] }],
+                  meta: {
+                    notices: [...(progress.step ? [{ severity: 'info' as const, text: progress.step }] : []), ...progress.log],
+                  },
+                }),
+              ],
+            })
+          )
+        )
     );
+    return merge(...streams);
   }
 
   /**
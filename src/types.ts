@@ -5,6 +5,7 @@ import { DataQuery } from '@grafana/schema';
  * MCP Query interface that extends the standard DataQuery
  */
 export interface MCPQuery extends DataQuery {
+  queryType?: string;                   // 'natural_language' (default), 'tool_call' or 'list_tools'
   query?: string;                       // Natural language query
   toolName?: string;                    // Specific MCP tool to use (optional)
   arguments?: Record<string, any>;      // Additional arguments for the tool
@@ -18,6 +19,95 @@ export interface MCPQuery extends DataQuery {
     arguments: Record<string, any>;
     originalQuery: string;              // Original query text that generated this tool call
   };
+
+  extraction?: MCPExtraction;           // Table extracted from the JSON result of a tool call
+  transforms?: MCPTransformStep[];      // Transformations of the result rows, run in the backend before framing
+  generateTransforms?: boolean;         // Let the LLM write the transforms when there are none
+
+  customOptions?: {
+    schema?: MCPSchemaHint;             // How the result frame is typed, ordered and labelled
+    [key: string]: any;
+  };
+}
+
+/**
+ * How the JSON result of a tool call becomes a table. Expressions are JMESPath,
+ * or JSONPath when they start with $.
+ */
+export interface MCPExtraction {
+  rows: string;                         // Selects the rows, e.g. 'data.items' or '$.items[*]'
+  columns?: Array<{
+    name: string;
+    expression?: string;                // Evaluated on each row; the property named like the column if empty
+    type?: MCPColumnType;
+    unit?: string;
+    displayName?: string;
+  }>;
+  timeColumn?: string;                  // Column converted to time and moved first
+}
+
+/**
+ * A step of the transform pipeline of a query
+ */
+export interface MCPTransformStep {
+  type: 'filter' | 'select' | 'rename' | 'group_by' | 'sort' | 'limit' | 'time_bucket' | 'derive';
+  column?: string;                      // filter, time_bucket
+  op?: '=' | '!=' | '>' | '>=' | '<' | '<=' | 'contains' | '=~' | '!~';
+  value?: any;                          // filter
+  columns?: string[];                   // select
+  names?: Record<string, string>;       // rename: old name to new name
+  by?: string[];                        // group_by, sort
+  aggregates?: Array<{
+    op: 'count' | 'sum' | 'avg' | 'min' | 'max' | 'first' | 'last';
+    column?: string;
+    as?: string;
+  }>;
+  desc?: boolean;                       // sort
+  count?: number;                       // limit
+  interval?: string;                    // time_bucket, e.g. '5m' or '1d'
+  expression?: string;                  // derive, e.g. 'bytes / 1024'
+  as?: string;                          // derive, time_bucket
+}
+
+/**
+ * Column types of a schema hint
+ */
+export type MCPColumnType = 'time' | 'number' | 'string' | 'bool' | 'enum';
+
+/**
+ * Describes the frame a query returns: the column order, types, units and display names
+ */
+export interface MCPSchemaHint {
+  columns: Array<{
+    name: string;
+    type?: MCPColumnType;
+    unit?: string;                      // Grafana unit, e.g. 'ms' or 'bytes'
+    displayName?: string;
+  }>;
+  timeColumn?: string;                  // Column converted to time and moved first
+}
+
+/**
+ * Progress of a query, streamed on the datasource live channel
+ */
+export interface MCPProgressEvent {
+  stage:
+    | 'selecting_tool'
+    | 'generating_arguments'
+    | 'calling_tool'
+    | 'tool_progress'
+    | 'tool_log'
+    | 'fixing_syntax'
+    | 'structuring'
+    | 'text'
+    | 'done';
+  message?: string;                     // Human readable step, e.g. "Calling loki_query…"
+  tool?: string;
+  attempt?: number;
+  text?: string;                        // Next piece of the streamed summary ('text' events)
+  progress?: number;                    // Progress reported by the running tool ('tool_progress' events)
+  total?: number;
+  level?: string;                       // MCP log level of the tool's log message ('tool_log' events)
 }
 
 export const DEFAULT_QUERY: Partial<MCPQuery> = {
@@ -34,6 +124,7 @@ export interface MCPTool {
   name: string;
   description?: string;
   inputSchema?: any;
+  outputSchema?: any;                   // Schema of the structured content the tool returns
 }
 
 /**
@@ -76,6 +167,20 @@ export interface MCPConnectionStatus {
 /**
  * DataSource configuration options stored in Grafana
  */
+/**
+ * LLM providers registered in the backend
+ */
+export type LLMProviderName = 'anthropic' | 'openai' | 'openai_compatible' | 'ollama' | 'azure' | 'gemini' | 'mock';
+
+/**
+ * A provider in the LLM fallback chain
+ */
+export interface LLMFallback {
+  provider: LLMProviderName;
+  model?: string;
+  baseUrl?: string;
+}
+
 export interface MCPDataSourceOptions extends DataSourceJsonData {
   serverUrl?: string;                   // MCP server URL (HTTP/HTTPS)
   transport?: 'stream' | 'sse';         // Transport protocol (stream is recommended, sse is deprecated)
@@ -87,13 +192,51 @@ export interface MCPDataSourceOptions extends DataSourceJsonData {
   // Arguments to pass to MCP server
   arguments?: Record<string, string>;   // Regular arguments (e.g., database name, host)
   secureArguments?: string[];           // Names of arguments that are stored securely
+
+  // Tool policy
+  toolAllowlist?: string[];             // Glob patterns of tool names that may be called (empty allows all)
+  toolDenylist?: string[];              // Glob patterns of tool names that may never be called
+  readOnlyTools?: boolean;              // Only allow tools annotated with readOnlyHint
+  blockDestructiveTools?: boolean;      // Block destructive tools, including unannotated ones
+
+  // Redaction
+  redactionDetectors?: Array<'secrets' | 'email' | 'ip'>;  // Built-in detectors (empty uses all three)
+  redactionPatterns?: string[];         // Additional regular expressions to redact
+  disableRedaction?: boolean;           // Disable detectors and patterns (secure arguments are always masked)
   
   // Agent Configuration
-  llmProvider?: 'anthropic' | 'openai' | 'mock';  // LLM provider for natural language processing
+  llmProvider?: LLMProviderName;        // LLM provider for natural language processing
   llmModel?: string;                    // LLM model name (e.g., claude-3-5-sonnet-20241022, gpt-4)
+  llmBaseUrl?: string;                  // Base URL override for OpenAI, OpenAI-compatible and Gemini APIs
+  ollamaHost?: string;                  // Ollama server URL (default: http://localhost:11434)
+  ollamaKeepAlive?: string;             // How long Ollama keeps the model loaded (e.g., 10m, -1)
+  ollamaLoadTimeout?: number;           // Seconds to wait for the first token, including model load
+  azureEndpoint?: string;               // Azure OpenAI resource endpoint
+  azureDeployment?: string;             // Azure OpenAI deployment name
+  azureApiVersion?: string;             // Azure OpenAI API version (default: 2024-10-21)
+  azureAuthType?: 'api_key' | 'client_credentials'; // API key or Entra ID client credentials
+  azureTenantId?: string;               // Entra ID tenant
+  azureClientId?: string;               // Entra ID application (client) ID
+  azureAuthorityHost?: string;          // Entra ID authority (default: https://login.microsoftonline.com)
+  llmFallbacks?: LLMFallback[];         // Providers tried in order on 429, 5xx or timeouts
+  llmAttemptTimeout?: number;           // Seconds a provider may take before the next fallback is tried
+  llmToolCallModel?: string;            // Model for tool selection (default: llmModel)
+  llmSyntaxFixModel?: string;           // Model for fixing query syntax errors (default: llmModel)
+  llmStructuringModel?: string;         // Model for structuring tool results (default: llmModel)
+  llmRequestsPerMinute?: number;        // Maximum LLM requests per minute for the datasource (0: unlimited)
+  llmTokensPerMinute?: number;          // Maximum LLM tokens per minute for the datasource (0: unlimited)
+  llmMaxRetries?: number;               // Retries on 429, 529 and 5xx responses (default: 3, -1 disables)
+  llmMaxBackoff?: number;               // Longest delay in seconds before a retry, including Retry-After (default: 30)
+  llmCircuitBreakerThreshold?: number;  // Consecutive failures that open the circuit for an LLM host (default: 5)
+  llmCircuitBreakerCooldown?: number;   // Seconds an open circuit rejects requests (default: 30)
   systemPrompt?: string;                // System prompt always sent to LLM
   maxTokens?: number;                   // Maximum tokens for LLM responses
   agentRetries?: number;                // Number of retry attempts for agent calls
+
+  // Audit Configuration
+  auditSinks?: Array<'log' | 'file' | 'webhook'>; // Where tool invocations are recorded
+  auditFilePath?: string;               // JSON-lines file for the 'file' sink
+  auditWebhookUrl?: string;             // Endpoint for the 'webhook' sink
 }
 
 /**
@@ -102,6 +245,10 @@ export interface MCPDataSourceOptions extends DataSourceJsonData {
 export interface MCPSecureJsonData {
   // LLM API Keys
   llmApiKey?: string;                   // API key for LLM provider (Anthropic, OpenAI, etc.)
+  azureClientSecret?: string;           // Entra ID client secret for Azure OpenAI
+  // API keys of fallback providers are stored as 'llmApiKey_<provider>', e.g. 'llmApiKey_openai'
+  // Extra HTTP headers sent with every LLM request are stored as 'llmHeader_<name>', e.g. 'llmHeader_X-Team'
+  auditWebhookToken?: string;           // Bearer token for the audit webhook
   
   // Dynamic secure arguments - these are stored with 'arg_' prefix
   // e.g., if user adds secure argument 'password', it's stored as 'arg_password'